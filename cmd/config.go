@@ -0,0 +1,80 @@
+/*
+Copyright 2017 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"strings"
+
+	"github.com/kubernetes/kompose/pkg/app"
+	"github.com/kubernetes/kompose/pkg/kobject"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// Config command flags
+var (
+	ConfigOut        string
+	ConfigJSON       bool
+	ConfigYAMLIndent int
+	ConfigProfiles   []string
+	ConfigOpt        kobject.ConvertOptions
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Print the resolved compose model",
+	Long: `Print the compose model kompose converts, once the compose files are loaded, merged and interpolated.
+It includes the settings read from the kompose labels, and helps telling apart loading and conversion issues.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) != 0 {
+			log.Fatal("Unknown Argument(s): ", strings.Join(args, ","))
+		}
+
+		ConfigOpt = kobject.ConvertOptions{
+			InputFiles:   GlobalFiles,
+			Profiles:     getProfiles(cmd, ConfigProfiles),
+			Provider:     GlobalProvider,
+			GenerateJSON: ConfigJSON,
+			OutFile:      ConfigOut,
+			YAMLIndent:   ConfigYAMLIndent,
+		}
+
+		if err := app.ValidateComposeFile(&ConfigOpt); err != nil {
+			log.Fatal(err)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		komposeObject, diags, err := app.Config(context.Background(), ConfigOpt)
+		if err != nil {
+			log.Fatal(err)
+		}
+		checkDiagnostics(diags)
+		if err := app.PrintKomposeObject(komposeObject, ConfigOpt); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	configCmd.Flags().BoolVarP(&ConfigJSON, "json", "j", false, "Print the compose model in JSON format")
+	configCmd.Flags().StringVarP(&ConfigOut, "out", "o", "", "Specify a file name to save the compose model to")
+	configCmd.Flags().IntVar(&ConfigYAMLIndent, "indent", 2, "Spaces length to indent the YAML output")
+	configCmd.Flags().StringArrayVar(&ConfigProfiles, "profile", []string{}, "Specify a profile to enable, can be repeated (default from COMPOSE_PROFILES)")
+
+	RootCmd.AddCommand(configCmd)
+}
@@ -17,10 +17,16 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
+	"os"
 	"strings"
 
 	"github.com/kubernetes/kompose/pkg/app"
+	"github.com/kubernetes/kompose/pkg/diagnostics"
 	"github.com/kubernetes/kompose/pkg/kobject"
+	"github.com/kubernetes/kompose/pkg/transformer"
+	"github.com/kubernetes/kompose/pkg/transformer/kubernetes"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -50,6 +56,21 @@ var (
 	ConvertPushImageRegistry     string
 	ConvertOpt                   kobject.ConvertOptions
 	ConvertYAMLIndent            int
+	ConvertProfiles              []string
+	ConvertReport                string
+	ConvertReportOut             string
+	ConvertNamespace             string
+	ConvertCreateNamespace       bool
+	ConvertProjectName           string
+	ConvertExposeMode            string
+	ConvertGateway               string
+	ConvertGatewayClass          string
+	ConvertCertManagerIssuer     string
+	ConvertIngressNamespace      string
+	ConvertDefaultDeny           bool
+	ConvertSecurityProfile       string
+	ConvertResolveUsers          bool
+	ConvertOCILayout             string
 
 	UpBuild string
 
@@ -57,6 +78,10 @@ var (
 	// default is true.
 	WithKomposeAnnotation bool
 
+	// WithSourceAnnotation decides if we will record on resources the compose key they were generated from.
+	// default is false.
+	WithSourceAnnotation bool
+
 	// MultipleContainerMode which enables creating multi containers in a single pod is a developping function.
 	// default is false
 	MultipleContainerMode bool
@@ -83,6 +108,7 @@ var convertCmd = &cobra.Command{
 			GenerateJSON:                ConvertJSON,
 			Replicas:                    ConvertReplicas,
 			InputFiles:                  GlobalFiles,
+			Profiles:                    getProfiles(cmd, ConvertProfiles),
 			OutFile:                     ConvertOut,
 			Provider:                    GlobalProvider,
 			CreateD:                     ConvertDeployment,
@@ -106,24 +132,98 @@ var convertCmd = &cobra.Command{
 			IsDeploymentConfigFlag:      cmd.Flags().Lookup("deployment-config").Changed,
 			YAMLIndent:                  ConvertYAMLIndent,
 			WithKomposeAnnotation:       WithKomposeAnnotation,
+			WithSourceAnnotation:        WithSourceAnnotation,
+			Namespace:                   ConvertNamespace,
+			IsNamespaceFlag:             cmd.Flags().Lookup("namespace").Changed,
+			CreateNamespace:             ConvertCreateNamespace,
+			ProjectName:                 getProjectName(cmd, ConvertProjectName),
+			IsProjectNameFlag:           cmd.Flags().Lookup("project-name").Changed,
+			ExposeMode:                  strings.ToLower(ConvertExposeMode),
+			Gateway:                     ConvertGateway,
+			GatewayClass:                ConvertGatewayClass,
+			CertManagerIssuer:           ConvertCertManagerIssuer,
+			NetworkIngressNamespace:     ConvertIngressNamespace,
+			NetworkDefaultDeny:          ConvertDefaultDeny,
+			SecurityProfile:             strings.ToLower(ConvertSecurityProfile),
+			ResolveUsers:                ConvertResolveUsers,
+			OCILayout:                   ConvertOCILayout,
+			Command:                     strings.Join(os.Args, " "),
 			MultipleContainerMode:       MultipleContainerMode,
 			ServiceGroupMode:            ServiceGroupMode,
 			ServiceGroupName:            ServiceGroupName,
 		}
 
+		if ConvertReport != "" && ConvertReport != diagnostics.ReportJSON && ConvertReport != diagnostics.ReportSARIF {
+			log.Fatalf("Unknown report format %q, possible values are: %s and %s", ConvertReport, diagnostics.ReportJSON, diagnostics.ReportSARIF)
+		}
+
 		if ServiceGroupMode == "" && MultipleContainerMode {
 			ConvertOpt.ServiceGroupMode = "label"
 		}
 
-		app.ValidateFlags(args, cmd, &ConvertOpt)
-		app.ValidateComposeFile(&ConvertOpt)
+		if err := app.ValidateFlags(args, cmd, &ConvertOpt); err != nil {
+			log.Fatal(err)
+		}
+		if err := app.ValidateComposeFile(&ConvertOpt); err != nil {
+			log.Fatal(err)
+		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
+		objects, diags, err := app.Convert(context.Background(), ConvertOpt)
+		if ConvertReport != "" {
+			if err := writeReport(ConvertReport, ConvertReportOut, diags); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		checkDiagnostics(diags)
 
-		app.Convert(ConvertOpt)
+		// Print output
+		if err := kubernetes.PrintList(objects, ConvertOpt); err != nil {
+			log.Fatal(err)
+		}
 	},
 }
 
+// writeReport writes the diagnostics report to the given file, or to kompose-report.<format> when out is empty
+func writeReport(format string, out string, diags diagnostics.Diagnostics) error {
+	if out == "" {
+		out = "kompose-report." + format
+	}
+	f, err := transformer.CreateOutFile(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := diagnostics.WriteReport(f, format, diags); err != nil {
+		return errors.Wrapf(err, "failed to write %s", out)
+	}
+	log.Infof("Report written to %q", out)
+	return nil
+}
+
+// getProfiles returns the profiles given with --profile, or the ones of the COMPOSE_PROFILES
+// environment variable when the flag is not set, like docker compose
+func getProfiles(cmd *cobra.Command, profiles []string) []string {
+	if !cmd.Flags().Lookup("profile").Changed {
+		if env := os.Getenv("COMPOSE_PROFILES"); env != "" {
+			return strings.Split(env, ",")
+		}
+	}
+	return profiles
+}
+
+// getProjectName returns the project name given with --project-name, or the one of the
+// COMPOSE_PROJECT_NAME environment variable when the flag is not set, like docker compose
+func getProjectName(cmd *cobra.Command, projectName string) string {
+	if !cmd.Flags().Lookup("project-name").Changed {
+		return os.Getenv("COMPOSE_PROJECT_NAME")
+	}
+	return projectName
+}
+
 func init() {
 	// Automatically grab environment variables
 	viper.AutomaticEnv()
@@ -133,7 +233,7 @@ func init() {
 	convertCmd.Flags().BoolVar(&ConvertDaemonSet, "daemon-set", false, "Generate a Kubernetes daemonset object (deprecated, use --controller instead)")
 	convertCmd.Flags().BoolVarP(&ConvertDeployment, "deployment", "d", false, "Generate a Kubernetes deployment object (deprecated, use --controller instead)")
 	convertCmd.Flags().BoolVar(&ConvertReplicationController, "replication-controller", false, "Generate a Kubernetes replication controller object (deprecated, use --controller instead)")
-	convertCmd.Flags().StringVar(&ConvertController, "controller", "", `Set the output controller ("deployment"|"daemonSet"|"replicationController")`)
+	convertCmd.Flags().StringVar(&ConvertController, "controller", "", `Set the output controller ("deployment"|"daemonSet"|"replicationController"|"statefulSet")`)
 	convertCmd.Flags().MarkDeprecated("daemon-set", "use --controller")
 	convertCmd.Flags().MarkDeprecated("deployment", "use --controller")
 	convertCmd.Flags().MarkDeprecated("replication-controller", "use --controller")
@@ -170,8 +270,27 @@ func init() {
 	convertCmd.Flags().IntVar(&ConvertReplicas, "replicas", 1, "Specify the number of replicas in the generated resource spec")
 	convertCmd.Flags().StringVar(&ConvertVolumes, "volumes", "persistentVolumeClaim", `Volumes to be generated ("persistentVolumeClaim"|"emptyDir"|"hostPath" | "configMap")`)
 	convertCmd.Flags().StringVar(&ConvertPVCRequestSize, "pvc-request-size", "", `Specify the size of pvc storage requests in the generated resource spec`)
+	convertCmd.Flags().StringVarP(&ConvertNamespace, "namespace", "n", "", "Specify the namespace of the generated resources")
+	convertCmd.Flags().BoolVar(&ConvertCreateNamespace, "create-namespace", false, "Generate the Namespace object given with --namespace")
+	convertCmd.Flags().StringVarP(&ConvertProjectName, "project-name", "p", "", "Prefix the names of the generated resources with a project name, the directory name when empty (default from COMPOSE_PROJECT_NAME)")
+
+	convertCmd.Flags().StringVar(&ConvertExposeMode, "expose-mode", "", `Set the objects exposing the services with kompose.service.expose ("ingress"|"gateway"|"route"(OpenShift only)) (default "ingress", "route" with OpenShift)`)
+	convertCmd.Flags().StringVar(&ConvertGateway, "gateway", "", "Specify the parent Gateway of the HTTPRoutes generated with --expose-mode=gateway, as name or namespace/name")
+	convertCmd.Flags().StringVar(&ConvertGatewayClass, "gateway-class", "", "Generate the parent Gateway of the HTTPRoutes with this class, named after --gateway (default name kompose)")
+	convertCmd.Flags().StringVar(&ConvertCertManagerIssuer, "cert-manager-issuer", "", "Issue the TLS secrets of the exposed services with cert-manager, from this Issuer, or ClusterIssuer given as ClusterIssuer/name")
+	convertCmd.Flags().StringVar(&ConvertIngressNamespace, "network-policy-ingress-namespace", "", "Open the published ports of the services isolated by network policies to the pods of this namespace only, the one of the ingress controller")
+	convertCmd.Flags().BoolVar(&ConvertDefaultDeny, "network-policy-default-deny", false, "Generate network policies denying the traffic, egress included, the policies of the networks and the published ports don't allow, DNS aside")
+	convertCmd.Flags().StringVar(&ConvertSecurityProfile, "security-profile", "", `Report the settings of the services violating a Pod Security Standard ("baseline"|"restricted"), and harden the security contexts for "restricted"`)
+	convertCmd.Flags().BoolVar(&ConvertResolveUsers, "resolve-users", false, "Resolve the named users and groups of the services to their ids, from the /etc/passwd and /etc/group of the images of the local docker daemon")
+	convertCmd.Flags().StringVar(&ConvertOCILayout, "oci-layout", "", "Resolve the users with --resolve-users from the images of this OCI image layout directory, instead of the local docker daemon")
+
+	convertCmd.Flags().StringArrayVar(&ConvertProfiles, "profile", []string{}, "Specify a profile to enable, can be repeated (default from COMPOSE_PROFILES)")
 
 	convertCmd.Flags().BoolVar(&WithKomposeAnnotation, "with-kompose-annotation", true, "Add kompose annotations to generated resource")
+	convertCmd.Flags().BoolVar(&WithSourceAnnotation, "with-source-annotation", false, "Add a kompose.io/source annotation with the compose file, line and key each resource was generated from")
+
+	convertCmd.Flags().StringVar(&ConvertReport, "report", "", `Write the issues found during the conversion to a report ("json"|"sarif")`)
+	convertCmd.Flags().StringVar(&ConvertReportOut, "report-out", "", "Specify a file name to save the report to (default kompose-report.<format>)")
 
 	// Deprecated commands
 	convertCmd.Flags().BoolVar(&ConvertEmptyVols, "emptyvols", false, "Use Empty Volumes. Do not generate PVCs")
@@ -195,7 +314,7 @@ Available Commands:{{range .Commands}}{{if .IsAvailableCommand}}
 
 Kubernetes Flags:
   -c, --chart                    Create a Helm chart for converted objects
-      --controller               Set the output controller ("deployment"|"daemonSet"|"replicationController")
+      --controller               Set the output controller ("deployment"|"daemonSet"|"replicationController"|"statefulSet")
       --service-group-mode       Group multiple service to create single workload by "label"("kompose.service.group") or "volume"(shared volumes)
       --service-group-name       Using with --service-group-mode=volume to specific a final service name for the group
 
@@ -17,32 +17,21 @@ limitations under the License.
 package cmd
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
 
+	"github.com/kubernetes/kompose/pkg/diagnostics"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
-// Logrus hooks
-
-// Hook for error and exit out on warning
-type errorOnWarningHook struct{}
-
-func (errorOnWarningHook) Levels() []log.Level {
-	return []log.Level{log.WarnLevel}
-}
-
-func (errorOnWarningHook) Fire(entry *log.Entry) error {
-	log.Fatalln(entry.Message)
-	return nil
-}
-
 // TODO: comment
 var (
 	GlobalProvider         string
 	GlobalVerbose          bool
 	GlobalSuppressWarnings bool
-	GlobalErrorOnWarning   bool
+	GlobalErrorOnWarning   []string
 	GlobalFiles            []string
 )
 
@@ -67,12 +56,16 @@ var RootCmd = &cobra.Command{
 		formatter.ForceColors = true
 		log.SetFormatter(formatter)
 
-		// Set the appropriate suppress warnings and error on warning flags
+		rules, err := parseErrorOnWarning(GlobalErrorOnWarning)
+		if err != nil {
+			log.Fatal(err)
+		}
+		GlobalErrorOnWarning = rules
+
+		// Set the appropriate suppress warnings flag, the warnings failing with --error-on-warning are
+		// checked once the conversion is done and its report written
 		if GlobalSuppressWarnings {
 			log.SetLevel(log.ErrorLevel)
-		} else if GlobalErrorOnWarning {
-			hook := errorOnWarningHook{}
-			log.AddHook(hook)
 		}
 
 		// Error out of the user has not chosen Kubernetes or OpenShift
@@ -83,6 +76,39 @@ var RootCmd = &cobra.Command{
 	},
 }
 
+// parseErrorOnWarning checks the rule IDs given to --error-on-warning. The boolean values it accepted before
+// taking rule IDs are kept, true failing on any warning and false on none.
+func parseErrorOnWarning(values []string) ([]string, error) {
+	var rules []string
+	for _, value := range values {
+		if value == diagnostics.AllRules || diagnostics.IsRule(value) {
+			rules = append(rules, value)
+			continue
+		}
+		all, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("unknown rule ID %q given to --error-on-warning, the rule IDs are: %s", value, strings.Join(diagnostics.Rules, ", "))
+		}
+		if all {
+			rules = append(rules, diagnostics.AllRules)
+		}
+	}
+	return rules, nil
+}
+
+// checkDiagnostics exits when a diagnostic has been reported by one of the rules given to --error-on-warning,
+// or when any warning has been reported without rule IDs
+func checkDiagnostics(d diagnostics.Diagnostics) {
+	matched := d.WithRules(GlobalErrorOnWarning)
+	if len(matched) == 0 {
+		return
+	}
+	for _, diagnostic := range matched {
+		log.Errorf("[%s] %s", diagnostic.RuleID, diagnostic.Message)
+	}
+	log.Fatalf("%d issue(s) reported by the rules given to --error-on-warning", len(matched))
+}
+
 // Execute executes the root level command.
 // It returns an erorr if any.
 func Execute() error {
@@ -92,7 +118,8 @@ func Execute() error {
 func init() {
 	RootCmd.PersistentFlags().BoolVarP(&GlobalVerbose, "verbose", "v", false, "verbose output")
 	RootCmd.PersistentFlags().BoolVar(&GlobalSuppressWarnings, "suppress-warnings", false, "Suppress all warnings")
-	RootCmd.PersistentFlags().BoolVar(&GlobalErrorOnWarning, "error-on-warning", false, "Treat any warning as an error")
+	RootCmd.PersistentFlags().StringSliceVar(&GlobalErrorOnWarning, "error-on-warning", []string{}, "Treat any warning as an error, or only the ones reported by the given rule IDs")
+	RootCmd.PersistentFlags().Lookup("error-on-warning").NoOptDefVal = diagnostics.AllRules
 	RootCmd.PersistentFlags().StringArrayVarP(&GlobalFiles, "file", "f", []string{}, "Specify an alternative compose file")
 	RootCmd.PersistentFlags().StringVar(&GlobalProvider, "provider", "kubernetes", "Specify a provider. Kubernetes or OpenShift.")
 }
@@ -17,13 +17,26 @@ limitations under the License.
 package app
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"strings"
+	"unicode"
 
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	"os"
 
+	"github.com/kubernetes/kompose/pkg/diagnostics"
 	"github.com/kubernetes/kompose/pkg/kobject"
 	"github.com/kubernetes/kompose/pkg/loader"
 	"github.com/kubernetes/kompose/pkg/transformer"
@@ -53,7 +66,7 @@ const (
 var inputFormat = "compose"
 
 // ValidateFlags validates all command line flags
-func ValidateFlags(args []string, cmd *cobra.Command, opt *kobject.ConvertOptions) {
+func ValidateFlags(args []string, cmd *cobra.Command, opt *kobject.ConvertOptions) error {
 	if opt.OutFile == "-" {
 		opt.ToStdout = true
 		opt.OutFile = ""
@@ -82,79 +95,216 @@ func ValidateFlags(args []string, cmd *cobra.Command, opt *kobject.ConvertOption
 	switch {
 	case provider == ProviderOpenshift:
 		if chart {
-			log.Fatalf("--chart, -c is a Kubernetes only flag")
+			return errors.New("--chart, -c is a Kubernetes only flag")
 		}
 		if daemonSet {
-			log.Fatalf("--daemon-set is a Kubernetes only flag")
+			return errors.New("--daemon-set is a Kubernetes only flag")
 		}
 		if replicationController {
-			log.Fatalf("--replication-controller is a Kubernetes only flag")
+			return errors.New("--replication-controller is a Kubernetes only flag")
 		}
 		if deployment {
-			log.Fatalf("--deployment, -d is a Kubernetes only flag")
+			return errors.New("--deployment, -d is a Kubernetes only flag")
 		}
-		if controller == "daemonset" || controller == "replicationcontroller" || controller == "deployment" {
-			log.Fatalf("--controller= daemonset, replicationcontroller or deployment is a Kubernetes only flag")
+		if controller == "daemonset" || controller == "replicationcontroller" || controller == "deployment" || controller == "statefulset" {
+			return errors.New("--controller= daemonset, replicationcontroller, deployment or statefulset is a Kubernetes only flag")
 		}
 	case provider == ProviderKubernetes:
 		if deploymentConfig {
-			log.Fatalf("--deployment-config is an OpenShift only flag")
+			return errors.New("--deployment-config is an OpenShift only flag")
 		}
 		if buildRepo {
-			log.Fatalf("--build-repo is an Openshift only flag")
+			return errors.New("--build-repo is an Openshift only flag")
 		}
 		if buildBranch {
-			log.Fatalf("--build-branch is an Openshift only flag")
+			return errors.New("--build-branch is an Openshift only flag")
 		}
 		if controller == "deploymentconfig" {
-			log.Fatalf("--controller=deploymentConfig is an OpenShift only flag")
+			return errors.New("--controller=deploymentConfig is an OpenShift only flag")
 		}
 	}
 
 	// Standard checks regardless of provider
 	if len(opt.OutFile) != 0 && opt.ToStdout {
-		log.Fatalf("Error: --out and --stdout can't be set at the same time")
+		return errors.New("Error: --out and --stdout can't be set at the same time")
 	}
 
 	if opt.CreateChart && opt.ToStdout {
-		log.Fatalf("Error: chart cannot be generated when --stdout is specified")
+		return errors.New("Error: chart cannot be generated when --stdout is specified")
 	}
 
 	if opt.Replicas < 0 {
-		log.Fatalf("Error: --replicas cannot be negative")
+		return errors.New("Error: --replicas cannot be negative")
 	}
 
 	if len(args) != 0 {
-		log.Fatal("Unknown Argument(s): ", strings.Join(args, ","))
+		return fmt.Errorf("Unknown Argument(s): %s", strings.Join(args, ","))
 	}
 
 	if opt.GenerateJSON && opt.GenerateYaml {
-		log.Fatalf("YAML and JSON format cannot be provided at the same time")
+		return errors.New("YAML and JSON format cannot be provided at the same time")
 	}
 
 	if opt.Volumes != "persistentVolumeClaim" && opt.Volumes != "emptyDir" && opt.Volumes != "hostPath" && opt.Volumes != "configMap" {
-		log.Fatal("Unknown Volume type: ", opt.Volumes, ", possible values are: persistentVolumeClaim, hostPath, configMap and emptyDir")
+		return fmt.Errorf("Unknown Volume type: %s, possible values are: persistentVolumeClaim, hostPath, configMap and emptyDir", opt.Volumes)
 	}
+	return nil
 }
 
 // ValidateComposeFile validates the compose file provided for conversion
-func ValidateComposeFile(opt *kobject.ConvertOptions) {
-	if len(opt.InputFiles) == 0 {
+func ValidateComposeFile(opt *kobject.ConvertOptions) error {
+	if len(opt.InputFiles) == 0 && opt.InputContent == nil {
 		for _, name := range DefaultComposeFiles {
-			_, err := os.Stat(name)
+			var err error
+			if opt.InputFS != nil {
+				_, err = fs.Stat(opt.InputFS, name)
+			} else {
+				_, err = os.Stat(name)
+			}
 			if err != nil {
 				log.Debugf("'%s' not found: %v", name, err)
 			} else {
 				opt.InputFiles = []string{name}
-				return
+				return nil
 			}
 		}
 
-		log.Fatal("No 'docker-compose' file found")
+		return errors.New("No 'docker-compose' file found")
+	}
+	return nil
+}
+
+// validateNamespace checks the namespace the objects are generated in is a valid namespace name
+func validateNamespace(opt *kobject.ConvertOptions) error {
+	if opt.NetworkIngressNamespace != "" {
+		if errs := validation.IsDNS1123Label(opt.NetworkIngressNamespace); len(errs) > 0 {
+			return fmt.Errorf("Error: invalid ingress namespace %q: %s", opt.NetworkIngressNamespace, strings.Join(errs, ", "))
+		}
+	}
+	if opt.Namespace == "" {
+		if opt.CreateNamespace {
+			return errors.New("Error: --create-namespace requires --namespace")
+		}
+		return nil
+	}
+	if errs := validation.IsDNS1123Label(opt.Namespace); len(errs) > 0 {
+		return fmt.Errorf("Error: invalid namespace %q: %s", opt.Namespace, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// defaultGateway is the name of the Gateway generated with --gateway-class when --gateway isn't given
+const defaultGateway = "kompose"
+
+// validateExposeMode sets the default kind of objects exposing the services for the provider, and
+// checks the parent Gateway of the HTTP routes is given in gateway mode
+func validateExposeMode(opt *kobject.ConvertOptions) error {
+	switch opt.ExposeMode {
+	case "":
+		opt.ExposeMode = kubernetes.ExposeModeIngress
+		if opt.Provider == ProviderOpenshift {
+			opt.ExposeMode = kubernetes.ExposeModeRoute
+		}
+	case kubernetes.ExposeModeIngress, kubernetes.ExposeModeGateway:
+	case kubernetes.ExposeModeRoute:
+		if opt.Provider != ProviderOpenshift {
+			return errors.New("Error: --expose-mode=route is an OpenShift only value")
+		}
+	default:
+		return fmt.Errorf("Unknown expose mode: %s, possible values are: ingress, gateway and route", opt.ExposeMode)
+	}
+
+	if opt.ExposeMode != kubernetes.ExposeModeGateway {
+		if opt.Gateway != "" || opt.GatewayClass != "" {
+			return errors.New("Error: --gateway and --gateway-class require --expose-mode=gateway")
+		}
+		return nil
+	}
+	if opt.GatewayClass == "" {
+		if opt.Gateway == "" {
+			return errors.New("Error: --expose-mode=gateway requires --gateway, the parent Gateway of the routes, or --gateway-class to generate it")
+		}
+		return nil
+	}
+	if opt.Gateway == "" {
+		opt.Gateway = defaultGateway
+	}
+	if errs := validation.IsDNS1123Subdomain(opt.Gateway); len(errs) > 0 {
+		return fmt.Errorf("Error: invalid gateway name %q, the generated Gateway belongs to the namespace of the routes: %s", opt.Gateway, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// validateCertManagerIssuer checks the issuer of --cert-manager-issuer is an Issuer or a ClusterIssuer
+func validateCertManagerIssuer(opt kobject.ConvertOptions) error {
+	if opt.CertManagerIssuer == "" {
+		return nil
+	}
+	kind, name := kubernetes.CertManagerIssuerRef(opt.CertManagerIssuer)
+	if kind != "Issuer" && kind != "ClusterIssuer" {
+		return fmt.Errorf("Error: invalid cert-manager issuer kind %q, possible values are: Issuer and ClusterIssuer", kind)
+	}
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return fmt.Errorf("Error: invalid cert-manager issuer name %q: %s", name, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// validateSecurityProfile checks --security-profile names a Pod Security Standard the pods can be checked against
+func validateSecurityProfile(opt kobject.ConvertOptions) error {
+	switch opt.SecurityProfile {
+	case "", kubernetes.SecurityProfileBaseline, kubernetes.SecurityProfileRestricted:
+		return nil
+	default:
+		return fmt.Errorf("Unknown security profile: %s, possible values are: baseline and restricted", opt.SecurityProfile)
+	}
+}
+
+// validateOCILayout checks the OCI image layout of --oci-layout is a directory the users are resolved from
+func validateOCILayout(opt kobject.ConvertOptions) error {
+	if opt.OCILayout == "" {
+		return nil
 	}
+	if !opt.ResolveUsers {
+		return errors.New("Error: --oci-layout requires --resolve-users")
+	}
+	if _, err := os.Stat(filepath.Join(opt.OCILayout, "index.json")); err != nil {
+		return fmt.Errorf("Error: %s is not an OCI image layout: %v", opt.OCILayout, err)
+	}
+	return nil
+}
+
+// projectNameInvalidChars matches the characters docker compose removes from project names
+var projectNameInvalidChars = regexp.MustCompile("[^a-z0-9_-]")
+
+// resolveProjectName sets the name of the project to the name of the directory of the compose files
+// when asked for with an empty name, like docker compose, and checks it can prefix the object names
+func resolveProjectName(opt *kobject.ConvertOptions) error {
+	if opt.ProjectName == "" && opt.IsProjectNameFlag {
+		dir := "."
+		if len(opt.InputFiles) > 0 && opt.InputFiles[0] != "-" {
+			dir = filepath.Dir(opt.InputFiles[0])
+		}
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return errors.Wrap(err, "unable to find the project directory")
+		}
+		opt.ProjectName = projectNameInvalidChars.ReplaceAllString(strings.ToLower(filepath.Base(abs)), "")
+		if opt.ProjectName == "" {
+			return fmt.Errorf("Error: unable to name the project after the directory %q, use --project-name", abs)
+		}
+	}
+	if opt.ProjectName == "" {
+		return nil
+	}
+	opt.ProjectName = kubernetes.FormatResourceName(opt.ProjectName)
+	if errs := validation.IsDNS1123Label(opt.ProjectName); len(errs) > 0 {
+		return fmt.Errorf("Error: invalid project name %q: %s", opt.ProjectName, strings.Join(errs, ", "))
+	}
+	return nil
 }
 
-func validateControllers(opt *kobject.ConvertOptions) {
+func validateControllers(opt *kobject.ConvertOptions) error {
 	singleOutput := len(opt.OutFile) != 0 || opt.OutFile == "-" || opt.ToStdout
 	if opt.Provider == ProviderKubernetes {
 		// create deployment by default if no controller has been set
@@ -173,7 +323,7 @@ func validateControllers(opt *kobject.ConvertOptions) {
 				count++
 			}
 			if count > 1 {
-				log.Fatalf("Error: only one kind of Kubernetes resource can be generated when --out or --stdout is specified")
+				return errors.New("Error: only one kind of Kubernetes resource can be generated when --out or --stdout is specified")
 			}
 		}
 	} else if opt.Provider == ProviderOpenshift {
@@ -190,28 +340,61 @@ func validateControllers(opt *kobject.ConvertOptions) {
 			// if opt.foo {count++}
 
 			if count > 1 {
-				log.Fatalf("Error: only one kind of OpenShift resource can be generated when --out or --stdout is specified")
+				return errors.New("Error: only one kind of OpenShift resource can be generated when --out or --stdout is specified")
 			}
 		}
 	}
+	return nil
 }
 
-// Convert transforms docker compose or dab file to k8s objects
-func Convert(opt kobject.ConvertOptions) {
-	validateControllers(&opt)
+// Convert transforms docker compose files to Kubernetes or OpenShift objects.
+// It neither exits nor prints: failures are returned as errors, and the issues
+// found by the loader and the transformers are returned as diagnostics.
+func Convert(ctx context.Context, opt kobject.ConvertOptions) ([]runtime.Object, diagnostics.Diagnostics, error) {
+	if opt.Diagnostics == nil {
+		opt.Diagnostics = &diagnostics.Collector{}
+	}
+	objects, err := convert(ctx, opt)
+	return objects, opt.Diagnostics.Diagnostics(), err
+}
 
-	// loader parses input from file into komposeObject.
-	l, err := loader.GetLoader(inputFormat)
-	if err != nil {
-		log.Fatal(err)
+func convert(ctx context.Context, opt kobject.ConvertOptions) ([]runtime.Object, error) {
+	if err := validateControllers(&opt); err != nil {
+		return nil, err
+	}
+	if err := validateNamespace(&opt); err != nil {
+		return nil, err
+	}
+	if err := validateExposeMode(&opt); err != nil {
+		return nil, err
+	}
+	if err := validateCertManagerIssuer(opt); err != nil {
+		return nil, err
+	}
+	if err := validateSecurityProfile(opt); err != nil {
+		return nil, err
+	}
+	if err := validateOCILayout(opt); err != nil {
+		return nil, err
+	}
+	if err := ValidateComposeFile(&opt); err != nil {
+		return nil, err
+	}
+	if err := resolveProjectName(&opt); err != nil {
+		return nil, err
 	}
 
-	komposeObject := kobject.KomposeObject{
-		ServiceConfigs: make(map[string]kobject.ServiceConfig),
+	dir, err := prepareInput(&opt)
+	if err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		defer os.RemoveAll(dir)
 	}
-	komposeObject, err = l.LoadFile(opt.InputFiles)
+
+	komposeObject, err := load(ctx, opt)
 	if err != nil {
-		log.Fatalf(err.Error())
+		return nil, inputError(err, dir)
 	}
 
 	// Get a transformer that maps komposeObject to provider's primitives
@@ -219,16 +402,227 @@ func Convert(opt kobject.ConvertOptions) {
 
 	// Do the transformation
 	objects, err := t.Transform(komposeObject, opt)
+	if err != nil {
+		return nil, inputError(err, dir)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// Config returns the compose model resolved from the input files, as received by the transformers
+func Config(ctx context.Context, opt kobject.ConvertOptions) (kobject.KomposeObject, diagnostics.Diagnostics, error) {
+	if opt.Diagnostics == nil {
+		opt.Diagnostics = &diagnostics.Collector{}
+	}
+	komposeObject, err := config(ctx, opt)
+	return komposeObject, opt.Diagnostics.Diagnostics(), err
+}
 
+func config(ctx context.Context, opt kobject.ConvertOptions) (kobject.KomposeObject, error) {
+	if err := ValidateComposeFile(&opt); err != nil {
+		return kobject.KomposeObject{}, err
+	}
+	dir, err := prepareInput(&opt)
+	if err != nil {
+		return kobject.KomposeObject{}, err
+	}
+	if dir != "" {
+		defer os.RemoveAll(dir)
+	}
+
+	komposeObject, err := load(ctx, opt)
+	if err != nil {
+		return kobject.KomposeObject{}, inputError(err, dir)
+	}
+	return komposeObject, nil
+}
+
+// load parses the input files into a komposeObject
+func load(ctx context.Context, opt kobject.ConvertOptions) (kobject.KomposeObject, error) {
+	if err := ctx.Err(); err != nil {
+		return kobject.KomposeObject{}, err
+	}
+	l, err := loader.GetLoader(inputFormat)
+	if err != nil {
+		return kobject.KomposeObject{}, err
+	}
+	komposeObject, err := l.LoadFile(opt.InputFiles, opt.Profiles, opt.Diagnostics)
 	if err != nil {
-		log.Fatalf(err.Error())
+		return kobject.KomposeObject{}, err
+	}
+	return komposeObject, ctx.Err()
+}
+
+// prepareInput writes the input given as content or as a file system to a temporary directory,
+// and points the input files of opt to it, since the loader reads the compose files, and the
+// files they reference, from the local file system.
+// It returns the temporary directory, empty when the input already is on the local file system.
+func prepareInput(opt *kobject.ConvertOptions) (string, error) {
+	if opt.InputContent == nil && opt.InputFS == nil {
+		return "", nil
 	}
 
-	// Print output
-	err = kubernetes.PrintList(objects, opt)
+	dir, err := ioutil.TempDir("", "kompose-")
 	if err != nil {
-		log.Fatalf(err.Error())
+		return "", errors.Wrap(err, "unable to create a temporary directory for the input")
+	}
+
+	if opt.InputContent != nil {
+		file := filepath.Join(dir, DefaultComposeFiles[0])
+		if err := ioutil.WriteFile(file, opt.InputContent, 0600); err != nil {
+			os.RemoveAll(dir)
+			return "", errors.Wrap(err, "unable to write the compose file")
+		}
+		opt.InputFiles = []string{file}
+	} else {
+		if err := copyFS(opt.InputFS, dir); err != nil {
+			os.RemoveAll(dir)
+			return "", errors.Wrap(err, "unable to read the input file system")
+		}
+		files := make([]string, len(opt.InputFiles))
+		for i, file := range opt.InputFiles {
+			files[i] = filepath.Join(dir, filepath.FromSlash(file))
+		}
+		opt.InputFiles = files
+	}
+	opt.InputContent = nil
+	opt.InputFS = nil
+	return dir, nil
+}
+
+// copyFS copies the regular files and directories of fsys into dir
+func copyFS(fsys fs.FS, dir string) error {
+	return fs.WalkDir(fsys, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(path))
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0700)
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, data, 0600)
+	})
+}
+
+// inputError removes the temporary input directory from the paths of an error message
+func inputError(err error, dir string) error {
+	if dir == "" || !strings.Contains(err.Error(), dir) {
+		return err
+	}
+	return errors.New(strings.ReplaceAll(err.Error(), dir+string(filepath.Separator), ""))
+}
+
+// PrintKomposeObject prints a komposeObject in YAML, or in JSON if asked, to stdout or to the output file
+func PrintKomposeObject(komposeObject kobject.KomposeObject, opt kobject.ConvertOptions) error {
+	var data []byte
+	var err error
+	model := configModel(reflect.ValueOf(komposeObject))
+	if opt.GenerateJSON {
+		data, err = json.MarshalIndent(model, "", "  ")
+	} else {
+		data, err = kubernetes.MarshalWithIndent(model, opt.YAMLIndent)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the compose model")
+	}
+
+	f, err := transformer.CreateOutFile(opt.OutFile)
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		_, err = fmt.Fprintf(os.Stdout, "%s\n", data)
+		return err
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "%s\n", data); err != nil {
+		return errors.Wrapf(err, "failed to write %s", opt.OutFile)
+	}
+	log.Printf("Compose model written to %q", opt.OutFile)
+	return nil
+}
+
+// configModel returns the compose model printed by the config command: the fields are named in snake_case, or
+// after their JSON tag, and the empty ones are left out
+func configModel(v reflect.Value) interface{} {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if _, ok := v.Interface().(json.Marshaler); ok {
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		model := map[string]interface{}{}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" || v.Field(i).IsZero() {
+				continue
+			}
+			name := snakeCase(field.Name)
+			if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			}
+			if value := configModel(v.Field(i)); value != nil {
+				model[name] = value
+			}
+		}
+		if len(model) == 0 {
+			return nil
+		}
+		return model
+	case reflect.Map:
+		if v.Len() == 0 {
+			return nil
+		}
+		model := map[string]interface{}{}
+		for _, key := range v.MapKeys() {
+			model[fmt.Sprint(key.Interface())] = configModel(v.MapIndex(key))
+		}
+		return model
+	case reflect.Slice, reflect.Array:
+		if v.Len() == 0 {
+			return nil
+		}
+		model := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			model[i] = configModel(v.Index(i))
+		}
+		return model
+	default:
+		return v.Interface()
+	}
+}
+
+// snakeCase turns a field name like HostIP or CPUShares into host_ip or cpu_shares
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (!unicode.IsUpper(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
 	}
+	return b.String()
 }
 
 // Convenience method to return the appropriate Transformer based on
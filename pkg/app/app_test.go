@@ -0,0 +1,345 @@
+/*
+Copyright 2017 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/kubernetes/kompose/pkg/kobject"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testComposeFile = `
+version: "3"
+services:
+  web:
+    image: nginx
+    restart: unless-stopped
+    ports:
+      - "80:80"
+`
+
+func TestConvertContent(t *testing.T) {
+	opt := kobject.ConvertOptions{
+		Provider:     ProviderKubernetes,
+		Volumes:      "persistentVolumeClaim",
+		InputContent: []byte(testComposeFile),
+	}
+
+	objects, diagnostics, err := Convert(context.Background(), opt)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// a Service and a Deployment
+	if len(objects) != 2 {
+		t.Errorf("expected 2 objects, got %d", len(objects))
+	}
+	if len(diagnostics.Warnings()) != 1 || !strings.Contains(diagnostics[0].Message, "unless-stopped") {
+		t.Errorf("expected the unless-stopped warning, got %v", diagnostics)
+	}
+}
+
+func TestConvertFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app/docker-compose.yml": &fstest.MapFile{Data: []byte(testComposeFile)},
+	}
+
+	opt := kobject.ConvertOptions{
+		Provider:   ProviderKubernetes,
+		Volumes:    "persistentVolumeClaim",
+		InputFS:    fsys,
+		InputFiles: []string{"app/docker-compose.yml"},
+	}
+	if _, _, err := Convert(context.Background(), opt); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	opt.InputFiles = []string{"app/missing.yml"}
+	_, _, err := Convert(context.Background(), opt)
+	if err == nil {
+		t.Fatal("expected an error for a missing compose file")
+	}
+	if !strings.Contains(err.Error(), "app/missing.yml") || strings.Contains(err.Error(), "kompose-") {
+		t.Errorf("expected the error to name the file relative to the input file system, got %v", err)
+	}
+
+	// the default compose file is looked up in the input file system
+	opt.InputFS = fstest.MapFS{"docker-compose.yml": &fstest.MapFile{Data: []byte(testComposeFile)}}
+	opt.InputFiles = nil
+	if _, _, err := Convert(context.Background(), opt); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestConvertCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	opt := kobject.ConvertOptions{
+		Provider:     ProviderKubernetes,
+		Volumes:      "persistentVolumeClaim",
+		InputContent: []byte(testComposeFile),
+	}
+	if _, _, err := Convert(ctx, opt); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestConvertNamespace(t *testing.T) {
+	testCases := map[string]struct {
+		namespace       string
+		createNamespace bool
+		err             string
+	}{
+		"valid namespace":                {"shop", true, ""},
+		"invalid namespace":              {"Shop_1", false, "invalid namespace"},
+		"namespace created without name": {"", true, "requires --namespace"},
+	}
+
+	for name, test := range testCases {
+		opt := kobject.ConvertOptions{
+			Provider:        ProviderKubernetes,
+			Volumes:         "persistentVolumeClaim",
+			InputContent:    []byte(testComposeFile),
+			Namespace:       test.namespace,
+			CreateNamespace: test.createNamespace,
+		}
+		objects, _, err := Convert(context.Background(), opt)
+		if test.err == "" {
+			if err != nil || len(objects) != 3 {
+				t.Errorf("%s: expected the namespace and 2 objects, got %d objects and error %v", name, len(objects), err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, test.err, err)
+		}
+	}
+}
+
+func TestConvertProjectName(t *testing.T) {
+	fsys := fstest.MapFS{
+		"My_App/docker-compose.yml": &fstest.MapFile{Data: []byte(testComposeFile)},
+	}
+
+	testCases := map[string]struct {
+		projectName string
+		flag        bool
+		expected    string
+	}{
+		"no project name":                 {"", false, "web"},
+		"project name":                    {"shop", true, "shop-web"},
+		"project name of the directory":   {"", true, "my-app-web"},
+		"project name with invalid chars": {"Shop_1", true, "shop-1-web"},
+	}
+
+	for name, test := range testCases {
+		opt := kobject.ConvertOptions{
+			Provider:          ProviderKubernetes,
+			Volumes:           "persistentVolumeClaim",
+			InputFS:           fsys,
+			InputFiles:        []string{"My_App/docker-compose.yml"},
+			ProjectName:       test.projectName,
+			IsProjectNameFlag: test.flag,
+		}
+		objects, _, err := Convert(context.Background(), opt)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		for _, obj := range objects {
+			if object, ok := obj.(metav1.Object); ok && object.GetName() != test.expected {
+				t.Errorf("%s: expected objects named %s, got %s", name, test.expected, object.GetName())
+			}
+		}
+	}
+}
+
+func TestConvertExposeMode(t *testing.T) {
+	const exposedComposeFile = testComposeFile + `
+    labels:
+      kompose.service.expose: shop.example.com
+`
+
+	testCases := map[string]struct {
+		exposeMode   string
+		gateway      string
+		gatewayClass string
+		kinds        []string
+		err          string
+	}{
+		"ingress by default":       {"", "", "", []string{"Service", "Deployment", "Ingress"}, ""},
+		"gateway given":            {"gateway", "infra/shared", "", []string{"Service", "Deployment", "HTTPRoute"}, ""},
+		"gateway generated":        {"gateway", "", "istio", []string{"Service", "Deployment", "HTTPRoute", "Gateway"}, ""},
+		"gateway missing":          {"gateway", "", "", nil, "requires --gateway"},
+		"gateway without its mode": {"ingress", "shared", "", nil, "require --expose-mode=gateway"},
+		"route on kubernetes":      {"route", "", "", nil, "OpenShift only"},
+	}
+
+	for name, test := range testCases {
+		opt := kobject.ConvertOptions{
+			Provider:     ProviderKubernetes,
+			Volumes:      "persistentVolumeClaim",
+			InputContent: []byte(exposedComposeFile),
+			ExposeMode:   test.exposeMode,
+			Gateway:      test.gateway,
+			GatewayClass: test.gatewayClass,
+		}
+		objects, _, err := Convert(context.Background(), opt)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected an error containing %q, got %v", name, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		var kinds []string
+		for _, obj := range objects {
+			kinds = append(kinds, obj.GetObjectKind().GroupVersionKind().Kind)
+		}
+		if strings.Join(kinds, ",") != strings.Join(test.kinds, ",") {
+			t.Errorf("%s: expected %v, got %v", name, test.kinds, kinds)
+		}
+	}
+}
+
+func TestConvertSecurityProfile(t *testing.T) {
+	const privilegedComposeFile = testComposeFile + `
+    privileged: true
+    cap_add: [CHOWN]
+`
+
+	testCases := map[string]struct {
+		securityProfile string
+		violations      int
+		err             string
+	}{
+		"no profile":         {"", 0, ""},
+		"baseline profile":   {"baseline", 1, ""},
+		"restricted profile": {"restricted", 2, ""},
+		"unknown profile":    {"strict", 0, "Unknown security profile"},
+	}
+
+	for name, test := range testCases {
+		opt := kobject.ConvertOptions{
+			Provider:        ProviderKubernetes,
+			Volumes:         "persistentVolumeClaim",
+			InputContent:    []byte(privilegedComposeFile),
+			SecurityProfile: test.securityProfile,
+		}
+		_, diags, err := Convert(context.Background(), opt)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected an error containing %q, got %v", name, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if violations := diags.WithRules([]string{"security-profile"}); len(violations) != test.violations {
+			t.Errorf("%s: expected %d violations, got %v", name, test.violations, violations)
+		}
+	}
+}
+
+func TestConvertOCILayout(t *testing.T) {
+	testCases := map[string]struct {
+		resolveUsers bool
+		ociLayout    string
+		err          string
+	}{
+		"no layout":                {false, "", ""},
+		"layout without resolving": {false, "layout", "--oci-layout requires --resolve-users"},
+		"missing layout":           {true, "missing", "is not an OCI image layout"},
+	}
+
+	for name, test := range testCases {
+		opt := kobject.ConvertOptions{
+			Provider:     ProviderKubernetes,
+			Volumes:      "persistentVolumeClaim",
+			InputContent: []byte(testComposeFile),
+			ResolveUsers: test.resolveUsers,
+			OCILayout:    test.ociLayout,
+		}
+		_, _, err := Convert(context.Background(), opt)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, test.err, err)
+		}
+	}
+}
+
+func TestPrintKomposeObject(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kompose-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opt := kobject.ConvertOptions{
+		Provider:     ProviderKubernetes,
+		InputContent: []byte(testComposeFile),
+		GenerateJSON: true,
+		OutFile:      filepath.Join(dir, "model.json"),
+	}
+	komposeObject, _, err := Config(context.Background(), opt)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := PrintKomposeObject(komposeObject, opt); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(opt.OutFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var model struct {
+		ServiceConfigs map[string]map[string]interface{} `json:"service_configs"`
+	}
+	if err := json.Unmarshal(data, &model); err != nil {
+		t.Fatalf("Unable to parse the compose model: %v", err)
+	}
+	web, ok := model.ServiceConfigs["web"]
+	if !ok {
+		t.Fatalf("Expected service web in the compose model, got %s", data)
+	}
+	if web["image"] != "nginx" || web["restart"] != "always" {
+		t.Errorf("Expected the image and the restart policy of web, got %v", web)
+	}
+	ports, ok := web["port"].([]interface{})
+	if !ok || len(ports) != 1 || ports[0].(map[string]interface{})["container_port"] != float64(80) {
+		t.Errorf("Expected the container port 80 in snake_case, got %v", web["port"])
+	}
+	for _, field := range []string{"Image", "cpu_shares", "privileged", "volumes_from", "health_checks"} {
+		if _, ok := web[field]; ok {
+			t.Errorf("Expected no %s in the compose model, got %v", field, web)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2017 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnostics
+
+import (
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Severity is the severity of a diagnostic
+type Severity string
+
+const (
+	// SeverityWarning is the severity of an issue that changes the result of the conversion
+	SeverityWarning Severity = "warning"
+	// SeverityInfo is the severity of a change worth knowing about, which is not an issue
+	SeverityInfo Severity = "info"
+)
+
+// Rule IDs of the diagnostics reported by the loader and the transformers
+const (
+	// RuleUnsupportedKey reports a compose key ignored by the loader or the provider
+	RuleUnsupportedKey = "unsupported-key"
+	// RuleUnsupportedValue reports a compose value which can't be converted as is
+	RuleUnsupportedValue = "unsupported-value"
+	// RuleInvalidValue reports a compose value which can't be parsed, and is ignored
+	RuleInvalidValue = "invalid-value"
+	// RuleVolumeHostPath reports a volume mounted from the host, converted without its host path
+	RuleVolumeHostPath = "volume-host-path"
+	// RuleRenamedService reports a service renamed to be a valid Kubernetes name
+	RuleRenamedService = "renamed-service"
+	// RuleRenamedNetwork reports a network renamed to be a valid Kubernetes name
+	RuleRenamedNetwork = "renamed-network"
+	// RuleRestartPolicy reports a restart policy converted to another one
+	RuleRestartPolicy = "restart-policy"
+	// RuleController reports a controller different from the requested one
+	RuleController = "controller"
+	// RuleServiceSkipped reports a Kubernetes service which isn't created
+	RuleServiceSkipped = "service-skipped"
+	// RuleSecurityProfile reports a compose setting violating the Pod Security Standard of --security-profile
+	RuleSecurityProfile = "security-profile"
+)
+
+// AllRules stands for every rule in the rules given to WithRules
+const AllRules = "all"
+
+// Rules lists the rule IDs of the diagnostics
+var Rules = []string{
+	RuleUnsupportedKey,
+	RuleUnsupportedValue,
+	RuleInvalidValue,
+	RuleVolumeHostPath,
+	RuleRenamedService,
+	RuleRenamedNetwork,
+	RuleRestartPolicy,
+	RuleController,
+	RuleServiceSkipped,
+	RuleSecurityProfile,
+}
+
+// IsRule returns whether an ID is the one of a rule
+func IsRule(id string) bool {
+	for _, rule := range Rules {
+		if rule == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Diagnostic is an issue found while converting, which is not an error
+type Diagnostic struct {
+	// RuleID identifies the kind of issue
+	RuleID   string   `json:"ruleId"`
+	Severity Severity `json:"severity"`
+	// Service is the compose service the issue was found in, if any
+	Service string `json:"service,omitempty"`
+	// Path is the compose key path of the issue, like services.web.restart
+	Path string `json:"path,omitempty"`
+	// File and Line locate the key in the compose files, when known
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+// Diagnostics is the list of the issues found during a conversion
+type Diagnostics []Diagnostic
+
+// Warnings returns the diagnostics with the warning severity
+func (d Diagnostics) Warnings() Diagnostics {
+	var warnings Diagnostics
+	for _, diagnostic := range d {
+		if diagnostic.Severity == SeverityWarning {
+			warnings = append(warnings, diagnostic)
+		}
+	}
+	return warnings
+}
+
+// WithRules returns the diagnostics reported by one of the given rules. AllRules matches the warnings of
+// every rule, not the diagnostics only worth knowing about.
+func (d Diagnostics) WithRules(rules []string) Diagnostics {
+	var matched Diagnostics
+	for _, diagnostic := range d {
+		for _, rule := range rules {
+			if diagnostic.RuleID == rule || (rule == AllRules && diagnostic.Severity == SeverityWarning) {
+				matched = append(matched, diagnostic)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// ServicePath returns the compose key path of a key of a service
+func ServicePath(service string, key string) string {
+	if key == "" {
+		return "services." + service
+	}
+	return "services." + service + "." + key
+}
+
+// Locator returns the compose file and line a key path was read from
+type Locator func(path string) (file string, line int, ok bool)
+
+// Collector gathers the diagnostics reported during a conversion.
+// Every reported diagnostic is also logged, so a nil Collector only logs them.
+type Collector struct {
+	mu          sync.Mutex
+	diagnostics Diagnostics
+	locator     Locator
+}
+
+// SetLocator sets how the diagnostics reported from now on are located in the compose files
+func (c *Collector) SetLocator(locator Locator) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.locator = locator
+}
+
+// Report records a diagnostic and logs its message
+func (c *Collector) Report(d Diagnostic) {
+	if d.Severity == SeverityInfo {
+		log.Info(d.Message)
+	} else {
+		log.Warn(d.Message)
+	}
+
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d.File == "" && d.Path != "" && c.locator != nil {
+		if file, line, ok := c.locator(d.Path); ok {
+			d.File, d.Line = file, line
+		}
+	}
+	c.diagnostics = append(c.diagnostics, d)
+}
+
+// Warnf reports a warning for a compose key path of a service
+func (c *Collector) Warnf(rule string, service string, path string, format string, args ...interface{}) {
+	c.Report(Diagnostic{
+		RuleID:   rule,
+		Severity: SeverityWarning,
+		Service:  service,
+		Path:     path,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Infof reports an information for a compose key path of a service
+func (c *Collector) Infof(rule string, service string, path string, format string, args ...interface{}) {
+	c.Report(Diagnostic{
+		RuleID:   rule,
+		Severity: SeverityInfo,
+		Service:  service,
+		Path:     path,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Diagnostics returns the diagnostics reported so far
+func (c *Collector) Diagnostics() Diagnostics {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append(Diagnostics(nil), c.diagnostics...)
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2017 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnostics
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func testCollector() *Collector {
+	c := &Collector{}
+	c.Warnf(RuleUnsupportedKey, "web", ServicePath("web", "dns"), "Unsupported %s key - ignoring for service %s", "dns", "web")
+	c.Infof(RuleRenamedService, "my_db", ServicePath("my_db", ""), "Service name in docker-compose has been changed from %q to %q", "my_db", "my-db")
+	c.Warnf(RuleVolumeHostPath, "web", ServicePath("web", "volumes[0]"), "Volume mount on the host %q isn't supported - ignoring path on the host", "/data")
+	return c
+}
+
+func TestCollector(t *testing.T) {
+	d := testCollector().Diagnostics()
+	if len(d) != 3 {
+		t.Fatalf("expected 3 diagnostics, got %d", len(d))
+	}
+	if d[1].Path != "services.my_db" || d[2].Path != "services.web.volumes[0]" {
+		t.Errorf("unexpected paths %q and %q", d[1].Path, d[2].Path)
+	}
+	if len(d.Warnings()) != 2 {
+		t.Errorf("expected 2 warnings, got %d", len(d.Warnings()))
+	}
+
+	matched := d.WithRules([]string{RuleVolumeHostPath, RuleRenamedService})
+	if len(matched) != 2 || matched[0].RuleID != RuleRenamedService || matched[1].RuleID != RuleVolumeHostPath {
+		t.Errorf("unexpected diagnostics matching the rules: %v", matched)
+	}
+	if matched := d.WithRules([]string{AllRules}); len(matched) != 2 || matched[0].RuleID != RuleUnsupportedKey || matched[1].RuleID != RuleVolumeHostPath {
+		t.Errorf("expected all the warnings to match, got %v", matched)
+	}
+
+	// a nil collector only logs
+	var c *Collector
+	c.Warnf(RuleUnsupportedKey, "web", "", "ignored")
+	if c.Diagnostics() != nil {
+		t.Errorf("expected no diagnostics from a nil collector")
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	d := testCollector().Diagnostics()
+
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, ReportJSON, d); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded Diagnostics
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON report: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, d) {
+		t.Errorf("expected %v, got %v", d, decoded)
+	}
+
+	buf.Reset()
+	if err := WriteReport(&buf, ReportSARIF, d); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var sarif sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &sarif); err != nil {
+		t.Fatalf("invalid SARIF report: %v", err)
+	}
+	run := sarif.Runs[0]
+	if len(run.Tool.Driver.Rules) != 3 || len(run.Results) != 3 {
+		t.Fatalf("expected 3 rules and 3 results, got %d and %d", len(run.Tool.Driver.Rules), len(run.Results))
+	}
+	if run.Results[1].Level != "note" || run.Results[2].RuleIndex != 2 {
+		t.Errorf("unexpected results %v", run.Results)
+	}
+	if name := run.Results[2].Locations[0].LogicalLocations[0].FullyQualifiedName; name != "services.web.volumes[0]" {
+		t.Errorf("unexpected location %q", name)
+	}
+
+	if err := WriteReport(&buf, "xml", d); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
+
+func TestIsRule(t *testing.T) {
+	for _, rule := range []string{RuleUnsupportedKey, RuleSecurityProfile} {
+		if !IsRule(rule) {
+			t.Errorf("Expected %s to be a rule", rule)
+		}
+	}
+	for _, id := range []string{"unsuported-key", "true", ""} {
+		if IsRule(id) {
+			t.Errorf("Expected %q not to be a rule", id)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2017 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnostics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/kubernetes/kompose/pkg/version"
+)
+
+const (
+	// ReportJSON is the format of a report listing the diagnostics in JSON
+	ReportJSON = "json"
+	// ReportSARIF is the format of a report following the Static Analysis Results Interchange Format 2.1.0
+	ReportSARIF = "sarif"
+)
+
+// WriteReport writes the diagnostics to w in the given report format
+func WriteReport(w io.Writer, format string, d Diagnostics) error {
+	var report interface{}
+	switch format {
+	case ReportJSON:
+		if d == nil {
+			d = Diagnostics{}
+		}
+		report = d
+	case ReportSARIF:
+		report = newSarifLog(d)
+	default:
+		return fmt.Errorf("unknown report format %q, supported formats are %q and %q", format, ReportJSON, ReportSARIF)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// The SARIF types below only hold the properties kompose fills in,
+// see https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+}
+
+// newSarifLog returns a SARIF log with a single run holding the diagnostics
+func newSarifLog(d Diagnostics) sarifLog {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "kompose",
+			Version:        version.VERSION,
+			InformationURI: "https://kompose.io",
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+
+	ruleIndexes := map[string]int{}
+	for _, diagnostic := range d {
+		index, ok := ruleIndexes[diagnostic.RuleID]
+		if !ok {
+			index = len(run.Tool.Driver.Rules)
+			ruleIndexes[diagnostic.RuleID] = index
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: diagnostic.RuleID})
+		}
+
+		level := "warning"
+		if diagnostic.Severity == SeverityInfo {
+			level = "note"
+		}
+
+		result := sarifResult{
+			RuleID:    diagnostic.RuleID,
+			RuleIndex: index,
+			Level:     level,
+			Message:   sarifMessage{Text: diagnostic.Message},
+		}
+		if diagnostic.Path != "" || diagnostic.File != "" {
+			location := sarifLocation{}
+			if diagnostic.File != "" {
+				location.PhysicalLocation = &sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(diagnostic.File)},
+				}
+				if diagnostic.Line > 0 {
+					location.PhysicalLocation.Region = &sarifRegion{StartLine: diagnostic.Line}
+				}
+			}
+			if diagnostic.Path != "" {
+				location.LogicalLocations = []sarifLogicalLocation{{FullyQualifiedName: diagnostic.Path}}
+			}
+			result.Locations = []sarifLocation{location}
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	return sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}
+}
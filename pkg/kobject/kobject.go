@@ -17,15 +17,20 @@ limitations under the License.
 package kobject
 
 import (
+	"fmt"
+	"io/fs"
 	"path/filepath"
+	"strings"
 	"time"
 
 	dockerCliTypes "github.com/docker/cli/cli/compose/types"
 	"github.com/docker/libcompose/yaml"
+	"github.com/kubernetes/kompose/pkg/diagnostics"
 	deployapi "github.com/openshift/api/apps/v1"
 	"github.com/pkg/errors"
 	"github.com/spf13/cast"
 	v1 "k8s.io/api/apps/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
@@ -38,6 +43,12 @@ type KomposeObject struct {
 	LoadedFrom string
 
 	Secrets map[string]dockerCliTypes.SecretConfig
+
+	// Networks holds the networks of the services, by name
+	Networks map[string]dockerCliTypes.NetworkConfig
+
+	// Sources holds the location of every key of the compose files
+	Sources SourceMap `json:"-"`
 }
 
 // ConvertOptions holds all options that controls transformation process
@@ -62,6 +73,7 @@ type ConvertOptions struct {
 	InsecureRepository          bool
 	Replicas                    int
 	InputFiles                  []string
+	Profiles                    []string
 	OutFile                     string
 	Provider                    string
 	Namespace                   string
@@ -73,11 +85,52 @@ type ConvertOptions struct {
 	IsDeploymentConfigFlag      bool
 	IsNamespaceFlag             bool
 
+	// CreateNamespace emits the Namespace object, before the objects it holds
+	CreateNamespace bool
+	// ProjectName, when set, prefixes the names of the objects
+	ProjectName string
+	// IsProjectNameFlag tells an empty ProjectName stands for the name of the directory of the compose files
+	IsProjectNameFlag bool
+	// ExposeMode is the kind of object exposing the services: ingress, gateway or route
+	ExposeMode string
+	// Gateway is the parent Gateway of the HTTP routes, as name or namespace/name
+	Gateway string
+	// GatewayClass, when set, generates the parent Gateway with this class
+	GatewayClass string
+	// CertManagerIssuer, when set, issues the TLS secrets of the exposed services with cert-manager,
+	// as Issuer name or ClusterIssuer/name
+	CertManagerIssuer string
+	// NetworkIngressNamespace, when set, restricts the published ports to the pods of this namespace,
+	// the one of the ingress controller
+	NetworkIngressNamespace string
+	// NetworkDefaultDeny denies the traffic the network policies don't allow, egress included
+	NetworkDefaultDeny bool
+	// SecurityProfile, baseline or restricted, is the Pod Security Standard the pods are checked against,
+	// their security contexts being hardened for the restricted one
+	SecurityProfile string
+	// ResolveUsers resolves the named users and groups of the services to their ids, from the images
+	ResolveUsers bool
+	// OCILayout, when set, is the OCI image layout directory the users are resolved from, instead of the
+	// local docker daemon
+	OCILayout string
+
 	Server string
 
+	// InputFS, when set, is the file system InputFiles are read from, instead of the local one
+	InputFS fs.FS
+	// InputContent, when set, is the content of the compose file to convert, instead of InputFiles
+	InputContent []byte
+
+	// Diagnostics collects the issues found by the transformers, they are only logged when nil
+	Diagnostics *diagnostics.Collector
+
 	YAMLIndent int
 
 	WithKomposeAnnotation bool
+	// Command is the command line recorded in the kompose.cmd annotation, not recorded when empty
+	Command string
+	// WithSourceAnnotation records on every object the compose key it was generated from
+	WithSourceAnnotation bool
 
 	MultipleContainerMode bool
 	ServiceGroupMode      string
@@ -119,6 +172,7 @@ type ServiceConfig struct {
 	Expose            []string            `compose:"expose"`
 	ImagePullPolicy   string              `compose:"kompose.image-pull-policy"`
 	Pid               string              `compose:"pid"`
+	Ipc               string              `compose:"ipc"`
 	Privileged        bool                `compose:"privileged"`
 	Restart           string              `compose:"restart"`
 	User              string              `compose:"user"`
@@ -129,7 +183,7 @@ type ServiceConfig struct {
 	Build             string              `compose:"build"`
 	BuildArgs         map[string]*string  `compose:"build-args"`
 	ExposeService     string              `compose:"kompose.service.expose"`
-	ExposeServicePath string              `compose:"kompose.service.expose.path"`
+	ExposeServicePath []ExposePath        `compose:"kompose.service.expose.path"`
 	BuildLabels       map[string]string   `compose:"build-labels"`
 	ExposeServiceTLS  string              `compose:"kompose.service.expose.tls-secret"`
 	ImagePullSecret   string              `compose:"kompose.image-pull-secret"`
@@ -137,6 +191,7 @@ type ServiceConfig struct {
 	Tty               bool                `compose:"tty"`
 	MemLimit          yaml.MemStringorInt `compose:"mem_limit"`
 	MemReservation    yaml.MemStringorInt `compose:""`
+	ShmSize           yaml.MemStringorInt `compose:"shm_size"`
 	DeployMode        string              `compose:""`
 	// DeployLabels mapping to kubernetes labels
 	DeployLabels       map[string]string           `compose:""`
@@ -144,6 +199,8 @@ type ServiceConfig struct {
 	TmpFs              []string                    `compose:"tmpfs"`
 	Dockerfile         string                      `compose:"dockerfile"`
 	Replicas           int                         `compose:"replicas"`
+	Profiles           []string                    `compose:"profiles"`
+	DependsOn          []string                    `compose:"depends_on"`
 	GroupAdd           []int64                     `compose:"group_add"`
 	Volumes            []Volumes                   `compose:""`
 	Secrets            []dockerCliTypes.ServiceSecretConfig
@@ -154,8 +211,64 @@ type ServiceConfig struct {
 	//This is for SHORT SYNTAX link(https://docs.docker.com/compose/compose-file/#configs)
 	ConfigsMetaData map[string]dockerCliTypes.ConfigObjConfig `compose:""`
 
-	WithKomposeAnnotation bool `compose:""`
+	// DeployRestartPolicy holds the attempts and the delay of deploy.restart_policy, its condition sets Restart
+	DeployRestartPolicy dockerCliTypes.RestartPolicy `compose:""`
+	// CronJobSchedule converts the service to a cron job run on this schedule
+	CronJobSchedule                   string `compose:"kompose.cronjob.schedule"`
+	CronJobConcurrencyPolicy          string `compose:"kompose.cronjob.concurrency_policy"`
+	CronJobSuccessfulJobsHistoryLimit *int32 `compose:"kompose.cronjob.successful_jobs_history_limit"`
+	CronJobFailedJobsHistoryLimit     *int32 `compose:"kompose.cronjob.failed_jobs_history_limit"`
+	// HPAMaxReplicas adds a horizontal pod autoscaler scaling the service up to this number of replicas
+	HPAMaxReplicas int32  `compose:"kompose.hpa.replicas.max"`
+	HPAMinReplicas *int32 `compose:"kompose.hpa.replicas.min"`
+	// HPACPU and HPAMemory are the target average utilization of the requests, in percent
+	HPACPU    int32 `compose:"kompose.hpa.cpu"`
+	HPAMemory int32 `compose:"kompose.hpa.memory"`
+	// PDBMinAvailable and PDBMaxUnavailable set the pod disruption budget of the service, as a number or a percentage
+	PDBMinAvailable   string `compose:"kompose.pdb.min-available"`
+	PDBMaxUnavailable string `compose:"kompose.pdb.max-unavailable"`
+	// ServiceAccountCreate generates the service account of the pods
+	ServiceAccountCreate bool `compose:"kompose.serviceaccount.create"`
+	// RBACRules and RBACPolicyFile define the role bound to the service account, the file holding a Role or a ClusterRole
+	RBACRules      []rbacv1.PolicyRule `compose:"kompose.rbac.rules"`
+	RBACPolicyFile string              `compose:"kompose.rbac.policy-file"`
+	// ExposeServicePort is the port of the service the exposed paths route to, the first one when 0
+	ExposeServicePort int32 `compose:"kompose.service.expose.port"`
+	// ExposeIngressClassName is the class of the ingress exposing the service
+	ExposeIngressClassName string `compose:"kompose.service.expose.ingress-class-name"`
+	// ExposeAnnotations are the annotations of the object exposing the service
+	ExposeAnnotations map[string]string `compose:"kompose.service.expose.annotation"`
+	// ExposeTLSCert and ExposeTLSKey are the PEM files of the TLS secret of the exposed service
+	ExposeTLSCert string `compose:"kompose.service.expose.tls-cert"`
+	ExposeTLSKey  string `compose:"kompose.service.expose.tls-key"`
+	// NetworkMode is the network of the pods: host, none, or the one of another service as service:<name>
+	NetworkMode string `compose:"network_mode"`
+	// ExtraHosts are the host:ip entries added to the hosts file of the pods
+	ExtraHosts []string `compose:"extra_hosts"`
+	// DNS, DNSSearch and DNSOpts are the name servers, search domains and resolver options of the pods
+	DNS       []string `compose:"dns"`
+	DNSSearch []string `compose:"dns_search"`
+	DNSOpts   []string `compose:"dns_opt"`
+	// ReadOnly mounts the root filesystem of the container read-only
+	ReadOnly bool `compose:"read_only"`
+	// SecurityOpt are the no-new-privileges, seccomp, apparmor and label options of the container
+	SecurityOpt []string `compose:"security_opt"`
+	// Sysctls are the kernel parameters of the pods
+	Sysctls map[string]string `compose:"sysctls"`
+
+	WithKomposeAnnotation bool   `compose:""`
+	KomposeCommand        string `compose:""`
 	InGroup               bool
+
+	// Sources holds the location of the keys of the service, by key path
+	Sources SourceMap `compose:"" json:"-"`
+}
+
+// ExposePath is a path a service is exposed on, with the port of the service it routes to,
+// ExposeServicePort when 0
+type ExposePath struct {
+	Path string
+	Port int32
 }
 
 // HealthChecks used to distinguish between liveness and readiness
@@ -190,6 +303,8 @@ type Ports struct {
 	ContainerPort int32
 	HostIP        string
 	Protocol      string // Upper string
+	// Exposed tells the port is only exposed to the other services, by the expose key, rather than published
+	Exposed bool
 }
 
 // ID returns an unique id for this port settings, to avoid conflict
@@ -217,6 +332,53 @@ type Placement struct {
 	NegativeConstraints map[string]string
 }
 
+// SourceLocation is the position of a key in a compose file
+type SourceLocation struct {
+	File string
+	Line int
+	// Path is the path of the key, like services.web.ports[0]
+	Path string
+}
+
+// String returns the location as file:line#path
+func (l SourceLocation) String() string {
+	return fmt.Sprintf("%s:%d#%s", l.File, l.Line, l.Path)
+}
+
+// SourceMap holds the locations of the keys of compose files, by key path
+type SourceMap map[string]SourceLocation
+
+// Locate returns the location of a key path. When the key has no location,
+// like a key inherited from a default value, the location of its closest parent is returned.
+func (m SourceMap) Locate(path string) (SourceLocation, bool) {
+	for path != "" {
+		if location, ok := m[path]; ok {
+			return location, true
+		}
+		i := strings.LastIndexAny(path, ".[")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return SourceLocation{}, false
+}
+
+// Position returns the file and line of a key path, see Locate
+func (m SourceMap) Position(path string) (string, int, bool) {
+	location, ok := m.Locate(path)
+	return location.File, location.Line, ok
+}
+
+// Locate returns the location of a key of the service, like ports[0]
+func (s *ServiceConfig) Locate(key string) (SourceLocation, bool) {
+	path := "services." + s.Name
+	if key != "" {
+		path += "." + key
+	}
+	return s.Sources.Locate(path)
+}
+
 // GetConfigMapKeyFromMeta ...
 // given a source name ,find the file and extract the filename which will be act as ConfigMap key
 // return "" if not found
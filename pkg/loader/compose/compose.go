@@ -19,12 +19,14 @@ package compose
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 
 	"gopkg.in/yaml.v2"
 
 	"github.com/docker/libcompose/project"
 	"github.com/fatih/structs"
+	"github.com/kubernetes/kompose/pkg/diagnostics"
 	"github.com/kubernetes/kompose/pkg/kobject"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -40,42 +42,31 @@ type Compose struct {
 // checkUnsupportedKey checks if libcompose project contains
 // keys that are not supported by this loader.
 // list of all unsupported keys are stored in unsupportedKey variable
-// returns list of unsupported YAML keys from docker-compose
-func checkUnsupportedKey(composeProject *project.Project) []string {
+// returns a diagnostic for every unsupported YAML key from docker-compose, by service
+func checkUnsupportedKey(composeProject *project.Project) diagnostics.Diagnostics {
 	// list of all unsupported keys for this loader
 	// this is map to make searching for keys easier
-	// to make sure that unsupported key is not going to be reported twice
-	// by keeping record if already saw this key in another service
 	var unsupportedKey = map[string]bool{
-		"CgroupParent":  false,
-		"CPUSet":        false,
-		"CPUShares":     false,
-		"Devices":       false,
-		"DependsOn":     false,
-		"DNS":           false,
-		"DNSSearch":     false,
-		"EnvFile":       false,
-		"ExternalLinks": false,
-		"ExtraHosts":    false,
-		"Ipc":           false,
-		"Logging":       false,
-		"MacAddress":    false,
-		"MemSwapLimit":  false,
-		"NetworkMode":   false,
-		"SecurityOpt":   false,
-		"ShmSize":       false,
-		"StopSignal":    false,
-		"VolumeDriver":  false,
-		"Uts":           false,
-		"ReadOnly":      false,
-		"Ulimits":       false,
-		"Net":           false,
-		"Sysctls":       false,
+		"CgroupParent":  true,
+		"CPUSet":        true,
+		"CPUShares":     true,
+		"Devices":       true,
+		"DependsOn":     true,
+		"EnvFile":       true,
+		"ExternalLinks": true,
+		"Logging":       true,
+		"MacAddress":    true,
+		"MemSwapLimit":  true,
+		"StopSignal":    true,
+		"VolumeDriver":  true,
+		"Uts":           true,
+		"Net":           true,
+		"Sysctls":       true,
 		//"Networks":    false, // We shall be spporting network now. There are special checks for Network in checkUnsupportedKey function
-		"Links": false,
+		"Links": true,
 	}
 
-	var keysFound []string
+	var keysFound diagnostics.Diagnostics
 
 	// Root level keys are not yet supported except Network
 	// Check to see if the default network is available and length is only equal to one.
@@ -85,17 +76,21 @@ func checkUnsupportedKey(composeProject *project.Project) []string {
 
 	// Root level volumes are not yet supported
 	if len(composeProject.VolumeConfigs) > 0 {
-		keysFound = append(keysFound, "root level volumes")
+		keysFound = append(keysFound, unsupportedKeyDiagnostic("", "volumes", "root level volumes"))
 	}
 
-	for _, serviceConfig := range composeProject.ServiceConfigs.All() {
+	// libcompose doesn't keep the order of the services
+	names := composeProject.ServiceConfigs.Keys()
+	sort.Strings(names)
+	for _, name := range names {
+		serviceConfig, _ := composeProject.ServiceConfigs.Get(name)
 		// this reflection is used in check for empty arrays
 		val := reflect.ValueOf(serviceConfig).Elem()
 		s := structs.New(serviceConfig)
 
 		for _, f := range s.Fields() {
-			// Check if given key is among unsupported keys, and skip it if we already saw this key
-			if alreadySaw, ok := unsupportedKey[f.Name()]; ok && !alreadySaw {
+			// Check if given key is among unsupported keys
+			if unsupportedKey[f.Name()] {
 				if f.IsExported() && !f.IsZero() {
 					// IsZero returns false for empty array/slice ([])
 					// this check if field is Slice, and then it checks its size
@@ -133,17 +128,57 @@ func checkUnsupportedKey(composeProject *project.Project) []string {
 						}
 					}
 
-					keysFound = append(keysFound, yamlTagName)
-					unsupportedKey[f.Name()] = true
+					keysFound = append(keysFound, unsupportedKeyDiagnostic(name, yamlTagName, yamlTagName))
 				}
 			}
 		}
+
+		var ulimits []string
+		for _, ulimit := range serviceConfig.Ulimits.Elements {
+			ulimits = append(ulimits, ulimit.Name)
+		}
+		if len(ulimits) > 0 {
+			keysFound = append(keysFound, ulimitsDiagnostic(name, ulimits))
+		}
 	}
 	return keysFound
 }
 
+// ulimitsDiagnostic reports the ulimits of a service, Kubernetes having no equivalent
+func ulimitsDiagnostic(service string, names []string) diagnostics.Diagnostic {
+	sort.Strings(names)
+	return diagnostics.Diagnostic{
+		RuleID:   diagnostics.RuleUnsupportedKey,
+		Severity: diagnostics.SeverityWarning,
+		Service:  service,
+		Path:     diagnostics.ServicePath(service, "ulimits"),
+		Message: fmt.Sprintf("Ignoring the ulimits %s of service %s, Kubernetes has no equivalent: the containers get the limits of the container runtime of the nodes",
+			strings.Join(names, ", "), service),
+	}
+}
+
+// unsupportedKeyDiagnostic returns the diagnostic of a key ignored by the loader,
+// service being empty for a root level key
+func unsupportedKeyDiagnostic(service string, key string, name string) diagnostics.Diagnostic {
+	path := key
+	message := fmt.Sprintf("Unsupported %s key - ignoring", name)
+	if service != "" {
+		path = diagnostics.ServicePath(service, key)
+		message = fmt.Sprintf("Unsupported %s key - ignoring for service %s", name, service)
+	}
+	return diagnostics.Diagnostic{
+		RuleID:   diagnostics.RuleUnsupportedKey,
+		Severity: diagnostics.SeverityWarning,
+		Service:  service,
+		Path:     path,
+		Message:  message,
+	}
+}
+
 // LoadFile loads a compose file into KomposeObject
-func (c *Compose) LoadFile(files []string) (kobject.KomposeObject, error) {
+// Only the services enabled by the given profiles are kept.
+// The issues found while loading are reported to diags, which can be nil.
+func (c *Compose) LoadFile(files []string, profiles []string, diags *diagnostics.Collector) (kobject.KomposeObject, error) {
 	// Load the json / yaml file in order to get the version value
 	var version string
 
@@ -153,9 +188,31 @@ func (c *Compose) LoadFile(files []string) (kobject.KomposeObject, error) {
 			return kobject.KomposeObject{}, errors.Wrap(err, "Unable to load yaml/json file for version parsing")
 		}
 
+		// A file without version declaring its services under `services` follows the Compose Specification
+		if composeVersion == "" {
+			spec, err := isSpecFile(file)
+			if err != nil {
+				return kobject.KomposeObject{}, errors.Wrap(err, "Unable to load yaml/json file for version parsing")
+			}
+			if spec {
+				composeVersion = SpecVersion
+			}
+		}
+		// 3.9 is only supported by the Compose Specification
+		if composeVersion == "3.9" {
+			composeVersion = SpecVersion
+		}
+
 		// Check that the previous file loaded matches.
+		// The Compose Specification being a superset of version 3, both can be mixed.
 		if len(files) > 0 && version != "" && version != composeVersion {
-			return kobject.KomposeObject{}, errors.New("All Docker Compose files must be of the same version")
+			switch {
+			case version == SpecVersion && isV3(composeVersion):
+				continue
+			case composeVersion == SpecVersion && isV3(version):
+			default:
+				return kobject.KomposeObject{}, errors.New("All Docker Compose files must be of the same version")
+			}
 		}
 		version = composeVersion
 	}
@@ -163,25 +220,85 @@ func (c *Compose) LoadFile(files []string) (kobject.KomposeObject, error) {
 	log.Debugf("Docker Compose version: %s", version)
 
 	// Convert based on version
-	switch version {
+	var komposeObject kobject.KomposeObject
+	var err error
+	switch {
 	// Use libcompose for 1 or 2
 	// If blank, it's assumed it's 1 or 2
-	case "", "1", "1.0", "2", "2.0", "2.1", "2.2":
-		komposeObject, err := parseV1V2(files)
-		if err != nil {
-			return kobject.KomposeObject{}, err
-		}
-		return komposeObject, nil
+	case isV1V2(version):
+		komposeObject, err = parseV1V2(files, diags)
 		// Use docker/cli for 3
-	case "3", "3.0", "3.1", "3.2", "3.3", "3.4", "3.5", "3.6", "3.7", "3.8":
-		komposeObject, err := parseV3(files)
-		if err != nil {
-			return kobject.KomposeObject{}, err
-		}
-		return komposeObject, nil
+	case isV3(version):
+		komposeObject, err = parseV3(files, diags)
+		// Compose Specification, the version is informative only
+	case version == SpecVersion:
+		komposeObject, err = parseSpec(files, diags)
 	default:
-		return kobject.KomposeObject{}, fmt.Errorf("version %s of Docker Compose is not supported. Please use version 1, 2 or 3", version)
+		return kobject.KomposeObject{}, fmt.Errorf("version %s of Docker Compose is not supported. Please use version 1, 2 or 3, or omit the version to follow the Compose Specification", version)
+	}
+	if err != nil {
+		return kobject.KomposeObject{}, err
+	}
+
+	if err := filterServicesByProfiles(&komposeObject, profiles); err != nil {
+		return kobject.KomposeObject{}, err
+	}
+	return komposeObject, nil
+}
+
+// filterServicesByProfiles removes the services which are not enabled by the active profiles.
+// A service without profiles is always enabled, the special profile "*" enables all services.
+// Depending on a service which has been removed is an error.
+func filterServicesByProfiles(komposeObject *kobject.KomposeObject, profiles []string) error {
+	active := map[string]bool{}
+	for _, profile := range profiles {
+		active[strings.TrimSpace(profile)] = true
+	}
+	if active["*"] {
+		return nil
+	}
+
+	for name, service := range komposeObject.ServiceConfigs {
+		if len(service.Profiles) == 0 {
+			continue
+		}
+		enabled := false
+		for _, profile := range service.Profiles {
+			if active[profile] {
+				enabled = true
+				break
+			}
+		}
+		if !enabled {
+			log.Debugf("Service %q is skipped because none of its profiles %v is active", name, service.Profiles)
+			delete(komposeObject.ServiceConfigs, name)
+		}
+	}
+
+	for name, service := range komposeObject.ServiceConfigs {
+		for _, dep := range service.DependsOn {
+			if _, ok := komposeObject.ServiceConfigs[dep]; !ok {
+				return errors.Errorf("service %q depends on service %q which is not enabled by the active profiles", name, dep)
+			}
+		}
+	}
+	return nil
+}
+
+func isV1V2(version string) bool {
+	switch version {
+	case "", "1", "1.0", "2", "2.0", "2.1", "2.2":
+		return true
+	}
+	return false
+}
+
+func isV3(version string) bool {
+	switch version {
+	case "3", "3.0", "3.1", "3.2", "3.3", "3.4", "3.5", "3.6", "3.7", "3.8":
+		return true
 	}
+	return false
 }
 
 func getVersionFromFile(file string) (string, error) {
@@ -18,8 +18,11 @@ package compose
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -29,9 +32,11 @@ import (
 	"github.com/docker/libcompose/project"
 	"github.com/docker/libcompose/yaml"
 	"github.com/google/go-cmp/cmp"
+	"github.com/kubernetes/kompose/pkg/diagnostics"
 	"github.com/kubernetes/kompose/pkg/kobject"
 	"github.com/pkg/errors"
 	api "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 )
 
 func durationTypesPtr(value time.Duration) *types.Duration {
@@ -128,7 +133,7 @@ func TestLoadV3Ports(t *testing.T) {
 			expose: []string{"80", "8080"},
 			want: []kobject.Ports{
 				{HostPort: 80, ContainerPort: 80, Protocol: string(api.ProtocolTCP)},
-				{HostPort: 8080, ContainerPort: 8080, Protocol: string(api.ProtocolTCP)},
+				{HostPort: 8080, ContainerPort: 8080, Protocol: string(api.ProtocolTCP), Exposed: true},
 			},
 		},
 		{
@@ -137,7 +142,7 @@ func TestLoadV3Ports(t *testing.T) {
 			expose: []string{"80/udp"},
 			want: []kobject.Ports{
 				{HostPort: 80, ContainerPort: 80, Protocol: string(api.ProtocolTCP)},
-				{HostPort: 80, ContainerPort: 80, Protocol: string(api.ProtocolUDP)},
+				{HostPort: 80, ContainerPort: 80, Protocol: string(api.ProtocolUDP), Exposed: true},
 			},
 		},
 	} {
@@ -177,6 +182,150 @@ func TestHandleServiceType(t *testing.T) {
 	}
 }
 
+func TestParseCronJobLabels(t *testing.T) {
+	serviceConfig := kobject.ServiceConfig{}
+	labels := map[string]string{
+		LabelCronJobSchedule:                   "*/5 * * * *",
+		LabelCronJobConcurrencyPolicy:          "forbid",
+		LabelCronJobSuccessfulJobsHistoryLimit: "2",
+	}
+	if err := parseKomposeLabels(labels, &serviceConfig); err != nil {
+		t.Fatal(errors.Wrap(err, "parseKomposeLabels failed"))
+	}
+	if serviceConfig.CronJobSchedule != "*/5 * * * *" || serviceConfig.CronJobConcurrencyPolicy != "Forbid" {
+		t.Errorf("Expected the schedule and the concurrency policy to be parsed, got %q %q", serviceConfig.CronJobSchedule, serviceConfig.CronJobConcurrencyPolicy)
+	}
+	if limit := serviceConfig.CronJobSuccessfulJobsHistoryLimit; limit == nil || *limit != 2 {
+		t.Errorf("Expected a successful jobs history limit of 2, got %v", limit)
+	}
+
+	invalid := []map[string]string{
+		{LabelCronJobSchedule: "@daily", LabelCronJobConcurrencyPolicy: "sometimes"},
+		{LabelCronJobSchedule: "@daily", LabelCronJobFailedJobsHistoryLimit: "-1"},
+		{LabelCronJobConcurrencyPolicy: "allow"},
+	}
+	for _, labels := range invalid {
+		if err := parseKomposeLabels(labels, &kobject.ServiceConfig{}); err == nil {
+			t.Errorf("Expected labels %v to be rejected", labels)
+		}
+	}
+}
+
+func TestCheckHPA(t *testing.T) {
+	min, max := int32(2), int32(10)
+	tests := []struct {
+		desc    string
+		service kobject.ServiceConfig
+		valid   bool
+	}{
+		{"no autoscaler", kobject.ServiceConfig{}, true},
+		{"cpu with reservation", kobject.ServiceConfig{HPAMaxReplicas: max, HPACPU: 70, CPUReservation: 500}, true},
+		{"default cpu with limit", kobject.ServiceConfig{HPAMaxReplicas: max, CPULimit: 500}, true},
+		{"memory with reservation", kobject.ServiceConfig{HPAMaxReplicas: max, HPAMemory: 80, MemReservation: 1 << 20}, true},
+		{"cpu without reservation", kobject.ServiceConfig{HPAMaxReplicas: max, HPACPU: 70, MemReservation: 1 << 20}, false},
+		{"memory without reservation", kobject.ServiceConfig{HPAMaxReplicas: max, HPAMemory: 80, CPUReservation: 500}, false},
+		{"without maximum", kobject.ServiceConfig{HPACPU: 70, CPUReservation: 500}, false},
+		{"minimum above maximum", kobject.ServiceConfig{HPAMaxReplicas: min, HPAMinReplicas: &max, CPUReservation: 500}, false},
+	}
+
+	for _, tt := range tests {
+		err := checkHPA(&tt.service)
+		if tt.valid && err != nil {
+			t.Errorf("%s: expected no error, got %v", tt.desc, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s: expected an error", tt.desc)
+		}
+	}
+}
+
+func TestParsePDBLabels(t *testing.T) {
+	serviceConfig := kobject.ServiceConfig{}
+	if err := parseKomposeLabels(map[string]string{LabelPDBMaxUnavailable: "25%"}, &serviceConfig); err != nil {
+		t.Fatal(errors.Wrap(err, "parseKomposeLabels failed"))
+	}
+	if serviceConfig.PDBMaxUnavailable != "25%" {
+		t.Errorf("Expected 25%% unavailable pods, got %q", serviceConfig.PDBMaxUnavailable)
+	}
+
+	invalid := []map[string]string{
+		{LabelPDBMinAvailable: "half"},
+		{LabelPDBMinAvailable: "150%"},
+		{LabelPDBMinAvailable: "1", LabelPDBMaxUnavailable: "1"},
+	}
+	for _, labels := range invalid {
+		if err := parseKomposeLabels(labels, &kobject.ServiceConfig{}); err == nil {
+			t.Errorf("Expected labels %v to be rejected", labels)
+		}
+	}
+}
+
+func TestParseRBACRules(t *testing.T) {
+	rules, err := handleRBACRules("pods, services:get,list; deployments.apps,configmaps:watch")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "handleRBACRules failed"))
+	}
+	want := []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"pods", "services"}, Verbs: []string{"get", "list"}},
+		{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"watch"}},
+		{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"watch"}},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("Expected rules %v, got %v", want, rules)
+	}
+
+	invalid := []map[string]string{
+		{LabelRBACRules: "pods"},
+		{LabelRBACRules: "pods:"},
+		{LabelRBACRules: ";"},
+		{LabelServiceAccountCreate: "maybe"},
+		{LabelRBACRules: "pods:get", LabelRBACPolicyFile: "role.yaml"},
+	}
+	for _, labels := range invalid {
+		if err := parseKomposeLabels(labels, &kobject.ServiceConfig{}); err == nil {
+			t.Errorf("Expected labels %v to be rejected", labels)
+		}
+	}
+}
+
+func TestParseExposeLabels(t *testing.T) {
+	paths, err := handleExposePaths("/api:8080, /")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "handleExposePaths failed"))
+	}
+	want := []kobject.ExposePath{{Path: "/api", Port: 8080}, {Path: "/"}}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("Expected paths %v, got %v", want, paths)
+	}
+
+	var service kobject.ServiceConfig
+	labels := map[string]string{
+		LabelServiceExpose:                 "true",
+		LabelServiceExposeIngressClassName: "nginx",
+		LabelServiceExposeAnnotationPrefix + "nginx.ingress.kubernetes.io/x": "y",
+	}
+	if err := parseKomposeLabels(labels, &service); err != nil {
+		t.Fatal(errors.Wrap(err, "parseKomposeLabels failed"))
+	}
+	if service.ExposeIngressClassName != "nginx" || service.ExposeAnnotations["nginx.ingress.kubernetes.io/x"] != "y" {
+		t.Errorf("Expected the ingress class and annotation, got %q and %v", service.ExposeIngressClassName, service.ExposeAnnotations)
+	}
+
+	invalid := []map[string]string{
+		{LabelServiceExpose: "true", LabelServiceExposePath: "api"},
+		{LabelServiceExpose: "true", LabelServiceExposePath: "/api:http"},
+		{LabelServiceExpose: "true", LabelServiceExposePort: "0"},
+		{LabelServiceExposePort: "8080"},
+		{LabelServiceExpose: "true", LabelServiceExposeTLSCert: "cert.pem"},
+		{LabelServiceExposeTLSCert: "cert.pem", LabelServiceExposeTLSKey: "key.pem"},
+	}
+	for _, labels := range invalid {
+		if err := parseKomposeLabels(labels, &kobject.ServiceConfig{}); err == nil {
+			t.Errorf("Expected labels %v to be rejected", labels)
+		}
+	}
+}
+
 // Test loading of ports
 func TestLoadPorts(t *testing.T) {
 	tests := []struct {
@@ -254,7 +403,7 @@ func TestLoadPorts(t *testing.T) {
 			want: []kobject.Ports{
 				{HostPort: 0, ContainerPort: 80, Protocol: string(api.ProtocolTCP)},
 				{HostPort: 0, ContainerPort: 3000, Protocol: string(api.ProtocolTCP)},
-				{HostPort: 0, ContainerPort: 8080, Protocol: string(api.ProtocolTCP)},
+				{HostPort: 0, ContainerPort: 8080, Protocol: string(api.ProtocolTCP), Exposed: true},
 			},
 		},
 	}
@@ -404,6 +553,17 @@ func TestUnsupportedKeys(t *testing.T) {
 		},
 	})
 
+	// unsupported keys are reported for every service using them
+	projectWithUnsupportedKeys := project.NewProject(&project.Context{}, nil, nil)
+	projectWithUnsupportedKeys.ServiceConfigs = config.NewServiceConfigs()
+	projectWithUnsupportedKeys.ServiceConfigs.Add("foo", &config.ServiceConfig{
+		MacAddress: "02:42:ac:11:00:02",
+	})
+	projectWithUnsupportedKeys.ServiceConfigs.Add("bar", &config.ServiceConfig{
+		MacAddress: "02:42:ac:11:00:03",
+		Ulimits:    yaml.Ulimits{Elements: []yaml.Ulimit{yaml.NewUlimit("nofile", 20000, 40000)}},
+	})
+
 	// define all test cases for checkUnsupportedKey function
 	testCases := map[string]struct {
 		composeProject          *project.Project
@@ -412,17 +572,27 @@ func TestUnsupportedKeys(t *testing.T) {
 		"With Networks (service and root level)": {
 			projectWithNetworks,
 			//root level network and network are now supported"
-			[]string{"root level volumes"},
+			[]string{"volumes"},
 		},
 		"Default root level Network": {
 			projectWithDefaultNetwork,
 			[]string(nil),
 		},
+		"Unsupported service keys": {
+			projectWithUnsupportedKeys,
+			[]string{"services.bar.mac_address", "services.bar.ulimits", "services.foo.mac_address"},
+		},
 	}
 
 	for name, test := range testCases {
 		t.Log("Test case:", name)
-		keys := checkUnsupportedKey(test.composeProject)
+		var keys []string
+		for _, d := range checkUnsupportedKey(test.composeProject) {
+			if d.RuleID != diagnostics.RuleUnsupportedKey {
+				t.Errorf("ERROR: Expecting rule %s, got %s", diagnostics.RuleUnsupportedKey, d.RuleID)
+			}
+			keys = append(keys, d.Path)
+		}
 		if !reflect.DeepEqual(keys, test.expectedUnsupportedKeys) {
 			t.Errorf("ERROR: Expecting unsupported keys: ['%s']. Got: ['%s']", strings.Join(test.expectedUnsupportedKeys, "', '"), strings.Join(keys, "', '"))
 		}
@@ -448,6 +618,22 @@ func TestNormalizeServiceNames(t *testing.T) {
 	}
 }
 
+func TestHandleNetworkMode(t *testing.T) {
+	testCases := map[string]string{
+		"":                "",
+		"host":            "host",
+		"none":            "none",
+		"service:vpn":     "service:vpn",
+		"service:foo_bar": "service:foo-bar",
+	}
+
+	for mode, expected := range testCases {
+		if result := handleNetworkMode(mode); result != expected {
+			t.Errorf("Expected %q for network_mode %q, got %q", expected, mode, result)
+		}
+	}
+}
+
 func TestNormalizeNetworkNames(t *testing.T) {
 	testCases := []struct {
 		composeNetworkName    string
@@ -500,7 +686,7 @@ func TestCheckPlacementCustomLabels(t *testing.T) {
 			"node.labels.monitor != xxx",
 		},
 	}
-	output := loadV3Placement(placement)
+	output := loadV3Placement("foo", placement, nil)
 
 	expected := kobject.Placement{
 		PositiveConstraints: map[string]string{
@@ -526,3 +712,511 @@ func checkConstraints(t *testing.T, caseName string, output, expected map[string
 		}
 	}
 }
+
+// writeComposeFiles writes the given files in a temporary directory and returns the directory
+func writeComposeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "kompose-compose")
+	if err != nil {
+		t.Fatalf("Unable to create temporary directory: %v", err)
+	}
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatalf("Unable to create directory for %s: %v", name, err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("Unable to write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestLoadComposeSpec(t *testing.T) {
+	dir := writeComposeFiles(t, map[string]string{
+		"docker-compose.yml": `
+include:
+  - common/db.yml
+services:
+  web:
+    image: "nginx:${NGINX_TAG}"
+    pull_policy: always
+    profiles: ["frontend"]
+    ports:
+      - "8080:80"
+    depends_on:
+      db:
+        condition: service_healthy
+    extra_hosts:
+      - "partner.example.com:10.0.0.5"
+    dns: 1.1.1.1
+    dns_search: [corp.example.com]
+    dns_opt: ["ndots:2"]
+    pid: host
+    ipc: "service:db"
+`,
+		"common/db.yml": `
+services:
+  db:
+    image: postgres
+    build: ./db
+    shm_size: 256m
+`,
+		".env": "NGINX_TAG=1.19\n",
+	})
+	defer os.RemoveAll(dir)
+
+	c := Compose{}
+	komposeObject, err := c.LoadFile([]string{filepath.Join(dir, "docker-compose.yml")}, []string{"frontend"}, nil)
+	if err != nil {
+		t.Fatalf("Unable to load compose specification file: %v", err)
+	}
+
+	web, ok := komposeObject.ServiceConfigs["web"]
+	if !ok {
+		t.Fatalf("Service web not loaded: %v", komposeObject.ServiceConfigs)
+	}
+	if web.Image != "nginx:1.19" {
+		t.Errorf("Expected image nginx:1.19 interpolated from .env, got %s", web.Image)
+	}
+	if !reflect.DeepEqual(web.Profiles, []string{"frontend"}) || !reflect.DeepEqual(web.DependsOn, []string{"db"}) {
+		t.Errorf("Unexpected profiles %v or dependencies %v", web.Profiles, web.DependsOn)
+	}
+	if web.ImagePullPolicy != "Always" {
+		t.Errorf("Expected pull policy Always, got %s", web.ImagePullPolicy)
+	}
+	if len(web.Port) != 1 || web.Port[0].ContainerPort != 80 {
+		t.Errorf("Unexpected ports %v", web.Port)
+	}
+	if !reflect.DeepEqual(web.ExtraHosts, []string{"partner.example.com:10.0.0.5"}) || !reflect.DeepEqual(web.DNS, []string{"1.1.1.1"}) ||
+		!reflect.DeepEqual(web.DNSSearch, []string{"corp.example.com"}) || !reflect.DeepEqual(web.DNSOpts, []string{"ndots:2"}) {
+		t.Errorf("Unexpected extra hosts %v, DNS servers %v, searches %v or options %v", web.ExtraHosts, web.DNS, web.DNSSearch, web.DNSOpts)
+	}
+	if web.Pid != "host" || web.Ipc != "service:db" {
+		t.Errorf("Expected pid host and ipc service:db, got %s and %s", web.Pid, web.Ipc)
+	}
+
+	db, ok := komposeObject.ServiceConfigs["db"]
+	if !ok {
+		t.Fatalf("Included service db not loaded")
+	}
+	if db.Build != filepath.Join(dir, "common/db") {
+		t.Errorf("Expected build context relative to the included file, got %s", db.Build)
+	}
+	if db.ShmSize != 256<<20 {
+		t.Errorf("Expected shm_size of 256MiB, got %d", db.ShmSize)
+	}
+}
+
+func TestLoadComposeSpecIncludeCycle(t *testing.T) {
+	dir := writeComposeFiles(t, map[string]string{
+		"a.yml": "include: [b.yml]\nservices:\n  a:\n    image: a\n",
+		"b.yml": "include: [a.yml]\nservices:\n  b:\n    image: b\n",
+	})
+	defer os.RemoveAll(dir)
+
+	c := Compose{}
+	if _, err := c.LoadFile([]string{filepath.Join(dir, "a.yml")}, nil, nil); err == nil {
+		t.Errorf("Expected an error on include cycle")
+	}
+}
+
+func TestLoadComposeSpecMixedWithV3(t *testing.T) {
+	dir := writeComposeFiles(t, map[string]string{
+		"base.yml":     "version: \"3.8\"\nservices:\n  web:\n    image: nginx\n",
+		"override.yml": "services:\n  web:\n    pull_policy: never\n",
+	})
+	defer os.RemoveAll(dir)
+
+	c := Compose{}
+	komposeObject, err := c.LoadFile([]string{filepath.Join(dir, "base.yml"), filepath.Join(dir, "override.yml")}, nil, nil)
+	if err != nil {
+		t.Fatalf("Unable to load files: %v", err)
+	}
+	if komposeObject.ServiceConfigs["web"].ImagePullPolicy != "Never" {
+		t.Errorf("Expected pull policy Never, got %s", komposeObject.ServiceConfigs["web"].ImagePullPolicy)
+	}
+}
+
+func TestLoadComposeSpec39MixedWithV3(t *testing.T) {
+	dir := writeComposeFiles(t, map[string]string{
+		"base.yml":     "version: \"3.8\"\nservices:\n  web:\n    image: nginx\n",
+		"override.yml": "version: \"3.9\"\nservices:\n  web:\n    image: nginx:alpine\n",
+	})
+	defer os.RemoveAll(dir)
+
+	c := Compose{}
+	komposeObject, err := c.LoadFile([]string{filepath.Join(dir, "base.yml"), filepath.Join(dir, "override.yml")}, nil, nil)
+	if err != nil {
+		t.Fatalf("Unable to load files: %v", err)
+	}
+	if komposeObject.ServiceConfigs["web"].Image != "nginx:alpine" {
+		t.Errorf("Expected image nginx:alpine, got %s", komposeObject.ServiceConfigs["web"].Image)
+	}
+}
+
+func TestLoadComposeSpecIncludeConflict(t *testing.T) {
+	testCases := map[string]map[string]string{
+		"Service of the including file": {
+			"docker-compose.yml": "include: [db.yml]\nservices:\n  db:\n    image: mysql\n",
+			"db.yml":             "services:\n  db:\n    image: postgres\n",
+		},
+		"Services of two included files": {
+			"docker-compose.yml": "include: [a.yml, b.yml]\nservices:\n  web:\n    image: nginx\n",
+			"a.yml":              "services:\n  db:\n    image: mysql\n",
+			"b.yml":              "services:\n  db:\n    image: postgres\n",
+		},
+	}
+
+	for name, files := range testCases {
+		t.Log("Test case:", name)
+		dir := writeComposeFiles(t, files)
+		c := Compose{}
+		if _, err := c.LoadFile([]string{filepath.Join(dir, "docker-compose.yml")}, nil, nil); err == nil {
+			t.Errorf("Expected an error on a service conflicting with an included one")
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestFilterServicesByProfiles(t *testing.T) {
+	newKomposeObject := func() kobject.KomposeObject {
+		return kobject.KomposeObject{
+			ServiceConfigs: map[string]kobject.ServiceConfig{
+				"web":   {Name: "web", DependsOn: []string{"db"}},
+				"db":    {Name: "db"},
+				"debug": {Name: "debug", Profiles: []string{"debug"}, DependsOn: []string{"web"}},
+				"seed":  {Name: "seed", Profiles: []string{"seed", "dev"}, DependsOn: []string{"db"}},
+			},
+		}
+	}
+
+	testCases := map[string]struct {
+		profiles []string
+		expected []string
+	}{
+		"No profile":        {nil, []string{"db", "web"}},
+		"One profile":       {[]string{"debug"}, []string{"db", "debug", "web"}},
+		"Any of profiles":   {[]string{"dev"}, []string{"db", "seed", "web"}},
+		"All the profiles":  {[]string{"*"}, []string{"db", "debug", "seed", "web"}},
+		"Unknown profile":   {[]string{"foo"}, []string{"db", "web"}},
+		"Multiple profiles": {[]string{"debug", "seed"}, []string{"db", "debug", "seed", "web"}},
+	}
+
+	for name, test := range testCases {
+		t.Log("Test case:", name)
+		komposeObject := newKomposeObject()
+		if err := filterServicesByProfiles(&komposeObject, test.profiles); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+			continue
+		}
+		var services []string
+		for service := range komposeObject.ServiceConfigs {
+			services = append(services, service)
+		}
+		sort.Strings(services)
+		if !reflect.DeepEqual(services, test.expected) {
+			t.Errorf("Expected services %v, got %v", test.expected, services)
+		}
+	}
+
+	komposeObject := newKomposeObject()
+	komposeObject.ServiceConfigs["web"] = kobject.ServiceConfig{Name: "web", DependsOn: []string{"debug"}}
+	if err := filterServicesByProfiles(&komposeObject, nil); err == nil {
+		t.Errorf("Expected an error when depending on a disabled service")
+	}
+}
+
+func TestLoadExtends(t *testing.T) {
+	dir := writeComposeFiles(t, map[string]string{
+		"docker-compose.yml": `
+version: "3.8"
+services:
+  web:
+    extends:
+      file: common/base.yml
+      service: app
+    environment:
+      MODE: web
+    ports:
+      - "8080:80"
+  worker:
+    extends: web
+    command: work
+`,
+		"common/base.yml": `
+version: "3.8"
+services:
+  base:
+    image: myapp
+    environment:
+      - LOG=debug
+      - MODE=base
+  app:
+    extends: base
+    build: ./app
+    ports:
+      - "9090:90"
+    volumes:
+      - ./data:/data
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	c := Compose{}
+	komposeObject, err := c.LoadFile([]string{filepath.Join(dir, "docker-compose.yml")}, nil, nil)
+	if err != nil {
+		t.Fatalf("Unable to load file: %v", err)
+	}
+
+	for _, name := range []string{"web", "worker"} {
+		service, ok := komposeObject.ServiceConfigs[name]
+		if !ok {
+			t.Fatalf("Service %s not loaded", name)
+		}
+		if service.Image != "myapp" {
+			t.Errorf("Expected %s to inherit image myapp, got %s", name, service.Image)
+		}
+		if service.Build != filepath.Join(dir, "common/app") {
+			t.Errorf("Expected %s build context relative to the extended file, got %s", name, service.Build)
+		}
+		env := map[string]string{}
+		for _, e := range service.Environment {
+			env[e.Name] = e.Value
+		}
+		if !reflect.DeepEqual(env, map[string]string{"LOG": "debug", "MODE": "web"}) {
+			t.Errorf("Unexpected environment for %s: %v", name, env)
+		}
+		if len(service.Port) != 2 {
+			t.Errorf("Expected %s to have the inherited and own ports, got %v", name, service.Port)
+		}
+		if len(service.VolList) != 1 || !strings.Contains(service.VolList[0], filepath.Join(dir, "common/data")) {
+			t.Errorf("Expected %s volume relative to the extended file, got %v", name, service.VolList)
+		}
+	}
+	if !reflect.DeepEqual(komposeObject.ServiceConfigs["worker"].Args, []string{"work"}) {
+		t.Errorf("Expected worker command to override the inherited one, got %v", komposeObject.ServiceConfigs["worker"].Args)
+	}
+}
+
+func TestLoadExtendsCycle(t *testing.T) {
+	dir := writeComposeFiles(t, map[string]string{
+		"docker-compose.yml": "version: \"3.8\"\nservices:\n  a:\n    extends: {file: other.yml, service: b}\n",
+		"other.yml":          "version: \"3.8\"\nservices:\n  b:\n    extends: {file: docker-compose.yml, service: a}\n",
+	})
+	defer os.RemoveAll(dir)
+
+	c := Compose{}
+	_, err := c.LoadFile([]string{filepath.Join(dir, "docker-compose.yml")}, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "circular reference") {
+		t.Errorf("Expected an error on extends cycle, got %v", err)
+	}
+}
+
+func TestMergeComposeDicts(t *testing.T) {
+	parse := func(content string) map[string]interface{} {
+		dict, _, err := parseComposeYAML([]byte(content), "docker-compose.yml")
+		if err != nil {
+			t.Fatalf("Unable to parse %q: %v", content, err)
+		}
+		return dict
+	}
+
+	base := parse(`
+version: "3.5"
+services:
+  web:
+    image: web
+    command: ["run", "--debug"]
+    build:
+      context: .
+      args: [A=1, B=2]
+    ports: ["8080:80", "443:443"]
+    expose: ["3000"]
+    ulimits:
+      nproc: 1024
+      nofile: {soft: 1000, hard: 2000}
+    extra_hosts: ["db:10.0.0.1", "cache:10.0.0.2"]
+    secrets: [token, {source: cert, target: cert.pem}]
+    sysctls: [net.core.somaxconn=1024]
+    init: true
+    environment: [FOO=foo, BAR=bar]
+    dns: 1.1.1.1
+    volumes: ["./data:/data", "/logs"]
+    labels: {keep: "yes", drop: "yes"}
+networks:
+  front:
+volumes:
+  data:
+`)
+	override := parse(`
+version: "3.8"
+services:
+  web:
+    command: serve
+    build:
+      dockerfile: Dockerfile.prod
+      args: {B: "3"}
+    ports: ["8080:80", "9090:90"]
+    expose: ["3000/tcp", "4000"]
+    ulimits:
+      nofile: {hard: 4000}
+    extra_hosts: {db: 10.0.0.3}
+    secrets: [{source: token, target: token.txt}]
+    sysctls: {net.ipv4.tcp_syncookies: 0}
+    init: false
+    isolation: process
+    environment: !reset
+    dns: [8.8.8.8]
+    volumes: ["./other:/data"]
+    labels:
+      drop: !reset
+    healthcheck: !override
+      test: ["CMD", "true"]
+networks:
+  back:
+volumes:
+  logs:
+`)
+
+	merged, err := mergeComposeDicts(nil, base)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	merged, err = mergeComposeDicts(merged, override)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	web := merged["services"].(map[string]interface{})["web"].(map[string]interface{})
+	expected := map[string]interface{}{
+		"image":   "web",
+		"command": "serve",
+		"build": map[string]interface{}{
+			"context":    ".",
+			"dockerfile": "Dockerfile.prod",
+			"args":       map[string]interface{}{"A": "1", "B": "3"},
+		},
+		"ports":  []interface{}{"8080:80", "443:443", "9090:90"},
+		"expose": []interface{}{"3000/tcp", "4000"},
+		"ulimits": map[string]interface{}{
+			"nproc":  1024,
+			"nofile": map[string]interface{}{"soft": 1000, "hard": 4000},
+		},
+		"extra_hosts": []interface{}{"db:10.0.0.3", "cache:10.0.0.2"},
+		"secrets": []interface{}{
+			map[string]interface{}{"source": "token", "target": "token.txt"},
+			map[string]interface{}{"source": "cert", "target": "cert.pem"},
+		},
+		"sysctls":     map[string]interface{}{"net.core.somaxconn": "1024", "net.ipv4.tcp_syncookies": 0},
+		"init":        false,
+		"isolation":   "process",
+		"dns":         []interface{}{"1.1.1.1", "8.8.8.8"},
+		"volumes":     []interface{}{"./other:/data", "/logs"},
+		"labels":      map[string]interface{}{"keep": "yes"},
+		"healthcheck": map[string]interface{}{"test": []interface{}{"CMD", "true"}},
+	}
+	if !reflect.DeepEqual(web, expected) {
+		t.Errorf("Unexpected merged service\nexpected: %#v\ngot:      %#v", expected, web)
+	}
+
+	if merged["version"] != "3.8" {
+		t.Errorf("Expected the most recent version, got %v", merged["version"])
+	}
+	for _, section := range []string{"networks", "volumes"} {
+		if len(merged[section].(map[string]interface{})) != 2 {
+			t.Errorf("Expected %s of both files, got %v", section, merged[section])
+		}
+	}
+}
+
+func TestVersionLessThan(t *testing.T) {
+	testCases := []struct {
+		v, other string
+		want     bool
+	}{
+		{"3.5", "3.8", true},
+		{"3.9", "3.10", true},
+		{"3", "3.0", false},
+		{"3.8", "3", false},
+		{"2.4", "3", true},
+	}
+	for _, tt := range testCases {
+		if got := versionLessThan(tt.v, tt.other); got != tt.want {
+			t.Errorf("versionLessThan(%q, %q) = %v, want %v", tt.v, tt.other, got, tt.want)
+		}
+	}
+}
+
+func TestLoadMergeReset(t *testing.T) {
+	dir := writeComposeFiles(t, map[string]string{
+		"docker-compose.yml": "version: \"3.8\"\nservices:\n  web:\n    image: nginx\n    ports: [\"80:80\"]\n  debug:\n    image: busybox\n",
+		"override.yml":       "version: \"3.8\"\nservices:\n  web:\n    ports: !reset []\n  debug: !reset\n",
+	})
+	defer os.RemoveAll(dir)
+
+	c := Compose{}
+	komposeObject, err := c.LoadFile([]string{filepath.Join(dir, "docker-compose.yml"), filepath.Join(dir, "override.yml")}, nil, nil)
+	if err != nil {
+		t.Fatalf("Unable to load files: %v", err)
+	}
+	if _, ok := komposeObject.ServiceConfigs["debug"]; ok {
+		t.Errorf("Expected service debug to be reset")
+	}
+	if ports := komposeObject.ServiceConfigs["web"].Port; len(ports) != 0 {
+		t.Errorf("Expected ports of web to be reset, got %v", ports)
+	}
+}
+
+func TestLoadSources(t *testing.T) {
+	dir := writeComposeFiles(t, map[string]string{
+		"docker-compose.yml": `version: "3.8"
+services:
+  web:
+    extends:
+      file: common/base.yml
+      service: app
+    ports:
+      - "8080:80"
+`,
+		"override.yml": `version: "3.8"
+services:
+  web:
+    image: nginx:override
+`,
+		"common/base.yml": `version: "3.8"
+services:
+  app:
+    image: myapp
+    restart: unless-stopped
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	c := Compose{}
+	diags := &diagnostics.Collector{}
+	komposeObject, err := c.LoadFile([]string{filepath.Join(dir, "docker-compose.yml"), filepath.Join(dir, "override.yml")}, nil, diags)
+	if err != nil {
+		t.Fatalf("Unable to load files: %v", err)
+	}
+
+	web := komposeObject.ServiceConfigs["web"]
+	testCases := map[string]string{
+		"":         "docker-compose.yml:3#services.web",
+		"ports[0]": "docker-compose.yml:8#services.web.ports[0]",
+		"image":    "override.yml:4#services.web.image",
+		"restart":  "common/base.yml:5#services.app.restart",
+		// keys without a location of their own are located at their closest parent
+		"ports[0].target": "docker-compose.yml:8#services.web.ports[0]",
+	}
+	for key, want := range testCases {
+		location, ok := web.Locate(key)
+		if !ok || location.String() != want {
+			t.Errorf("Expected %q to be located at %s, got %s", key, want, location)
+		}
+	}
+
+	d := diags.Diagnostics().WithRules([]string{diagnostics.RuleRestartPolicy})
+	if len(d) != 1 || d[0].File != "common/base.yml" || d[0].Line != 5 {
+		t.Errorf("Expected the restart policy diagnostic to be located in common/base.yml:5, got %+v", d)
+	}
+}
@@ -0,0 +1,259 @@
+/*
+Copyright 2017 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package compose
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/kubernetes/kompose/pkg/kobject"
+	"github.com/pkg/errors"
+)
+
+// extendsResolver resolves the `extends` key of the services of a compose file.
+// docker/cli forbids this key, so it has to be resolved on the raw dictionaries, before loading them.
+type extendsResolver struct {
+	// files caches the dictionaries of the files already read, by absolute path
+	files map[string]map[string]interface{}
+	// sources holds the locations of the keys of the files already read, by absolute path
+	sources map[string]kobject.SourceMap
+	// projectDir is the directory the files are named relative to in the locations
+	projectDir string
+}
+
+// resolveExtends replaces, in the dictionary of a compose file, every service using `extends`
+// by the merge of the service it extends and its own definition. The keys inherited by a service
+// are located in sources where they are defined, files being named relative to projectDir.
+func resolveExtends(config map[string]interface{}, sources kobject.SourceMap, file string, projectDir string) error {
+	services, err := getServiceDicts(config)
+	if err != nil || services == nil {
+		return err
+	}
+
+	filename, dir, err := extendsFileKey(file)
+	if err != nil {
+		return err
+	}
+	r := &extendsResolver{
+		files:      map[string]map[string]interface{}{filename: config},
+		sources:    map[string]kobject.SourceMap{filename: sources},
+		projectDir: projectDir,
+	}
+
+	for name, service := range services {
+		if _, ok := service.(map[string]interface{}); !ok {
+			continue
+		}
+		if _, err := r.resolveService(filename, dir, services, name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveService returns the definition of a service with its `extends` resolved.
+// stack holds the services being resolved, to detect cycles.
+func (r *extendsResolver) resolveService(filename string, dir string, services map[string]interface{}, name string, stack []string) (map[string]interface{}, error) {
+	rawService, ok := services[name]
+	if !ok {
+		return nil, errors.Errorf("cannot extend service %q: not found in %s", name, filename)
+	}
+	service, ok := rawService.(map[string]interface{})
+	if !ok {
+		if rawService != nil {
+			return nil, errors.Errorf("service %s must be a mapping", name)
+		}
+		service = map[string]interface{}{}
+	}
+
+	rawExtends, ok := service["extends"]
+	if !ok {
+		return service, nil
+	}
+
+	id := filename + "#" + name
+	for i, item := range stack {
+		if item == id {
+			return nil, errors.Errorf("circular reference with extends: %s", strings.Join(append(stack[i:], id), " -> "))
+		}
+	}
+	stack = append(stack, id)
+
+	baseName, baseFile, err := parseExtends(rawExtends)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid extends for service %s", name)
+	}
+
+	baseFilename, baseDir, baseServices := filename, dir, services
+	if baseFile != "" {
+		if !filepath.IsAbs(baseFile) {
+			baseFile = filepath.Join(dir, baseFile)
+		}
+		baseFilename, baseDir, err = extendsFileKey(baseFile)
+		if err != nil {
+			return nil, err
+		}
+		baseConfig, err := r.loadFile(baseFilename)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot extend service %q", name)
+		}
+		baseServices, err = getServiceDicts(baseConfig)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to load %s", baseFilename)
+		}
+	}
+
+	base, err := r.resolveService(baseFilename, baseDir, baseServices, baseName, stack)
+	if err != nil {
+		return nil, err
+	}
+	if baseDir != dir {
+		base = copyDict(base)
+		rebaseServicePaths(base, baseDir, dir)
+	}
+
+	own := copyDict(service)
+	delete(own, "extends")
+	merged := mergeServiceDicts(name, base, own)
+	if sources := r.sources[filename]; sources != nil {
+		inheritSources(sources, name, r.sources[baseFilename], baseName)
+	}
+
+	services[name] = merged
+	return merged, nil
+}
+
+// loadFile reads and parses a compose file referenced by `extends`
+func (r *extendsResolver) loadFile(filename string) (map[string]interface{}, error) {
+	if config, ok := r.files[filename]; ok {
+		return config, nil
+	}
+	loadedFile, err := ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	config, sources, err := parseComposeYAML(loadedFile, sourceName(r.projectDir, filename))
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse %s", filename)
+	}
+	r.files[filename] = config
+	r.sources[filename] = sources
+	return config, nil
+}
+
+// extendsFileKey returns the absolute path of a compose file and the directory
+// its relative paths are resolved against. Stdin is resolved against the current directory.
+func extendsFileKey(file string) (string, string, error) {
+	if file == "-" {
+		dir, err := filepath.Abs(".")
+		return file, dir, err
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", "", err
+	}
+	return abs, filepath.Dir(abs), nil
+}
+
+// parseExtends returns the service and the optional file of an `extends` value,
+// either a service name or a mapping with `service` and `file`
+func parseExtends(value interface{}) (string, string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, "", nil
+	case map[string]interface{}:
+		service, ok := v["service"].(string)
+		if !ok || service == "" {
+			return "", "", errors.New("extends requires a service")
+		}
+		file := ""
+		if rawFile, ok := v["file"]; ok {
+			if file, ok = rawFile.(string); !ok {
+				return "", "", errors.New("extends file must be a string")
+			}
+		}
+		return service, file, nil
+	default:
+		return "", "", errors.Errorf("unexpected extends value %v", value)
+	}
+}
+
+// getServiceDicts returns the `services` mapping of a compose file dictionary
+func getServiceDicts(config map[string]interface{}) (map[string]interface{}, error) {
+	rawServices, ok := config["services"]
+	if !ok || rawServices == nil {
+		return nil, nil
+	}
+	services, ok := rawServices.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("services must be a mapping")
+	}
+	return services, nil
+}
+
+// rebaseServicePaths makes the relative paths of a service defined in fromDir relative to toDir
+func rebaseServicePaths(service map[string]interface{}, fromDir string, toDir string) {
+	rebase := func(path string) string {
+		if path == "" || path == resetValue || filepath.IsAbs(path) || strings.HasPrefix(path, "~") || strings.Contains(path, "://") {
+			return path
+		}
+		rel, err := filepath.Rel(toDir, filepath.Join(fromDir, path))
+		if err != nil {
+			return path
+		}
+		if !strings.HasPrefix(rel, ".") {
+			rel = "./" + rel
+		}
+		return rel
+	}
+
+	switch build := service["build"].(type) {
+	case string:
+		service["build"] = rebase(build)
+	case map[string]interface{}:
+		if context, ok := build["context"].(string); ok {
+			build["context"] = rebase(context)
+		}
+	}
+
+	switch envFile := service["env_file"].(type) {
+	case string:
+		service["env_file"] = rebase(envFile)
+	case []interface{}:
+		for i, item := range envFile {
+			if path, ok := item.(string); ok {
+				envFile[i] = rebase(path)
+			}
+		}
+	}
+
+	if volumes, ok := service["volumes"].([]interface{}); ok {
+		for i, item := range volumes {
+			switch volume := item.(type) {
+			case string:
+				parts := strings.SplitN(volume, ":", 2)
+				if len(parts) == 2 && strings.HasPrefix(parts[0], ".") {
+					volumes[i] = rebase(parts[0]) + ":" + parts[1]
+				}
+			case map[string]interface{}:
+				if source, ok := volume["source"].(string); ok && strings.HasPrefix(source, ".") {
+					volume["source"] = rebase(source)
+				}
+			}
+		}
+	}
+}
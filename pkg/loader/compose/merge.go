@@ -0,0 +1,560 @@
+/*
+Copyright 2017 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package compose
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/cli/cli/compose/loader"
+	"github.com/kubernetes/kompose/pkg/kobject"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Compose files are merged as raw dictionaries, before docker/cli loads them, following the
+// Compose Specification rules: mappings are merged, sequences are merged by a key depending
+// on the field, and scalars are overridden.
+// The `!reset` tag removes the value defined by the previous files, `!override` replaces it.
+
+const (
+	resetTag    = "!reset"
+	overrideTag = "!override"
+
+	// resetValue and overrideKey are what the tags are turned into when parsing a compose file
+	resetValue  = "\x00kompose:reset"
+	overrideKey = "\x00kompose:override"
+)
+
+// mergeFunc merges an override value into a base value, both being non nil
+type mergeFunc func(path []string, base interface{}, override interface{}) interface{}
+
+// mergeRule is the merge function of the fields matching a path, `*` matching any key
+type mergeRule struct {
+	path  []string
+	merge mergeFunc
+}
+
+var mergeRules []mergeRule
+
+func init() {
+	rules := map[string]mergeFunc{
+		"version": mergeVersion,
+
+		"services.*.command":          replaceValue,
+		"services.*.entrypoint":       replaceValue,
+		"services.*.healthcheck.test": replaceValue,
+
+		"services.*.build":         mergeBuild,
+		"services.*.build.args":    mergeListOrDict,
+		"services.*.build.labels":  mergeListOrDict,
+		"services.*.deploy.labels": mergeListOrDict,
+		"services.*.environment":   mergeListOrDict,
+		"services.*.labels":        mergeListOrDict,
+		"services.*.sysctls":       mergeListOrDict,
+		"services.*.networks":      mergeListOrDict,
+		"services.*.depends_on":    mergeListOrDict,
+
+		"services.*.ports":       mergeSequenceBy(portKey),
+		"services.*.expose":      mergeSequenceBy(exposeKey),
+		"services.*.volumes":     mergeSequenceBy(mountTarget),
+		"services.*.devices":     mergeSequenceBy(mountTarget),
+		"services.*.secrets":     mergeSequenceBy(sourceKey),
+		"services.*.configs":     mergeSequenceBy(sourceKey),
+		"services.*.extra_hosts": mergeExtraHosts,
+
+		// string or list fields
+		"services.*.dns":        mergeSequenceBy(valueKey),
+		"services.*.dns_search": mergeSequenceBy(valueKey),
+		"services.*.env_file":   mergeSequenceBy(valueKey),
+		"services.*.tmpfs":      mergeSequenceBy(valueKey),
+	}
+	for path, merge := range rules {
+		mergeRules = append(mergeRules, mergeRule{path: strings.Split(path, "."), merge: merge})
+	}
+}
+
+// parseComposeYAML parses the content of a compose file, turning the merge tags
+// into values mergeComposeDicts understands. It also returns the location of its keys,
+// name being the file name recorded in the locations.
+func parseComposeYAML(content []byte, name string) (map[string]interface{}, kobject.SourceMap, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		// let docker/cli report the syntax errors
+		if _, err := loader.ParseYAML(content); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, err
+	}
+	sources := kobject.SourceMap{}
+	collectSources(sources, &document, name, "")
+
+	if bytes.Contains(content, []byte(resetTag)) || bytes.Contains(content, []byte(overrideTag)) {
+		markMergeTags(&document)
+		var err error
+		if content, err = yaml.Marshal(&document); err != nil {
+			return nil, nil, err
+		}
+	}
+	dict, err := loader.ParseYAML(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dict, sources, nil
+}
+
+// markMergeTags replaces the nodes tagged with `!reset` by resetValue,
+// and wraps the nodes tagged with `!override` in a mapping with overrideKey
+func markMergeTags(node *yaml.Node) {
+	switch node.Tag {
+	case resetTag:
+		*node = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: resetValue}
+		return
+	case overrideTag:
+		value := *node
+		value.Tag = ""
+		markMergeTags(&value)
+		*node = yaml.Node{
+			Kind:    yaml.MappingNode,
+			Tag:     "!!map",
+			Content: []*yaml.Node{{Kind: yaml.ScalarNode, Tag: "!!str", Value: overrideKey}, &value},
+		}
+		return
+	}
+	for _, child := range node.Content {
+		markMergeTags(child)
+	}
+}
+
+// mergeComposeDicts merges the dictionary of a compose file into the result of the merge
+// of the files loaded before it. base may be nil for the first file.
+func mergeComposeDicts(base map[string]interface{}, override map[string]interface{}) (map[string]interface{}, error) {
+	if base == nil {
+		base = map[string]interface{}{}
+	}
+	for _, section := range []string{"services", "networks", "volumes", "secrets", "configs"} {
+		for _, dict := range []map[string]interface{}{base, override} {
+			if value, ok := dict[section]; ok && value != nil && !isMergeTag(value) {
+				if _, ok := value.(map[string]interface{}); !ok {
+					return nil, errors.Errorf("%s must be a mapping", section)
+				}
+			}
+		}
+	}
+	return mergeDicts(nil, base, override), nil
+}
+
+// mergeServiceDicts merges the definition of a service into the service it extends
+func mergeServiceDicts(name string, base map[string]interface{}, override map[string]interface{}) map[string]interface{} {
+	return mergeDicts([]string{"services", name}, base, override)
+}
+
+// mergeValue merges an override value into a base value, the path locating them in the compose file.
+// It returns false when the value has to be removed.
+func mergeValue(path []string, base interface{}, override interface{}) (interface{}, bool) {
+	if override == resetValue {
+		return nil, false
+	}
+	if value, ok := overriddenValue(override); ok {
+		return cleanValue(value), true
+	}
+	if base == nil {
+		return cleanValue(override), true
+	}
+	if override == nil {
+		return base, true
+	}
+
+	for _, rule := range mergeRules {
+		if matchPath(rule.path, path) {
+			return rule.merge(path, base, override), true
+		}
+	}
+	return mergeDefault(path, base, override), true
+}
+
+// mergeDefault merges mappings recursively, appends the new items of sequences and overrides scalars
+func mergeDefault(path []string, base interface{}, override interface{}) interface{} {
+	switch b := base.(type) {
+	case map[string]interface{}:
+		if o, ok := override.(map[string]interface{}); ok {
+			return mergeDicts(path, b, o)
+		}
+	case []interface{}:
+		if o, ok := override.([]interface{}); ok {
+			return mergeSequenceBy(valueKey)(path, b, o)
+		}
+	}
+	return cleanValue(override)
+}
+
+// mergeDicts merges the keys of override into a copy of base
+func mergeDicts(path []string, base map[string]interface{}, override map[string]interface{}) map[string]interface{} {
+	result := copyDict(base)
+	for key, value := range override {
+		childPath := append(append([]string{}, path...), key)
+		merged, keep := mergeValue(childPath, result[key], value)
+		if !keep {
+			delete(result, key)
+			continue
+		}
+		result[key] = merged
+	}
+	return result
+}
+
+func replaceValue(path []string, base interface{}, override interface{}) interface{} {
+	return cleanValue(override)
+}
+
+// mergeVersion keeps the most recent version of the merged files
+func mergeVersion(path []string, base interface{}, override interface{}) interface{} {
+	if versionLessThan(fmt.Sprintf("%v", base), fmt.Sprintf("%v", override)) {
+		return override
+	}
+	return base
+}
+
+// versionLessThan compares two versions like 3.8 and 3.10 number by number, the missing numbers being 0
+func versionLessThan(v string, other string) bool {
+	numbers, others := strings.Split(v, "."), strings.Split(other, ".")
+	for i := 0; i < len(numbers) || i < len(others); i++ {
+		var n, o int
+		if i < len(numbers) {
+			n, _ = strconv.Atoi(numbers[i])
+		}
+		if i < len(others) {
+			o, _ = strconv.Atoi(others[i])
+		}
+		if n != o {
+			return n < o
+		}
+	}
+	return false
+}
+
+// mergeBuild merges the build sections, the short syntax being the build context
+func mergeBuild(path []string, base interface{}, override interface{}) interface{} {
+	toBuildDict := func(value interface{}) map[string]interface{} {
+		if context, ok := value.(string); ok {
+			return map[string]interface{}{"context": context}
+		}
+		dict, _ := value.(map[string]interface{})
+		return dict
+	}
+	return mergeDicts(path, toBuildDict(base), toBuildDict(override))
+}
+
+// mergeListOrDict merges fields accepting either a mapping or a list. Two lists are merged
+// as sequences, otherwise both values are converted to mappings.
+func mergeListOrDict(path []string, base interface{}, override interface{}) interface{} {
+	baseList, baseIsList := base.([]interface{})
+	overrideList, overrideIsList := override.([]interface{})
+	if baseIsList && overrideIsList && !isKeyValueList(path) {
+		return mergeSequenceBy(valueKey)(path, baseList, overrideList)
+	}
+	return mergeDicts(path, toDict(base), toDict(override))
+}
+
+// isKeyValueList reports whether the list syntax of a field is made of `KEY=VALUE` items
+func isKeyValueList(path []string) bool {
+	switch path[len(path)-1] {
+	case "networks", "depends_on":
+		return false
+	}
+	return true
+}
+
+// mergeExtraHosts merges the extra hosts by host name
+func mergeExtraHosts(path []string, base interface{}, override interface{}) interface{} {
+	return mergeSequenceBy(hostKey)(path, toHostList(base), toHostList(override))
+}
+
+// mergeSequenceBy returns a merge function appending the items of the override sequence to the
+// base sequence, replacing the base items with the same key. Items with an empty key are always appended.
+// A scalar is handled as a sequence of one item.
+func mergeSequenceBy(key func(interface{}) string) mergeFunc {
+	return func(path []string, base interface{}, override interface{}) interface{} {
+		result := append([]interface{}{}, toList(base)...)
+		for _, item := range toList(override) {
+			if item == resetValue {
+				continue
+			}
+			item = cleanValue(item)
+			k := key(item)
+			replaced := false
+			if k != "" {
+				for i, existing := range result {
+					if key(existing) == k {
+						result[i] = item
+						replaced = true
+						break
+					}
+				}
+			}
+			if !replaced {
+				result = append(result, item)
+			}
+		}
+		return result
+	}
+}
+
+// valueKey identifies the scalar items of a sequence by their value
+func valueKey(item interface{}) string {
+	switch item.(type) {
+	case map[string]interface{}, []interface{}:
+		return ""
+	}
+	return fmt.Sprintf("%v", item)
+}
+
+// portKey identifies a port by its host ip, published port, target port and protocol
+func portKey(item interface{}) string {
+	var ip, published, target, protocol string
+	switch v := item.(type) {
+	case map[string]interface{}:
+		if v["target"] == nil {
+			return ""
+		}
+		target = fmt.Sprintf("%v", v["target"])
+		if v["published"] != nil {
+			published = fmt.Sprintf("%v", v["published"])
+		}
+		if v["host_ip"] != nil {
+			ip = fmt.Sprintf("%v", v["host_ip"])
+		}
+		if v["protocol"] != nil {
+			protocol = fmt.Sprintf("%v", v["protocol"])
+		}
+	default:
+		spec := fmt.Sprintf("%v", v)
+		if i := strings.LastIndex(spec, "/"); i >= 0 {
+			protocol = spec[i+1:]
+			spec = spec[:i]
+		}
+		target = spec
+		if i := strings.LastIndex(spec, ":"); i >= 0 {
+			target = spec[i+1:]
+			published = spec[:i]
+			if i := strings.LastIndex(published, ":"); i >= 0 {
+				ip = published[:i]
+				published = published[i+1:]
+			}
+		}
+	}
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	return fmt.Sprintf("%s:%s:%s/%s", ip, published, target, protocol)
+}
+
+// exposeKey identifies an exposed port by its port and protocol
+func exposeKey(item interface{}) string {
+	port := fmt.Sprintf("%v", item)
+	if !strings.Contains(port, "/") {
+		port += "/tcp"
+	}
+	return port
+}
+
+// mountTarget returns the container path of a volume or device, in short or long syntax
+func mountTarget(item interface{}) string {
+	switch v := item.(type) {
+	case string:
+		parts := strings.Split(v, ":")
+		if len(parts) == 1 {
+			return parts[0]
+		}
+		// skip the drive letter of windows paths
+		if len(parts[0]) == 1 && len(parts) > 2 {
+			parts = parts[1:]
+		}
+		return parts[1]
+	case map[string]interface{}:
+		if target, ok := v["target"].(string); ok {
+			return target
+		}
+	}
+	return ""
+}
+
+// sourceKey identifies a secret or a config by its source
+func sourceKey(item interface{}) string {
+	switch v := item.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		if source, ok := v["source"].(string); ok {
+			return source
+		}
+	}
+	return ""
+}
+
+// hostKey identifies an extra host by its host name
+func hostKey(item interface{}) string {
+	host := fmt.Sprintf("%v", item)
+	if i := strings.IndexAny(host, ":="); i >= 0 {
+		return host[:i]
+	}
+	return host
+}
+
+// toHostList converts the mapping syntax of extra_hosts to the `host:ip` list syntax
+func toHostList(value interface{}) []interface{} {
+	dict, ok := value.(map[string]interface{})
+	if !ok {
+		return toList(value)
+	}
+	var hosts []interface{}
+	for _, host := range sortedKeys(dict) {
+		hosts = append(hosts, fmt.Sprintf("%s:%v", host, dict[host]))
+	}
+	return hosts
+}
+
+// toList converts a sequence or a scalar to a sequence
+func toList(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	default:
+		return []interface{}{v}
+	}
+}
+
+// toDict converts the list syntax of a field to a mapping. `KEY=VALUE` items are split,
+// other items become keys with a nil value.
+func toDict(value interface{}) map[string]interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v
+	case []interface{}:
+		result := map[string]interface{}{}
+		for _, item := range v {
+			kv := strings.SplitN(fmt.Sprintf("%v", item), "=", 2)
+			if len(kv) == 1 {
+				result[kv[0]] = nil
+				continue
+			}
+			result[kv[0]] = kv[1]
+		}
+		return result
+	}
+	return map[string]interface{}{}
+}
+
+// matchPath reports whether a path matches a rule path
+func matchPath(rule []string, path []string) bool {
+	if len(rule) != len(path) {
+		return false
+	}
+	for i := range rule {
+		if rule[i] != "*" && rule[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isMergeTag reports whether a value comes from a merge tag
+func isMergeTag(value interface{}) bool {
+	if value == resetValue {
+		return true
+	}
+	_, ok := overriddenValue(value)
+	return ok
+}
+
+// overriddenValue returns the value tagged with `!override`
+func overriddenValue(value interface{}) (interface{}, bool) {
+	dict, ok := value.(map[string]interface{})
+	if !ok || len(dict) != 1 {
+		return nil, false
+	}
+	overridden, ok := dict[overrideKey]
+	return overridden, ok
+}
+
+// cleanValue returns a copy of a value without merge tags, which are meaningless without a base value
+func cleanValue(value interface{}) interface{} {
+	if overridden, ok := overriddenValue(value); ok {
+		return cleanValue(overridden)
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if item == resetValue {
+				continue
+			}
+			result[key] = cleanValue(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			if item == resetValue {
+				continue
+			}
+			result = append(result, cleanValue(item))
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// copyDict returns a deep copy of a compose dictionary
+func copyDict(dict map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(dict))
+	for key, value := range dict {
+		result[key] = copyValue(value)
+	}
+	return result
+}
+
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return copyDict(v)
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = copyValue(item)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// sortedKeys returns the keys of a mapping in alphabetical order
+func sortedKeys(dict map[string]interface{}) []string {
+	keys := make([]string, 0, len(dict))
+	for key := range dict {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
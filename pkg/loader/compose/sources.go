@@ -0,0 +1,176 @@
+/*
+Copyright 2017 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package compose
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/kubernetes/kompose/pkg/kobject"
+	"gopkg.in/yaml.v3"
+)
+
+// The location of the keys of the compose files is kept in a kobject.SourceMap, by key path:
+// services.web.ports[0] is the first port of the web service. docker/cli parses the files
+// without positions, so they are read from the yaml.v3 nodes of each file, and merged
+// alongside the dictionaries of the files.
+
+// collectSources records in sources the location of node and of its children, path being the key path of node
+func collectSources(sources kobject.SourceMap, node *yaml.Node, file string, path string) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			collectSources(sources, child, file, path)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			// the keys merged from an anchor keep the location of the mapping using them
+			if key.Value == "<<" {
+				continue
+			}
+			childPath := key.Value
+			if path != "" {
+				childPath = path + "." + key.Value
+			}
+			sources[childPath] = kobject.SourceLocation{File: file, Line: key.Line, Path: childPath}
+			collectSources(sources, value, file, childPath)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			childPath := fmt.Sprintf("%s[%d]", path, i)
+			sources[childPath] = kobject.SourceLocation{File: file, Line: item.Line, Path: childPath}
+			collectSources(sources, item, file, childPath)
+		}
+	}
+}
+
+// mergeSources merges the locations of the keys of an override file into base, and returns it.
+// A value defined by both files is located in the override file, but mappings, like a service, stay
+// located where they are first defined. So do the items of sequences: they are merged item by item,
+// and the indexes of the override items are not those of the result.
+func mergeSources(base kobject.SourceMap, override kobject.SourceMap) kobject.SourceMap {
+	if base == nil {
+		base = kobject.SourceMap{}
+	}
+	parents := map[string]bool{}
+	for path := range override {
+		for i := strings.LastIndexAny(path, ".["); i > 0; i = strings.LastIndexAny(path, ".[") {
+			path = path[:i]
+			parents[path] = true
+		}
+	}
+	for path, location := range override {
+		if _, ok := base[path]; ok && (parents[path] || strings.Contains(path, "[")) {
+			continue
+		}
+		base[path] = location
+	}
+	return base
+}
+
+// inheritSources locates in sources the keys a service inherits from the service it extends,
+// when the service doesn't define them itself
+func inheritSources(sources kobject.SourceMap, service string, baseSources kobject.SourceMap, baseService string) {
+	prefix := "services." + service
+	basePrefix := "services." + baseService
+	for path, location := range baseSources {
+		if !strings.HasPrefix(path, basePrefix+".") && !strings.HasPrefix(path, basePrefix+"[") {
+			continue
+		}
+		inherited := prefix + strings.TrimPrefix(path, basePrefix)
+		if _, ok := sources[inherited]; !ok {
+			sources[inherited] = location
+		}
+	}
+}
+
+// serviceSources returns the locations of the keys of a service
+func serviceSources(sources kobject.SourceMap, service string) kobject.SourceMap {
+	prefix := "services." + service
+	serviceSources := kobject.SourceMap{}
+	for path, location := range sources {
+		if path == prefix || strings.HasPrefix(path, prefix+".") || strings.HasPrefix(path, prefix+"[") {
+			serviceSources[path] = location
+		}
+	}
+	return serviceSources
+}
+
+// sourceName returns the name of a compose file recorded in the locations of its keys: its path
+// relative to the project directory, so that the locations don't depend on where kompose is run
+func sourceName(projectDir string, file string) string {
+	if file == "-" {
+		return "stdin"
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return file
+	}
+	if rel, err := filepath.Rel(projectDir, abs); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return abs
+}
+
+// loadV1V2Sources returns the locations of the keys of v1 and v2 compose files, parsed by libcompose.
+// The services of v1 files are declared at the top level, they are located under `services` all the same.
+// Files which cannot be read are skipped, libcompose reports the errors.
+func loadV1V2Sources(files []string, projectDir string) kobject.SourceMap {
+	var sources kobject.SourceMap
+	for _, file := range files {
+		content, err := ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var document yaml.Node
+		if err := yaml.Unmarshal(content, &document); err != nil {
+			continue
+		}
+		path := ""
+		if len(document.Content) == 1 && !hasMappingKey(document.Content[0], "version") {
+			path = "services"
+		}
+		fileSources := kobject.SourceMap{}
+		collectSources(fileSources, &document, sourceName(projectDir, file), path)
+		sources = mergeSources(sources, fileSources)
+	}
+	return sources
+}
+
+// hasMappingKey reports whether node is a mapping with the given key
+func hasMappingKey(node *yaml.Node, key string) bool {
+	if node.Kind != yaml.MappingNode {
+		return false
+	}
+	for i := 0; i < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return true
+		}
+	}
+	return false
+}
+
+// setSources sets on komposeObject and its services the locations of their keys
+func setSources(komposeObject *kobject.KomposeObject, sources kobject.SourceMap) {
+	komposeObject.Sources = sources
+	for name, service := range komposeObject.ServiceConfigs {
+		service.Sources = serviceSources(sources, service.Name)
+		komposeObject.ServiceConfigs[name] = service
+	}
+}
@@ -0,0 +1,431 @@
+/*
+Copyright 2017 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package compose
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker/cli/cli/compose/loader"
+	"github.com/docker/cli/cli/compose/types"
+	"github.com/joho/godotenv"
+	"github.com/kubernetes/kompose/pkg/diagnostics"
+	"github.com/kubernetes/kompose/pkg/kobject"
+	"github.com/pkg/errors"
+)
+
+// SpecVersion is the version reported for files following the Compose Specification,
+// which made the top-level `version` key optional and informative only.
+const SpecVersion = "spec"
+
+// specLoadVersion is the docker/cli schema version used to load the Compose Specification sections
+// it understands. Schema validation is skipped, the specification being a superset of it.
+const specLoadVersion = "3.9"
+
+// specServiceKeys lists the service keys introduced by the Compose Specification
+// which are not understood by docker/cli and are handled by kompose itself.
+var specServiceKeys = []string{"profiles", "pull_policy", "dns_opt"}
+
+// specFile is a compose file loaded as a raw dictionary, together with the directory
+// its relative paths must be resolved against and the locations of its keys.
+type specFile struct {
+	Filename   string
+	WorkingDir string
+	Config     map[string]interface{}
+	Sources    kobject.SourceMap
+}
+
+// specService holds the Compose Specification keys of a service which are not part of docker/cli ServiceConfig
+type specService struct {
+	Profiles   []string
+	PullPolicy string
+	DNSOpts    []string
+}
+
+// isSpecFile reports whether a compose file without a `version` key follows the Compose Specification.
+// Version 1 files have no `version` key either, but declare their services at the top level.
+func isSpecFile(file string) (bool, error) {
+	loadedFile, err := ReadFile(file)
+	if err != nil {
+		return false, err
+	}
+	parsed, err := loader.ParseYAML(loadedFile)
+	if err != nil {
+		return false, err
+	}
+	_, ok := parsed["services"]
+	return ok, nil
+}
+
+// parseSpec loads compose files following the Compose Specification.
+// docker/cli is still used to load each section, but kompose takes care of what docker/cli
+// does not know about: the optional `version`, `include`, `extends`, long syntax `depends_on` and the
+// service keys listed in specServiceKeys.
+func parseSpec(files []string, diags *diagnostics.Collector) (kobject.KomposeObject, error) {
+	workingDir, err := getComposeFileDir(files)
+	if err != nil {
+		return kobject.KomposeObject{}, err
+	}
+
+	env, err := buildSpecEnvironment(workingDir)
+	if err != nil {
+		return kobject.KomposeObject{}, err
+	}
+
+	var specFiles []specFile
+	for _, file := range files {
+		loaded, err := loadSpecFile(file, workingDir, workingDir, map[string]bool{})
+		if err != nil {
+			return kobject.KomposeObject{}, err
+		}
+		specFiles = append(specFiles, loaded...)
+	}
+
+	// relative paths of the included files are made relative to the project directory
+	// before merging, as docker/cli resolves them against a single working directory
+	var configDict map[string]interface{}
+	var sources kobject.SourceMap
+	for _, file := range specFiles {
+		if file.WorkingDir != workingDir {
+			services, err := getServiceDicts(file.Config)
+			if err != nil {
+				return kobject.KomposeObject{}, errors.Wrapf(err, "unable to load %s", file.Filename)
+			}
+			for _, service := range services {
+				if service, ok := service.(map[string]interface{}); ok {
+					rebaseServicePaths(service, file.WorkingDir, workingDir)
+				}
+			}
+		}
+
+		configDict, err = mergeComposeDicts(configDict, file.Config)
+		if err != nil {
+			return kobject.KomposeObject{}, errors.Wrapf(err, "unable to merge %s", file.Filename)
+		}
+		sources = mergeSources(sources, file.Sources)
+	}
+	diags.SetLocator(sources.Position)
+
+	specServices := map[string]specService{}
+	if err := normalizeSpecFile(configDict, specServices); err != nil {
+		return kobject.KomposeObject{}, errors.Wrapf(err, "unable to load %s", files[0])
+	}
+
+	config, err := loader.Load(types.ConfigDetails{
+		WorkingDir:  workingDir,
+		ConfigFiles: []types.ConfigFile{{Filename: files[0], Config: configDict}},
+		Environment: env,
+	}, func(opts *loader.Options) {
+		opts.SkipValidation = true
+	})
+	if err != nil {
+		return kobject.KomposeObject{}, errors.Wrapf(err, "unable to load %s", files[0])
+	}
+
+	for _, d := range checkUnsupportedKeyForV3(config) {
+		diags.Report(d)
+	}
+
+	komposeObject, err := dockerComposeToKomposeMapping(config, diags)
+	if err != nil {
+		return kobject.KomposeObject{}, err
+	}
+
+	if err := applySpecServices(&komposeObject, specServices, diags); err != nil {
+		return kobject.KomposeObject{}, err
+	}
+	setSources(&komposeObject, sources)
+
+	return komposeObject, nil
+}
+
+// buildSpecEnvironment returns the variables used for interpolation: the `.env` file of
+// the project directory, overridden by the environment of the current process
+func buildSpecEnvironment(workingDir string) (map[string]string, error) {
+	env := map[string]string{}
+
+	dotEnv := filepath.Join(workingDir, ".env")
+	if _, err := os.Stat(dotEnv); err == nil {
+		values, err := godotenv.Read(dotEnv)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read %s", dotEnv)
+		}
+		for k, v := range values {
+			env[k] = v
+		}
+	}
+
+	osEnv, err := buildEnvironment()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot build environment variables")
+	}
+	for k, v := range osEnv {
+		env[k] = v
+	}
+	return env, nil
+}
+
+// loadSpecFile reads a compose file and the files it includes.
+// Included files come first so the including file can override them.
+// The locations of the keys name the files relative to projectDir.
+func loadSpecFile(file string, workingDir string, projectDir string, visited map[string]bool) ([]specFile, error) {
+	key := file
+	if file != "-" {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return nil, err
+		}
+		key = abs
+		workingDir = filepath.Dir(abs)
+	}
+	if visited[key] {
+		return nil, errors.Errorf("include cycle detected on %s", file)
+	}
+	visited[key] = true
+	defer delete(visited, key)
+
+	loadedFile, err := ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	parsed, sources, err := parseComposeYAML(loadedFile, sourceName(projectDir, file))
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse %s", file)
+	}
+	if err := resolveExtends(parsed, sources, file, projectDir); err != nil {
+		return nil, errors.Wrapf(err, "unable to load %s", file)
+	}
+
+	includes, err := getSpecIncludes(parsed)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid include in %s", file)
+	}
+	delete(parsed, "include")
+
+	// the services of the included files can't be redefined, unlike the ones of the files given with -f
+	var files []specFile
+	definedBy := map[string]string{}
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(workingDir, include)
+		}
+		included, err := loadSpecFile(include, workingDir, projectDir, visited)
+		if err != nil {
+			return nil, err
+		}
+		for _, includedFile := range included {
+			if err := checkIncludedServices(includedFile, definedBy); err != nil {
+				return nil, errors.Wrapf(err, "invalid include in %s", file)
+			}
+		}
+		files = append(files, included...)
+	}
+	if len(includes) > 0 {
+		if err := checkIncludedServices(specFile{Filename: file, Config: parsed}, definedBy); err != nil {
+			return nil, err
+		}
+	}
+
+	return append(files, specFile{Filename: file, WorkingDir: workingDir, Config: parsed, Sources: sources}), nil
+}
+
+// checkIncludedServices records the services of a file, and errors out on the ones another included
+// file defines already
+func checkIncludedServices(file specFile, definedBy map[string]string) error {
+	services, err := getServiceDicts(file.Config)
+	if err != nil {
+		return errors.Wrapf(err, "unable to load %s", file.Filename)
+	}
+	var names []string
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if other, ok := definedBy[name]; ok && other != file.Filename {
+			return errors.Errorf("service %s defined in %s conflicts with the one included from %s", name, file.Filename, other)
+		}
+		definedBy[name] = file.Filename
+	}
+	return nil
+}
+
+// getSpecIncludes returns the paths listed by the top-level `include` key.
+// Both the short syntax (a path) and the long syntax (a mapping with `path`) are supported.
+func getSpecIncludes(config map[string]interface{}) ([]string, error) {
+	raw, ok := config["include"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, errors.New("include must be a list")
+	}
+
+	var includes []string
+	for _, item := range list {
+		switch value := item.(type) {
+		case string:
+			includes = append(includes, value)
+		case map[string]interface{}:
+			paths, err := toStringSlice(value["path"])
+			if err != nil || len(paths) == 0 {
+				return nil, errors.New("include entry requires a path")
+			}
+			includes = append(includes, paths...)
+		default:
+			return nil, errors.Errorf("unexpected include entry %v", item)
+		}
+	}
+	return includes, nil
+}
+
+// normalizeSpecFile rewrites a Compose Specification dictionary into something docker/cli can load.
+// Keys docker/cli does not know about are moved to specServices.
+func normalizeSpecFile(config map[string]interface{}, specServices map[string]specService) error {
+	config["version"] = specLoadVersion
+	delete(config, "name")
+
+	rawServices, ok := config["services"]
+	if !ok || rawServices == nil {
+		config["services"] = map[string]interface{}{}
+		return nil
+	}
+	services, ok := rawServices.(map[string]interface{})
+	if !ok {
+		return errors.New("services must be a mapping")
+	}
+
+	for name, rawService := range services {
+		service, ok := rawService.(map[string]interface{})
+		if !ok {
+			if rawService != nil {
+				return errors.Errorf("service %s must be a mapping", name)
+			}
+			service = map[string]interface{}{}
+			services[name] = service
+		}
+
+		spec := specServices[name]
+		if profiles, ok := service["profiles"]; ok {
+			values, err := toStringSlice(profiles)
+			if err != nil {
+				return errors.Wrapf(err, "invalid profiles for service %s", name)
+			}
+			spec.Profiles = values
+		}
+		if pullPolicy, ok := service["pull_policy"]; ok {
+			spec.PullPolicy = fmt.Sprintf("%v", pullPolicy)
+		}
+		if dnsOpts, ok := service["dns_opt"]; ok {
+			values, err := toStringSlice(dnsOpts)
+			if err != nil {
+				return errors.Wrapf(err, "invalid dns_opt for service %s", name)
+			}
+			spec.DNSOpts = values
+		}
+		specServices[name] = spec
+		for _, key := range specServiceKeys {
+			delete(service, key)
+		}
+
+		// depends_on long syntax is a mapping of service name to conditions,
+		// docker/cli only understands the list of service names
+		if dependsOn, ok := service["depends_on"].(map[string]interface{}); ok {
+			var names []string
+			for dep := range dependsOn {
+				names = append(names, dep)
+			}
+			sort.Strings(names)
+			list := make([]interface{}, len(names))
+			for i, dep := range names {
+				list[i] = dep
+			}
+			service["depends_on"] = list
+		}
+	}
+	return nil
+}
+
+// applySpecServices sets on the kompose services the Compose Specification keys not handled by docker/cli
+func applySpecServices(komposeObject *kobject.KomposeObject, specServices map[string]specService, diags *diagnostics.Collector) error {
+	for name, spec := range specServices {
+		serviceName := normalizeServiceNames(name)
+		serviceConfig, ok := komposeObject.ServiceConfigs[serviceName]
+		if !ok {
+			continue
+		}
+
+		if spec.PullPolicy != "" && serviceConfig.ImagePullPolicy == "" {
+			policy, err := handlePullPolicy(spec.PullPolicy)
+			if err != nil {
+				return errors.Wrapf(err, "service %s", name)
+			}
+			if strings.ToLower(spec.PullPolicy) == "build" {
+				diags.Warnf(diagnostics.RuleUnsupportedValue, name, diagnostics.ServicePath(name, "pull_policy"), "Pull policy 'build' is not supported, the image will be pulled if not present")
+			}
+			serviceConfig.ImagePullPolicy = policy
+		}
+		serviceConfig.Profiles = spec.Profiles
+		serviceConfig.DNSOpts = spec.DNSOpts
+
+		komposeObject.ServiceConfigs[serviceName] = serviceConfig
+	}
+	return nil
+}
+
+// handlePullPolicy converts a compose `pull_policy` to a Kubernetes image pull policy.
+// The `kompose.image-pull-policy` label takes precedence when both are set.
+func handlePullPolicy(pullPolicy string) (string, error) {
+	switch strings.ToLower(pullPolicy) {
+	case "always":
+		return "Always", nil
+	case "never":
+		return "Never", nil
+	case "missing", "if_not_present":
+		return "IfNotPresent", nil
+	case "build":
+		return "IfNotPresent", nil
+	default:
+		return "", errors.New("Unknown pull_policy " + pullPolicy + ", supported values are 'always, never, missing, if_not_present or build'")
+	}
+}
+
+// toStringSlice converts a YAML string or list of strings to []string
+func toStringSlice(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		var result []string
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, errors.Errorf("%v is not a string", item)
+			}
+			result = append(result, s)
+		}
+		return result, nil
+	default:
+		return nil, errors.Errorf("%v is not a string or a list of strings", value)
+	}
+}
@@ -21,12 +21,15 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/kubernetes/kompose/pkg/kobject"
 	"github.com/pkg/errors"
 
+	batchv1 "k8s.io/api/batch/v1"
 	api "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 )
 
 const (
@@ -38,16 +41,55 @@ const (
 	LabelNodePortPort = "kompose.service.nodeport.port"
 	// LabelServiceExpose defines if the service needs to be made accessible from outside the cluster or not
 	LabelServiceExpose = "kompose.service.expose"
+	// LabelServiceExposePath defines the paths the service is exposed on, for the host names not giving one,
+	// each one routed to a port of the service, like /api:8080,/:3000
+	LabelServiceExposePath = "kompose.service.expose.path"
+	// LabelServiceExposePort defines the port of the service the exposed paths route to
+	LabelServiceExposePort = "kompose.service.expose.port"
+	// LabelServiceExposeIngressClassName defines the class of the ingress exposing the service
+	LabelServiceExposeIngressClassName = "kompose.service.expose.ingress-class-name"
+	// LabelServiceExposeAnnotationPrefix prefixes the annotations of the object exposing the service
+	LabelServiceExposeAnnotationPrefix = "kompose.service.expose.annotation."
 	// LabelServiceExposeTLSSecret provides the name of the TLS secret to use with the Kubernetes ingress controller
 	LabelServiceExposeTLSSecret = "kompose.service.expose.tls-secret"
+	// LabelServiceExposeTLSCert and LabelServiceExposeTLSKey provide the PEM files of the TLS secret generated
+	// for the exposed service, relative to the compose file
+	LabelServiceExposeTLSCert = "kompose.service.expose.tls-cert"
+	LabelServiceExposeTLSKey  = "kompose.service.expose.tls-key"
 	// LabelServiceAccountName defines the service account name to provide the credential info of the pod.
 	LabelServiceAccountName = "kompose.serviceaccount-name"
+	// LabelServiceAccountCreate generates the service account of the service
+	LabelServiceAccountCreate = "kompose.serviceaccount.create"
+	// LabelRBACRules defines the rules of the role bound to the service account, like pods,services:get,list;deployments.apps:get
+	LabelRBACRules = "kompose.rbac.rules"
+	// LabelRBACPolicyFile defines the file holding the Role or the ClusterRole bound to the service account
+	LabelRBACPolicyFile = "kompose.rbac.policy-file"
 	// LabelControllerType defines the type of controller to be created
 	LabelControllerType = "kompose.controller.type"
 	// LabelImagePullSecret defines a secret name for kubernetes ImagePullSecrets
 	LabelImagePullSecret = "kompose.image-pull-secret"
 	// LabelImagePullPolicy defines Kubernetes PodSpec imagePullPolicy.
 	LabelImagePullPolicy = "kompose.image-pull-policy"
+	// LabelCronJobSchedule defines the schedule of the cron job the service is converted to
+	LabelCronJobSchedule = "kompose.cronjob.schedule"
+	// LabelCronJobConcurrencyPolicy defines how the cron job treats concurrent runs: allow, forbid or replace
+	LabelCronJobConcurrencyPolicy = "kompose.cronjob.concurrency_policy"
+	// LabelCronJobSuccessfulJobsHistoryLimit defines the number of successful jobs the cron job keeps
+	LabelCronJobSuccessfulJobsHistoryLimit = "kompose.cronjob.successful_jobs_history_limit"
+	// LabelCronJobFailedJobsHistoryLimit defines the number of failed jobs the cron job keeps
+	LabelCronJobFailedJobsHistoryLimit = "kompose.cronjob.failed_jobs_history_limit"
+	// LabelHPAMinReplicas defines the minimum number of replicas of the horizontal pod autoscaler
+	LabelHPAMinReplicas = "kompose.hpa.replicas.min"
+	// LabelHPAMaxReplicas defines the maximum number of replicas of the horizontal pod autoscaler
+	LabelHPAMaxReplicas = "kompose.hpa.replicas.max"
+	// LabelHPACPU defines the target average CPU utilization of the horizontal pod autoscaler, in percent of the requests
+	LabelHPACPU = "kompose.hpa.cpu"
+	// LabelHPAMemory defines the target average memory utilization of the horizontal pod autoscaler, in percent of the requests
+	LabelHPAMemory = "kompose.hpa.memory"
+	// LabelPDBMinAvailable defines the number or the percentage of the pods kept available by the pod disruption budget
+	LabelPDBMinAvailable = "kompose.pdb.min-available"
+	// LabelPDBMaxUnavailable defines the number or the percentage of the pods the pod disruption budget allows to be unavailable
+	LabelPDBMaxUnavailable = "kompose.pdb.max-unavailable"
 	// HealthCheckReadinessDisable defines readiness health check disable
 	HealthCheckReadinessDisable = "kompose.service.healthcheck.readiness.disable"
 	// HealthCheckReadinessTest defines readiness health check test
@@ -141,6 +183,155 @@ func handleServiceType(ServiceType string) (string, error) {
 	}
 }
 
+// handleExposePaths returns the paths given by the kompose.service.expose.path label, separated by
+// commas, each one optionally followed by the port it routes to, as in /api:8080
+func handleExposePaths(value string) ([]kobject.ExposePath, error) {
+	var paths []kobject.ExposePath
+	for _, item := range splitList(value) {
+		path := kobject.ExposePath{Path: item}
+		if i := strings.LastIndex(item, ":"); i >= 0 {
+			port, err := handleExposePort(item[i+1:])
+			if err != nil {
+				return nil, errors.Errorf("%s %q must be a path followed by a port, like /api:8080", LabelServiceExposePath, item)
+			}
+			path = kobject.ExposePath{Path: item[:i], Port: port}
+		}
+		if !strings.HasPrefix(path.Path, "/") {
+			return nil, errors.Errorf("%s must be an absolute path, got %q", LabelServiceExposePath, path.Path)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// handleExposePort returns the port number given by a kompose.service.expose label
+func handleExposePort(value string) (int32, error) {
+	port, err := strconv.ParseInt(strings.TrimSpace(value), 10, 32)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, errors.Errorf("invalid port %q", value)
+	}
+	return int32(port), nil
+}
+
+// handleHPALabel returns the positive number given by a label of the horizontal pod autoscaler.
+// The utilization targets may end with %.
+func handleHPALabel(key string, value string) (int32, error) {
+	value = strings.TrimSpace(value)
+	if key == LabelHPACPU || key == LabelHPAMemory {
+		value = strings.TrimSuffix(value, "%")
+	}
+	number, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || number < 1 {
+		return 0, errors.Errorf("%s must be a number greater than 0, got %q", key, value)
+	}
+	return int32(number), nil
+}
+
+// checkHPA checks the labels of the horizontal pod autoscaler of a service. The utilization of a
+// resource is relative to its request, so the service has to reserve the resources it is scaled on:
+// Kubernetes requests the limit of a resource if no reservation is given.
+func checkHPA(serviceConfig *kobject.ServiceConfig) error {
+	if serviceConfig.HPAMaxReplicas == 0 {
+		if serviceConfig.HPAMinReplicas != nil || serviceConfig.HPACPU != 0 || serviceConfig.HPAMemory != 0 {
+			return errors.New("kompose.hpa labels were specified without kompose.hpa.replicas.max")
+		}
+		return nil
+	}
+	if min := serviceConfig.HPAMinReplicas; min != nil && *min > serviceConfig.HPAMaxReplicas {
+		return errors.Errorf("kompose.hpa.replicas.min %d is greater than kompose.hpa.replicas.max %d", *min, serviceConfig.HPAMaxReplicas)
+	}
+	// without a target, the autoscaler scales on the utilization of the CPU
+	if (serviceConfig.HPACPU != 0 || serviceConfig.HPAMemory == 0) && serviceConfig.CPUReservation == 0 && serviceConfig.CPULimit == 0 {
+		return errors.New("kompose.hpa requires a CPU reservation to scale on the CPU utilization")
+	}
+	if serviceConfig.HPAMemory != 0 && serviceConfig.MemReservation == 0 && serviceConfig.MemLimit == 0 {
+		return errors.New("kompose.hpa.memory requires a memory reservation to scale on the memory utilization")
+	}
+	return nil
+}
+
+// handlePDBLabel returns the number, or the percentage, of pods given by a label of the pod disruption budget
+func handlePDBLabel(key string, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	number, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+	if err != nil || number < 0 || (strings.HasSuffix(value, "%") && number > 100) {
+		return "", errors.Errorf("%s must be a number of pods or a percentage, got %q", key, value)
+	}
+	return value, nil
+}
+
+// handleRBACRules returns the policy rules given by the compact syntax of the kompose.rbac.rules label:
+// rules separated by ;, each one listing resources and verbs, separated by :, like pods,services:get,list.
+// A resource out of the core API group is suffixed by its group, as in deployments.apps.
+func handleRBACRules(value string) ([]rbacv1.PolicyRule, error) {
+	var rules []rbacv1.PolicyRule
+	for _, rule := range strings.Split(value, ";") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		parts := strings.Split(rule, ":")
+		if len(parts) != 2 {
+			return nil, errors.Errorf("%s rule %q must be resources:verbs", LabelRBACRules, strings.TrimSpace(rule))
+		}
+		verbs := splitList(parts[1])
+		resources := splitList(parts[0])
+		if len(verbs) == 0 || len(resources) == 0 {
+			return nil, errors.Errorf("%s rule %q must list resources and verbs", LabelRBACRules, strings.TrimSpace(rule))
+		}
+
+		// a rule grants its verbs on all its resources in all its groups, so a rule is
+		// generated by group
+		var groups []string
+		resourcesByGroup := map[string][]string{}
+		for _, resource := range resources {
+			group := ""
+			if i := strings.Index(resource, "."); i >= 0 {
+				resource, group = resource[:i], resource[i+1:]
+			}
+			if _, ok := resourcesByGroup[group]; !ok {
+				groups = append(groups, group)
+			}
+			resourcesByGroup[group] = append(resourcesByGroup[group], resource)
+		}
+		for _, group := range groups {
+			rules = append(rules, rbacv1.PolicyRule{
+				APIGroups: []string{group},
+				Resources: resourcesByGroup[group],
+				Verbs:     verbs,
+			})
+		}
+	}
+	if len(rules) == 0 {
+		return nil, errors.Errorf("%s doesn't define any rule", LabelRBACRules)
+	}
+	return rules, nil
+}
+
+// splitList returns the non empty items of a comma separated list
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// handleConcurrencyPolicy returns the concurrency policy of a cron job given by the label
+func handleConcurrencyPolicy(policy string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(policy)) {
+	case "allow":
+		return string(batchv1.AllowConcurrent), nil
+	case "forbid":
+		return string(batchv1.ForbidConcurrent), nil
+	case "replace":
+		return string(batchv1.ReplaceConcurrent), nil
+	default:
+		return "", errors.New("Unknown value " + policy + " , supported values are 'allow, forbid or replace'")
+	}
+}
+
 func normalizeContainerNames(svcName string) string {
 	return strings.ToLower(svcName)
 }
@@ -150,6 +341,15 @@ func normalizeServiceNames(svcName string) string {
 	return strings.ToLower(re.ReplaceAllString(svcName, "-"))
 }
 
+// handleNetworkMode returns the network_mode of a service, the service given as service:<name> being
+// named like the services
+func handleNetworkMode(mode string) string {
+	if strings.HasPrefix(mode, "service:") {
+		return "service:" + normalizeServiceNames(strings.TrimPrefix(mode, "service:"))
+	}
+	return mode
+}
+
 func normalizeVolumes(svcName string) string {
 	return strings.Replace(svcName, "_", "-", -1)
 }
@@ -30,6 +30,7 @@ import (
 	"github.com/docker/libcompose/config"
 	"github.com/docker/libcompose/lookup"
 	"github.com/docker/libcompose/project"
+	"github.com/kubernetes/kompose/pkg/diagnostics"
 	"github.com/kubernetes/kompose/pkg/kobject"
 	"github.com/kubernetes/kompose/pkg/transformer"
 	"github.com/pkg/errors"
@@ -40,7 +41,7 @@ import (
 
 // Parse Docker Compose with libcompose (only supports v1 and v2). Eventually we will
 // switch to using only libcompose once v3 is supported.
-func parseV1V2(files []string) (kobject.KomposeObject, error) {
+func parseV1V2(files []string, diags *diagnostics.Collector) (kobject.KomposeObject, error) {
 	// Gather the appropriate context for parsing
 	context := &project.Context{}
 	context.ComposeFiles = files
@@ -71,16 +72,23 @@ func parseV1V2(files []string) (kobject.KomposeObject, error) {
 		return kobject.KomposeObject{}, errors.Wrap(err, "composeObject.Parse() failed, Failed to load compose file")
 	}
 
-	noSupKeys := checkUnsupportedKey(composeObject)
-	for _, keyName := range noSupKeys {
-		log.Warningf("Unsupported %s key - ignoring", keyName)
+	workingDir, err := getComposeFileDir(files)
+	if err != nil {
+		return kobject.KomposeObject{}, err
+	}
+	sources := loadV1V2Sources(files, workingDir)
+	diags.SetLocator(sources.Position)
+
+	for _, d := range checkUnsupportedKey(composeObject) {
+		diags.Report(d)
 	}
 
 	// Map the parsed struct to a struct we understand (kobject)
-	komposeObject, err := libComposeToKomposeMapping(composeObject)
+	komposeObject, err := libComposeToKomposeMapping(composeObject, diags)
 	if err != nil {
 		return kobject.KomposeObject{}, err
 	}
+	setSources(&komposeObject, sources)
 
 	return komposeObject, nil
 }
@@ -158,6 +166,7 @@ func loadPorts(composePorts []string, expose []string) ([]kobject.Ports, error)
 				kp = append(kp, kobject.Ports{
 					ContainerPort: cast.ToInt32(portValue),
 					Protocol:      strings.ToUpper(protocol),
+					Exposed:       true,
 				})
 			}
 		}
@@ -167,7 +176,7 @@ func loadPorts(composePorts []string, expose []string) ([]kobject.Ports, error)
 }
 
 // Uses libcompose's APIProject type and converts it to a Kompose object for us to understand
-func libComposeToKomposeMapping(composeObject *project.Project) (kobject.KomposeObject, error) {
+func libComposeToKomposeMapping(composeObject *project.Project, diags *diagnostics.Collector) (kobject.KomposeObject, error) {
 	// Initialize what's going to be returned
 	komposeObject := kobject.KomposeObject{
 		ServiceConfigs: make(map[string]kobject.ServiceConfig),
@@ -188,18 +197,28 @@ func libComposeToKomposeMapping(composeObject *project.Project) (kobject.Kompose
 		}
 		serviceConfig.Command = composeServiceConfig.Entrypoint
 		serviceConfig.HostName = composeServiceConfig.Hostname
+		serviceConfig.NetworkMode = handleNetworkMode(composeServiceConfig.NetworkMode)
+		serviceConfig.ExtraHosts = composeServiceConfig.ExtraHosts
+		serviceConfig.DNS = composeServiceConfig.DNS
+		serviceConfig.DNSSearch = composeServiceConfig.DNSSearch
+		serviceConfig.DNSOpts = composeServiceConfig.DNSOpts
+		serviceConfig.ReadOnly = composeServiceConfig.ReadOnly
+		serviceConfig.SecurityOpt = composeServiceConfig.SecurityOpt
 		serviceConfig.DomainName = composeServiceConfig.DomainName
 		serviceConfig.Args = composeServiceConfig.Command
 		serviceConfig.Dockerfile = composeServiceConfig.Build.Dockerfile
 		serviceConfig.BuildArgs = composeServiceConfig.Build.Args
 		serviceConfig.Expose = composeServiceConfig.Expose
+		for _, dep := range composeServiceConfig.DependsOn {
+			serviceConfig.DependsOn = append(serviceConfig.DependsOn, normalizeServiceNames(dep))
+		}
 
 		envs := loadEnvVars(composeServiceConfig.Environment)
 		serviceConfig.Environment = envs
 
 		// Validate dockerfile path
 		if filepath.IsAbs(serviceConfig.Dockerfile) {
-			log.Fatalf("%q defined in service %q is an absolute path, it must be a relative path.", serviceConfig.Dockerfile, name)
+			return kobject.KomposeObject{}, fmt.Errorf("%q defined in service %q is an absolute path, it must be a relative path", serviceConfig.Dockerfile, name)
 		}
 
 		// load ports, same as v3, we also load `expose`
@@ -236,6 +255,8 @@ func libComposeToKomposeMapping(composeObject *project.Project) (kobject.Kompose
 		serviceConfig.CapAdd = composeServiceConfig.CapAdd
 		serviceConfig.CapDrop = composeServiceConfig.CapDrop
 		serviceConfig.Pid = composeServiceConfig.Pid
+		serviceConfig.Ipc = handleNetworkMode(composeServiceConfig.Ipc)
+		serviceConfig.ShmSize = composeServiceConfig.ShmSize
 
 		serviceConfig.Privileged = composeServiceConfig.Privileged
 		serviceConfig.User = composeServiceConfig.User
@@ -243,26 +264,29 @@ func libComposeToKomposeMapping(composeObject *project.Project) (kobject.Kompose
 		serviceConfig.Stdin = composeServiceConfig.StdinOpen
 		serviceConfig.Tty = composeServiceConfig.Tty
 		serviceConfig.MemLimit = composeServiceConfig.MemLimit
+		if err := checkHPA(&serviceConfig); err != nil {
+			return kobject.KomposeObject{}, err
+		}
 		serviceConfig.TmpFs = composeServiceConfig.Tmpfs
 		serviceConfig.StopGracePeriod = composeServiceConfig.StopGracePeriod
 
 		// pretty much same as v3
 		serviceConfig.Restart = composeServiceConfig.Restart
 		if serviceConfig.Restart == "unless-stopped" {
-			log.Warnf("Restart policy 'unless-stopped' in service %s is not supported, convert it to 'always'", name)
+			diags.Warnf(diagnostics.RuleRestartPolicy, name, diagnostics.ServicePath(name, "restart"), "Restart policy 'unless-stopped' in service %s is not supported, convert it to 'always'", name)
 			serviceConfig.Restart = "always"
 		}
 
 		if composeServiceConfig.Networks != nil {
 			if len(composeServiceConfig.Networks.Networks) > 0 {
-				for _, value := range composeServiceConfig.Networks.Networks {
+				for i, value := range composeServiceConfig.Networks.Networks {
 					if value.Name != "default" {
 						nomalizedNetworkName, err := normalizeNetworkNames(value.RealName)
 						if err != nil {
 							return kobject.KomposeObject{}, errors.Wrap(err, "Error trying to normalize network names")
 						}
 						if nomalizedNetworkName != value.RealName {
-							log.Warnf("Network name in docker-compose has been changed from %q to %q", value.RealName, nomalizedNetworkName)
+							diags.Warnf(diagnostics.RuleRenamedNetwork, name, diagnostics.ServicePath(name, fmt.Sprintf("networks[%d]", i)), "Network name in docker-compose has been changed from %q to %q", value.RealName, nomalizedNetworkName)
 						}
 						serviceConfig.Network = append(serviceConfig.Network, nomalizedNetworkName)
 					}
@@ -278,7 +302,7 @@ func libComposeToKomposeMapping(composeObject *project.Project) (kobject.Kompose
 
 		komposeObject.ServiceConfigs[normalizeServiceNames(name)] = serviceConfig
 		if normalizeServiceNames(name) != name {
-			log.Infof("Service name in docker-compose has been changed from %q to %q", name, normalizeServiceNames(name))
+			diags.Infof(diagnostics.RuleRenamedService, name, diagnostics.ServicePath(name, ""), "Service name in docker-compose has been changed from %q to %q", name, normalizeServiceNames(name))
 		}
 	}
 
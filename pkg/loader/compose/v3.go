@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -32,11 +33,12 @@ import (
 
 	"github.com/docker/cli/cli/compose/loader"
 	"github.com/docker/cli/cli/compose/types"
+	units "github.com/docker/go-units"
 
 	"github.com/google/shlex"
+	"github.com/kubernetes/kompose/pkg/diagnostics"
 	"github.com/kubernetes/kompose/pkg/kobject"
 	"github.com/pkg/errors"
-	log "github.com/sirupsen/logrus"
 )
 
 // converts os.Environ() ([]string) to map[string]string
@@ -58,7 +60,7 @@ func buildEnvironment() (map[string]string, error) {
 // The purpose of this is not to deploy, but to be able to parse
 // v3 of Docker Compose into a suitable format. In this case, whatever is returned
 // by docker/cli's ServiceConfig
-func parseV3(files []string) (kobject.KomposeObject, error) {
+func parseV3(files []string, diags *diagnostics.Collector) (kobject.KomposeObject, error) {
 	// In order to get V3 parsing to work, we have to go through some preliminary steps
 	// for us to hack up github.com/docker/cli in order to correctly convert to a kobject.KomposeObject
 
@@ -74,7 +76,10 @@ func parseV3(files []string) (kobject.KomposeObject, error) {
 		return kobject.KomposeObject{}, errors.Wrap(err, "cannot build environment variables")
 	}
 
-	var config *types.Config
+	// Files are merged before being loaded, so the resulting configuration
+	// follows the same override rules as docker compose
+	var configDict map[string]interface{}
+	var sources kobject.SourceMap
 	for _, file := range files {
 		// Load and then parse the YAML first!
 		loadedFile, err := ReadFile(file)
@@ -83,71 +88,76 @@ func parseV3(files []string) (kobject.KomposeObject, error) {
 		}
 
 		// Parse the Compose File
-		parsedComposeFile, err := loader.ParseYAML(loadedFile)
+		parsedComposeFile, fileSources, err := parseComposeYAML(loadedFile, sourceName(workingDir, file))
 		if err != nil {
 			return kobject.KomposeObject{}, err
 		}
 
-		// Config file
-		configFile := types.ConfigFile{
-			Filename: file,
-			Config:   parsedComposeFile,
+		// docker/cli does not know about extends, resolve it before loading
+		if err := resolveExtends(parsedComposeFile, fileSources, file, workingDir); err != nil {
+			return kobject.KomposeObject{}, errors.Wrapf(err, "unable to load %s", file)
 		}
 
-		// Config details
-		configDetails := types.ConfigDetails{
-			WorkingDir:  workingDir,
-			ConfigFiles: []types.ConfigFile{configFile},
-			Environment: env,
-		}
-
-		// Actual config
-		// We load it in order to retrieve the parsed output configuration!
-		// This will output a github.com/docker/cli ServiceConfig
-		// Which is similar to our version of ServiceConfig
-		currentConfig, err := loader.Load(configDetails)
+		configDict, err = mergeComposeDicts(configDict, parsedComposeFile)
 		if err != nil {
-			return kobject.KomposeObject{}, err
-		}
-		if config == nil {
-			config = currentConfig
-		} else {
-			config, err = mergeComposeObject(config, currentConfig)
-			if err != nil {
-				return kobject.KomposeObject{}, err
-			}
+			return kobject.KomposeObject{}, errors.Wrapf(err, "unable to merge %s", file)
 		}
+		sources = mergeSources(sources, fileSources)
+	}
+	diags.SetLocator(sources.Position)
+
+	// Config file
+	configFile := types.ConfigFile{
+		Filename: files[0],
+		Config:   configDict,
 	}
 
-	noSupKeys := checkUnsupportedKeyForV3(config)
-	for _, keyName := range noSupKeys {
-		log.Warningf("Unsupported %s key - ignoring", keyName)
+	// Config details
+	configDetails := types.ConfigDetails{
+		WorkingDir:  workingDir,
+		ConfigFiles: []types.ConfigFile{configFile},
+		Environment: env,
+	}
+
+	// Actual config
+	// We load it in order to retrieve the parsed output configuration!
+	// This will output a github.com/docker/cli ServiceConfig
+	// Which is similar to our version of ServiceConfig
+	config, err := loader.Load(configDetails)
+	if err != nil {
+		return kobject.KomposeObject{}, err
+	}
+
+	for _, d := range checkUnsupportedKeyForV3(config) {
+		diags.Report(d)
 	}
 
 	// Finally, we convert the object from docker/cli's ServiceConfig to our appropriate one
-	komposeObject, err := dockerComposeToKomposeMapping(config)
+	komposeObject, err := dockerComposeToKomposeMapping(config, diags)
 	if err != nil {
 		return kobject.KomposeObject{}, err
 	}
+	setSources(&komposeObject, sources)
 
 	return komposeObject, nil
 }
 
-func loadV3Placement(placement types.Placement) kobject.Placement {
+func loadV3Placement(name string, placement types.Placement, diags *diagnostics.Collector) kobject.Placement {
 	komposePlacement := kobject.Placement{
 		PositiveConstraints: make(map[string]string),
 		NegativeConstraints: make(map[string]string),
 	}
 	equal, notEqual := " == ", " != "
 	errMsg := " constraints in placement is not supported, only 'node.hostname', 'engine.labels.operatingsystem' and 'node.labels.xxx' (ex: node.labels.something == anything) is supported as a constraint "
-	for _, j := range placement.Constraints {
+	for i, j := range placement.Constraints {
+		path := diagnostics.ServicePath(name, fmt.Sprintf("deploy.placement.constraints[%d]", i))
 		operator := equal
 		if strings.Contains(j, notEqual) {
 			operator = notEqual
 		}
 		p := strings.Split(j, operator)
 		if len(p) < 2 {
-			log.Warn(p[0], errMsg)
+			diags.Warnf(diagnostics.RuleUnsupportedValue, name, path, "%s%s", p[0], errMsg)
 			continue
 		}
 
@@ -159,7 +169,7 @@ func loadV3Placement(placement types.Placement) kobject.Placement {
 		} else if strings.HasPrefix(p[0], "node.labels.") {
 			key = strings.TrimPrefix(p[0], "node.labels.")
 		} else {
-			log.Warn(p[0], errMsg)
+			diags.Warnf(diagnostics.RuleUnsupportedValue, name, path, "%s%s", p[0], errMsg)
 			continue
 		}
 
@@ -234,6 +244,7 @@ func loadV3Ports(ports []types.ServicePortConfig, expose []string) []kobject.Por
 				ContainerPort: cast.ToInt32(portValue),
 				HostIP:        "",
 				Protocol:      strings.ToUpper(protocol),
+				Exposed:       true,
 			})
 		}
 	}
@@ -363,12 +374,20 @@ func parseHealthCheck(composeHealthCheck types.HealthCheckConfig, labels types.L
 	}, nil
 }
 
-func dockerComposeToKomposeMapping(composeObject *types.Config) (kobject.KomposeObject, error) {
+func dockerComposeToKomposeMapping(composeObject *types.Config, diags *diagnostics.Collector) (kobject.KomposeObject, error) {
 	// Step 1. Initialize what's going to be returned
 	komposeObject := kobject.KomposeObject{
 		ServiceConfigs: make(map[string]kobject.ServiceConfig),
 		LoadedFrom:     "compose",
 		Secrets:        composeObject.Secrets,
+		Networks:       map[string]types.NetworkConfig{},
+	}
+	for key, network := range composeObject.Networks {
+		// the services refer to the networks by name, the key when the name isn't given
+		if network.Name == "" {
+			network.Name = key
+		}
+		komposeObject.Networks[network.Name] = network
 	}
 
 	// Step 2. Parse through the object and convert it to kobject.KomposeObject!
@@ -396,8 +415,20 @@ func dockerComposeToKomposeMapping(composeObject *types.Config) (kobject.Kompose
 		serviceConfig.Args = composeServiceConfig.Command
 		serviceConfig.Labels = composeServiceConfig.Labels
 		serviceConfig.HostName = composeServiceConfig.Hostname
+		serviceConfig.NetworkMode = handleNetworkMode(composeServiceConfig.NetworkMode)
+		serviceConfig.ExtraHosts = composeServiceConfig.ExtraHosts
+		serviceConfig.DNS = composeServiceConfig.DNS
+		serviceConfig.DNSSearch = composeServiceConfig.DNSSearch
+		serviceConfig.ReadOnly = composeServiceConfig.ReadOnly
+		serviceConfig.SecurityOpt = composeServiceConfig.SecurityOpt
+		serviceConfig.Sysctls = composeServiceConfig.Sysctls
+		serviceConfig.Pid = composeServiceConfig.Pid
+		serviceConfig.Ipc = handleNetworkMode(composeServiceConfig.Ipc)
 		serviceConfig.DomainName = composeServiceConfig.DomainName
 		serviceConfig.Secrets = composeServiceConfig.Secrets
+		for _, dep := range composeServiceConfig.DependsOn {
+			serviceConfig.DependsOn = append(serviceConfig.DependsOn, normalizeServiceNames(dep))
+		}
 
 		if composeServiceConfig.StopGracePeriod != nil {
 			serviceConfig.StopGracePeriod = composeServiceConfig.StopGracePeriod.String()
@@ -409,6 +440,14 @@ func dockerComposeToKomposeMapping(composeObject *types.Config) (kobject.Kompose
 			return kobject.KomposeObject{}, err
 		}
 
+		if composeServiceConfig.ShmSize != "" {
+			shmSize, err := units.RAMInBytes(composeServiceConfig.ShmSize)
+			if err != nil {
+				return kobject.KomposeObject{}, errors.Wrapf(err, "invalid shm_size %q of service %s", composeServiceConfig.ShmSize, name)
+			}
+			serviceConfig.ShmSize = libcomposeyaml.MemStringorInt(shmSize)
+		}
+
 		// Deploy keys
 		// mode:
 		serviceConfig.DeployMode = composeServiceConfig.Deploy.Mode
@@ -436,11 +475,14 @@ func dockerComposeToKomposeMapping(composeObject *types.Config) (kobject.Kompose
 		// restart-policy: deploy.restart_policy.condition will rewrite restart option
 		// see: https://docs.docker.com/compose/compose-file/#restart_policy
 		serviceConfig.Restart = composeServiceConfig.Restart
+		restartPath := "restart"
 		if composeServiceConfig.Deploy.RestartPolicy != nil {
 			serviceConfig.Restart = composeServiceConfig.Deploy.RestartPolicy.Condition
+			serviceConfig.DeployRestartPolicy = *composeServiceConfig.Deploy.RestartPolicy
+			restartPath = "deploy.restart_policy.condition"
 		}
 		if serviceConfig.Restart == "unless-stopped" {
-			log.Warnf("Restart policy 'unless-stopped' in service %s is not supported, convert it to 'always'", name)
+			diags.Warnf(diagnostics.RuleRestartPolicy, name, diagnostics.ServicePath(name, restartPath), "Restart policy 'unless-stopped' in service %s is not supported, convert it to 'always'", name)
 			serviceConfig.Restart = "always"
 		}
 
@@ -450,7 +492,7 @@ func dockerComposeToKomposeMapping(composeObject *types.Config) (kobject.Kompose
 		}
 
 		// placement:
-		serviceConfig.Placement = loadV3Placement(composeServiceConfig.Deploy.Placement)
+		serviceConfig.Placement = loadV3Placement(name, composeServiceConfig.Deploy.Placement, diags)
 
 		if composeServiceConfig.Deploy.UpdateConfig != nil {
 			serviceConfig.DeployUpdateConfig = *composeServiceConfig.Deploy.UpdateConfig
@@ -485,10 +527,13 @@ func dockerComposeToKomposeMapping(composeObject *types.Config) (kobject.Kompose
 		if err := parseKomposeLabels(composeServiceConfig.Labels, &serviceConfig); err != nil {
 			return kobject.KomposeObject{}, err
 		}
+		if err := checkHPA(&serviceConfig); err != nil {
+			return kobject.KomposeObject{}, err
+		}
 
 		// Log if the name will been changed
 		if normalizeServiceNames(name) != name {
-			log.Infof("Service name in docker-compose has been changed from %q to %q", name, normalizeServiceNames(name))
+			diags.Infof(diagnostics.RuleRenamedService, name, diagnostics.ServicePath(name, ""), "Service name in docker-compose has been changed from %q to %q", name, normalizeServiceNames(name))
 		}
 
 		serviceConfig.Configs = composeServiceConfig.Configs
@@ -537,6 +582,7 @@ func parseV3Network(composeServiceConfig *types.ServiceConfig, serviceConfig *ko
 			}
 			serviceConfig.Network = append(serviceConfig.Network, netName)
 		}
+		sort.Strings(serviceConfig.Network)
 	}
 }
 
@@ -595,6 +641,9 @@ func parseV3Environment(composeServiceConfig *types.ServiceConfig, serviceConfig
 		}
 		serviceConfig.Environment = append(serviceConfig.Environment, env)
 	}
+	sort.Slice(serviceConfig.Environment, func(i, j int) bool {
+		return serviceConfig.Environment[i].Name < serviceConfig.Environment[j].Name
+	})
 }
 
 // parseKomposeLabels parse kompose labels, also do some validation
@@ -620,13 +669,96 @@ func parseKomposeLabels(labels map[string]string, serviceConfig *kobject.Service
 			serviceConfig.ExposeService = strings.Trim(strings.ToLower(value), " ,")
 		case LabelNodePortPort:
 			serviceConfig.NodePortPort = cast.ToInt32(value)
+		case LabelServiceExposePath:
+			paths, err := handleExposePaths(value)
+			if err != nil {
+				return errors.Wrap(err, "handleExposePaths failed")
+			}
+			serviceConfig.ExposeServicePath = paths
+		case LabelServiceExposePort:
+			port, err := handleExposePort(value)
+			if err != nil {
+				return errors.Wrapf(err, "%s must be a port of the service", key)
+			}
+			serviceConfig.ExposeServicePort = port
+		case LabelServiceExposeIngressClassName:
+			serviceConfig.ExposeIngressClassName = strings.TrimSpace(value)
 		case LabelServiceExposeTLSSecret:
 			serviceConfig.ExposeServiceTLS = value
+		case LabelServiceExposeTLSCert:
+			serviceConfig.ExposeTLSCert = strings.TrimSpace(value)
+		case LabelServiceExposeTLSKey:
+			serviceConfig.ExposeTLSKey = strings.TrimSpace(value)
 		case LabelImagePullSecret:
 			serviceConfig.ImagePullSecret = value
 		case LabelImagePullPolicy:
 			serviceConfig.ImagePullPolicy = value
+		case LabelCronJobSchedule:
+			serviceConfig.CronJobSchedule = strings.TrimSpace(value)
+		case LabelCronJobConcurrencyPolicy:
+			policy, err := handleConcurrencyPolicy(value)
+			if err != nil {
+				return errors.Wrap(err, "handleConcurrencyPolicy failed")
+			}
+			serviceConfig.CronJobConcurrencyPolicy = policy
+		case LabelHPAMinReplicas, LabelHPAMaxReplicas, LabelHPACPU, LabelHPAMemory:
+			number, err := handleHPALabel(key, value)
+			if err != nil {
+				return errors.Wrap(err, "handleHPALabel failed")
+			}
+			switch key {
+			case LabelHPAMinReplicas:
+				serviceConfig.HPAMinReplicas = &number
+			case LabelHPAMaxReplicas:
+				serviceConfig.HPAMaxReplicas = number
+			case LabelHPACPU:
+				serviceConfig.HPACPU = number
+			case LabelHPAMemory:
+				serviceConfig.HPAMemory = number
+			}
+		case LabelPDBMinAvailable, LabelPDBMaxUnavailable:
+			pods, err := handlePDBLabel(key, value)
+			if err != nil {
+				return errors.Wrap(err, "handlePDBLabel failed")
+			}
+			if key == LabelPDBMinAvailable {
+				serviceConfig.PDBMinAvailable = pods
+			} else {
+				serviceConfig.PDBMaxUnavailable = pods
+			}
+		case LabelServiceAccountCreate:
+			create, err := strconv.ParseBool(strings.TrimSpace(value))
+			if err != nil {
+				return errors.Errorf("%s must be true or false, got %q", key, value)
+			}
+			serviceConfig.ServiceAccountCreate = create
+		case LabelRBACRules:
+			rules, err := handleRBACRules(value)
+			if err != nil {
+				return errors.Wrap(err, "handleRBACRules failed")
+			}
+			serviceConfig.RBACRules = rules
+		case LabelRBACPolicyFile:
+			serviceConfig.RBACPolicyFile = strings.TrimSpace(value)
+		case LabelCronJobSuccessfulJobsHistoryLimit, LabelCronJobFailedJobsHistoryLimit:
+			limit, err := strconv.ParseInt(strings.TrimSpace(value), 10, 32)
+			if err != nil || limit < 0 {
+				return errors.Errorf("%s must be a positive number, got %q", key, value)
+			}
+			l := int32(limit)
+			if key == LabelCronJobSuccessfulJobsHistoryLimit {
+				serviceConfig.CronJobSuccessfulJobsHistoryLimit = &l
+			} else {
+				serviceConfig.CronJobFailedJobsHistoryLimit = &l
+			}
 		default:
+			if strings.HasPrefix(key, LabelServiceExposeAnnotationPrefix) {
+				if serviceConfig.ExposeAnnotations == nil {
+					serviceConfig.ExposeAnnotations = map[string]string{}
+				}
+				serviceConfig.ExposeAnnotations[strings.TrimPrefix(key, LabelServiceExposeAnnotationPrefix)] = value
+				continue
+			}
 			serviceConfig.Labels[key] = value
 		}
 	}
@@ -635,6 +767,29 @@ func parseKomposeLabels(labels map[string]string, serviceConfig *kobject.Service
 		return errors.New("kompose.service.expose.tls-secret was specified without kompose.service.expose")
 	}
 
+	if serviceConfig.ExposeService == "" && (len(serviceConfig.ExposeServicePath) > 0 || serviceConfig.ExposeServicePort != 0 ||
+		serviceConfig.ExposeIngressClassName != "" || len(serviceConfig.ExposeAnnotations) > 0 ||
+		serviceConfig.ExposeTLSCert != "" || serviceConfig.ExposeTLSKey != "") {
+		return errors.New("kompose.service.expose labels were specified without kompose.service.expose")
+	}
+
+	if (serviceConfig.ExposeTLSCert == "") != (serviceConfig.ExposeTLSKey == "") {
+		return errors.New("kompose.service.expose.tls-cert and kompose.service.expose.tls-key must be set together")
+	}
+
+	if len(serviceConfig.RBACRules) > 0 && serviceConfig.RBACPolicyFile != "" {
+		return errors.New("kompose.rbac.rules and kompose.rbac.policy-file can't be set at the same time")
+	}
+
+	if serviceConfig.PDBMinAvailable != "" && serviceConfig.PDBMaxUnavailable != "" {
+		return errors.New("kompose.pdb.min-available and kompose.pdb.max-unavailable can't be set at the same time")
+	}
+
+	if serviceConfig.CronJobSchedule == "" && (serviceConfig.CronJobConcurrencyPolicy != "" ||
+		serviceConfig.CronJobSuccessfulJobsHistoryLimit != nil || serviceConfig.CronJobFailedJobsHistoryLimit != nil) {
+		return errors.New("kompose.cronjob labels were specified without kompose.cronjob.schedule")
+	}
+
 	if serviceConfig.ServiceType != string(api.ServiceTypeNodePort) && serviceConfig.NodePortPort != 0 {
 		return errors.New("kompose.service.type must be nodeport when assign node port value")
 	}
@@ -686,264 +841,44 @@ func getV3VolumeLabels(name string, volumes *map[string]types.VolumeConfig) (str
 	return size, selector
 }
 
-func mergeComposeObject(oldCompose *types.Config, newCompose *types.Config) (*types.Config, error) {
-	if oldCompose == nil || newCompose == nil {
-		return nil, fmt.Errorf("merge multiple compose error, compose config is nil")
-	}
-	oldComposeServiceNameMap := make(map[string]int, len(oldCompose.Services))
-	for index, service := range oldCompose.Services {
-		oldComposeServiceNameMap[service.Name] = index
-	}
-
-	for _, service := range newCompose.Services {
-		index := 0
-		if tmpIndex, ok := oldComposeServiceNameMap[service.Name]; !ok {
-			oldCompose.Services = append(oldCompose.Services, service)
-			continue
-		} else {
-			index = tmpIndex
-		}
-		tmpOldService := oldCompose.Services[index]
-		if service.Build.Dockerfile != "" {
-			tmpOldService.Build = service.Build
-		}
-		if len(service.CapAdd) != 0 {
-			tmpOldService.CapAdd = service.CapAdd
-		}
-		if len(service.CapDrop) != 0 {
-			tmpOldService.CapDrop = service.CapDrop
-		}
-		if service.CgroupParent != "" {
-			tmpOldService.CgroupParent = service.CgroupParent
-		}
-		if len(service.Command) != 0 {
-			tmpOldService.Command = service.Command
-		}
-		if len(service.Configs) != 0 {
-			tmpOldService.Configs = service.Configs
-		}
-		if service.ContainerName != "" {
-			tmpOldService.ContainerName = service.ContainerName
-		}
-		if service.CredentialSpec.File != "" || service.CredentialSpec.Registry != "" {
-			tmpOldService.CredentialSpec = service.CredentialSpec
-		}
-		if len(service.DependsOn) != 0 {
-			tmpOldService.DependsOn = service.DependsOn
-		}
-		if service.Deploy.Mode != "" {
-			tmpOldService.Deploy = service.Deploy
-		}
-		if service.Deploy.Resources.Limits != nil {
-			tmpOldService.Deploy.Resources.Limits = service.Deploy.Resources.Limits
-		}
-
-		if service.Deploy.Resources.Reservations != nil {
-			tmpOldService.Deploy.Resources.Reservations = service.Deploy.Resources.Reservations
-		}
-
-		if len(service.Devices) != 0 {
-			// merge the 2 sets of values
-			// TODO: need to merge the sets based on target values
-			// Not implemented yet as we don't convert devices to k8s anyway
-			tmpOldService.Devices = service.Devices
-		}
-		if len(service.DNS) != 0 {
-			// concat the 2 sets of values
-			tmpOldService.DNS = append(tmpOldService.DNS, service.DNS...)
-		}
-		if len(service.DNSSearch) != 0 {
-			// concat the 2 sets of values
-			tmpOldService.DNSSearch = append(tmpOldService.DNSSearch, service.DNSSearch...)
-		}
-		if service.DomainName != "" {
-			tmpOldService.DomainName = service.DomainName
-		}
-		if len(service.Entrypoint) != 0 {
-			tmpOldService.Entrypoint = service.Entrypoint
-		}
-		if len(service.Environment) != 0 {
-			// merge the 2 sets of values
-			for k, v := range service.Environment {
-				tmpOldService.Environment[k] = v
-			}
-		}
-		if len(service.EnvFile) != 0 {
-			tmpOldService.EnvFile = service.EnvFile
-		}
-		if len(service.Expose) != 0 {
-			// concat the 2 sets of values
-			tmpOldService.Expose = append(tmpOldService.Expose, service.Expose...)
-		}
-		if len(service.ExternalLinks) != 0 {
-			// concat the 2 sets of values
-			tmpOldService.ExternalLinks = append(tmpOldService.ExternalLinks, service.ExternalLinks...)
-		}
-		if len(service.ExtraHosts) != 0 {
-			tmpOldService.ExtraHosts = service.ExtraHosts
-		}
-		if service.Hostname != "" {
-			tmpOldService.Hostname = service.Hostname
-		}
-		if service.HealthCheck != nil {
-			tmpOldService.HealthCheck = service.HealthCheck
-		}
-		if service.Image != "" {
-			tmpOldService.Image = service.Image
-		}
-		if service.Ipc != "" {
-			tmpOldService.Ipc = service.Ipc
-		}
-		if len(service.Labels) != 0 {
-			// merge the 2 sets of values
-			if tmpOldService.Labels == nil {
-				tmpOldService.Labels = make(map[string]string)
-			}
-			for k, v := range service.Labels {
-				tmpOldService.Labels[k] = v
-			}
-		}
-		if len(service.Links) != 0 {
-			tmpOldService.Links = service.Links
-		}
-		if service.Logging != nil {
-			tmpOldService.Logging = service.Logging
-		}
-		if service.MacAddress != "" {
-			tmpOldService.MacAddress = service.MacAddress
-		}
-		if service.NetworkMode != "" {
-			tmpOldService.NetworkMode = service.NetworkMode
-		}
-		if len(service.Networks) != 0 {
-			tmpOldService.Networks = service.Networks
-		}
-		if service.Pid != "" {
-			tmpOldService.Pid = service.Pid
-		}
-		if len(service.Ports) != 0 {
-			// concat the 2 sets of values
-			tmpOldService.Ports = append(tmpOldService.Ports, service.Ports...)
-		}
-		if service.Privileged != tmpOldService.Privileged {
-			tmpOldService.Privileged = service.Privileged
-		}
-		if service.ReadOnly != tmpOldService.ReadOnly {
-			tmpOldService.ReadOnly = service.ReadOnly
-		}
-		if service.Restart != "" {
-			tmpOldService.Restart = service.Restart
-		}
-		if len(service.Secrets) != 0 {
-			tmpOldService.Secrets = service.Secrets
-		}
-		if len(service.SecurityOpt) != 0 {
-			tmpOldService.SecurityOpt = service.SecurityOpt
-		}
-		if service.StdinOpen != tmpOldService.StdinOpen {
-			tmpOldService.StdinOpen = service.StdinOpen
-		}
-		if service.StopSignal != "" {
-			tmpOldService.StopSignal = service.StopSignal
-		}
-		if len(service.Tmpfs) != 0 {
-			// concat the 2 sets of values
-			tmpOldService.Tmpfs = append(tmpOldService.Tmpfs, service.Tmpfs...)
-		}
-		if service.Tty != tmpOldService.Tty {
-			tmpOldService.Tty = service.Tty
-		}
-		if len(service.Ulimits) != 0 {
-			tmpOldService.Ulimits = service.Ulimits
-		}
-		if service.User != "" {
-			tmpOldService.User = service.User
-		}
-		if len(service.Volumes) != 0 {
-			// merge the 2 sets of values
-
-			// Store volumes by Target
-			volumeConfigsMap := make(map[string]types.ServiceVolumeConfig)
-			// map is not iterated in the same order.
-			// but why only this code cause test error?
-			var keys []string
-
-			// populate the older values
-			for _, volConfig := range tmpOldService.Volumes {
-				volumeConfigsMap[volConfig.Target] = volConfig
-				keys = append(keys, volConfig.Target)
-			}
-			// add the new values, overriding as needed
-			for _, volConfig := range service.Volumes {
-				if _, ok := volumeConfigsMap[volConfig.Target]; !ok {
-					keys = append(keys, volConfig.Target)
-				}
-				volumeConfigsMap[volConfig.Target] = volConfig
-			}
-
-			// get the new list of volume configs
-			var volumes []types.ServiceVolumeConfig
-
-			for _, key := range keys {
-				volumes = append(volumes, volumeConfigsMap[key])
-			}
-
-			tmpOldService.Volumes = volumes
-		}
-		if service.WorkingDir != "" {
-			tmpOldService.WorkingDir = service.WorkingDir
-		}
-		oldCompose.Services[index] = tmpOldService
-	}
-
-	// Merge the networks information
-	for idx, network := range newCompose.Networks {
-		oldCompose.Networks[idx] = network
-	}
-
-	// Merge the volumes information
-	for idx, volume := range newCompose.Volumes {
-		oldCompose.Volumes[idx] = volume
-	}
-
-	// Merge the secrets information
-	for idx, secret := range newCompose.Secrets {
-		oldCompose.Secrets[idx] = secret
-	}
-
-	// Merge the configs information
-	for idx, config := range newCompose.Configs {
-		oldCompose.Configs[idx] = config
-	}
-
-	return oldCompose, nil
-}
-
-func checkUnsupportedKeyForV3(composeObject *types.Config) []string {
+func checkUnsupportedKeyForV3(composeObject *types.Config) diagnostics.Diagnostics {
 	if composeObject == nil {
-		return []string{}
+		return nil
 	}
 
-	var keysFound []string
+	var keysFound diagnostics.Diagnostics
 
 	for _, service := range composeObject.Services {
-		for _, tmpConfig := range service.Configs {
+		for i, tmpConfig := range service.Configs {
 			if tmpConfig.GID != "" {
-				keysFound = append(keysFound, "long syntax config gid")
+				keysFound = append(keysFound, unsupportedKeyDiagnostic(service.Name, fmt.Sprintf("configs[%d].gid", i), "long syntax config gid"))
 			}
 			if tmpConfig.UID != "" {
-				keysFound = append(keysFound, "long syntax config uid")
+				keysFound = append(keysFound, unsupportedKeyDiagnostic(service.Name, fmt.Sprintf("configs[%d].uid", i), "long syntax config uid"))
 			}
 		}
 
 		if service.CredentialSpec.Registry != "" || service.CredentialSpec.File != "" {
-			keysFound = append(keysFound, "credential_spec")
+			keysFound = append(keysFound, unsupportedKeyDiagnostic(service.Name, "credential_spec", "credential_spec"))
+		}
+
+		var ulimits []string
+		for name := range service.Ulimits {
+			ulimits = append(ulimits, name)
+		}
+		if len(ulimits) > 0 {
+			keysFound = append(keysFound, ulimitsDiagnostic(service.Name, ulimits))
 		}
 	}
 
-	for _, config := range composeObject.Configs {
-		if config.External.External {
-			keysFound = append(keysFound, "external config")
+	var configNames []string
+	for name := range composeObject.Configs {
+		configNames = append(configNames, name)
+	}
+	sort.Strings(configNames)
+	for _, name := range configNames {
+		if composeObject.Configs[name].External.External {
+			keysFound = append(keysFound, unsupportedKeyDiagnostic("", "configs."+name+".external", "external config"))
 		}
 	}
 
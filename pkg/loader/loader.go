@@ -19,13 +19,14 @@ package loader
 import (
 	"fmt"
 
+	"github.com/kubernetes/kompose/pkg/diagnostics"
 	"github.com/kubernetes/kompose/pkg/kobject"
 	"github.com/kubernetes/kompose/pkg/loader/compose"
 )
 
 // Loader interface defines loader that loads files and converts it to kobject representation
 type Loader interface {
-	LoadFile(files []string) (kobject.KomposeObject, error)
+	LoadFile(files []string, profiles []string, diags *diagnostics.Collector) (kobject.KomposeObject, error)
 	///Name() string
 }
 
@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
@@ -32,6 +33,7 @@ import (
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/kubernetes/kompose/pkg/diagnostics"
 	"github.com/kubernetes/kompose/pkg/kobject"
 	"github.com/kubernetes/kompose/pkg/loader/compose"
 	"github.com/kubernetes/kompose/pkg/transformer"
@@ -40,7 +42,11 @@ import (
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	api "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -203,6 +209,9 @@ func PrintList(objects []runtime.Object, opt kobject.ConvertOptions) error {
 			if err != nil {
 				return err
 			}
+			if versionedObject, err = withoutStatus(versionedObject); err != nil {
+				return err
+			}
 
 			list.Items = append(list.Items, objectToRaw(versionedObject))
 		}
@@ -239,6 +248,9 @@ func PrintList(objects []runtime.Object, opt kobject.ConvertOptions) error {
 			if err != nil {
 				return err
 			}
+			if versionedObject, err = withoutStatus(versionedObject); err != nil {
+				return err
+			}
 			data, err := marshal(versionedObject, opt.GenerateJSON, opt.YAMLIndent)
 			if err != nil {
 				return err
@@ -289,7 +301,7 @@ func marshal(obj runtime.Object, jsonFormat bool, indent int) (data []byte, err
 	if jsonFormat {
 		data, err = json.MarshalIndent(obj, "", "  ")
 	} else {
-		data, err = marshalWithIndent(obj, indent)
+		data, err = MarshalWithIndent(obj, indent)
 	}
 	if err != nil {
 		data = nil
@@ -323,7 +335,8 @@ func jsonToYaml(j []byte, spaces int) ([]byte, error) {
 	// return yaml.Marshal(jsonObj)
 }
 
-func marshalWithIndent(o interface{}, indent int) ([]byte, error) {
+// MarshalWithIndent marshals an object into YAML, using the JSON field names
+func MarshalWithIndent(o interface{}, indent int) ([]byte, error) {
 	j, err := json.Marshal(o)
 	if err != nil {
 		return nil, fmt.Errorf("error marshaling into JSON: %s", err.Error())
@@ -362,6 +375,22 @@ func convertToVersion(obj runtime.Object) (runtime.Object, error) {
 	//return convertedObject, nil
 }
 
+// withoutStatus leaves out the status of the objects whose empty status isn't omitted when marshalled:
+// it's only written by their controller
+func withoutStatus(obj runtime.Object) (runtime.Object, error) {
+	switch obj.(type) {
+	case *autoscalingv2.HorizontalPodAutoscaler, *policyv1.PodDisruptionBudget:
+	default:
+		return obj, nil
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	delete(content, "status")
+	return &unstructured.Unstructured{Object: content}, nil
+}
+
 // PortsExist checks if service has ports defined
 func (k *Kubernetes) PortsExist(service kobject.ServiceConfig) bool {
 	return len(service.Port) != 0
@@ -398,11 +427,14 @@ func (k *Kubernetes) CreateLBService(name string, service kobject.ServiceConfig)
 }
 
 // CreateService creates a k8s service
-func (k *Kubernetes) CreateService(name string, service kobject.ServiceConfig) *api.Service {
+func (k *Kubernetes) CreateService(name string, service kobject.ServiceConfig) (*api.Service, error) {
 	svc := k.InitSvc(name, service)
 
 	// Configure the service ports.
-	servicePorts := k.ConfigServicePorts(service)
+	servicePorts, err := k.ConfigServicePorts(service)
+	if err != nil {
+		return nil, err
+	}
 	svc.Spec.Ports = servicePorts
 
 	if service.ServiceType == "Headless" {
@@ -416,7 +448,7 @@ func (k *Kubernetes) CreateService(name string, service kobject.ServiceConfig) *
 	annotations := transformer.ConfigAnnotations(service)
 	svc.ObjectMeta.Annotations = annotations
 
-	return svc
+	return svc, nil
 }
 
 // CreateHeadlessService creates a k8s headless service.
@@ -450,6 +482,12 @@ func (k *Kubernetes) UpdateKubernetesObjectsMultipleContainers(name string, serv
 	// fillTemplate fills the pod template with the value calculated from config
 	fillTemplate := func(template *api.PodTemplateSpec) error {
 		template.ObjectMeta.Labels = transformer.ConfigLabelsWithNetwork(name, service.Network)
+		if len(podSpec.Annotations) > 0 && template.ObjectMeta.Annotations == nil {
+			template.ObjectMeta.Annotations = map[string]string{}
+		}
+		for key, value := range podSpec.Annotations {
+			template.ObjectMeta.Annotations[key] = value
+		}
 		template.Spec = podSpec.Get()
 		return nil
 	}
@@ -490,12 +528,17 @@ func (k *Kubernetes) UpdateKubernetesObjects(name string, service kobject.Servic
 	if err != nil {
 		return errors.Wrap(err, "k.ConfigVolumes failed")
 	}
+	pvc, volumes = k.ConfigVolumeClaimTemplates(*objects, pvc, volumes)
 	// Configure Tmpfs
 	if len(service.TmpFs) > 0 {
 		TmpVolumesMount, TmpVolumes := k.ConfigTmpfs(name, service)
 		volumes = append(volumes, TmpVolumes...)
 		volumesMount = append(volumesMount, TmpVolumesMount...)
 	}
+	// Configure shm_size
+	shmVolumesMount, shmVolumes := k.ConfigShm(service)
+	volumes = append(volumes, shmVolumes...)
+	volumesMount = append(volumesMount, shmVolumesMount...)
 
 	if pvc != nil {
 		// Looping on the slice pvc instead of `*objects = append(*objects, pvc...)`
@@ -539,14 +582,14 @@ func (k *Kubernetes) UpdateKubernetesObjects(name string, service kobject.Servic
 			probe := api.Probe{}
 
 			if len(service.HealthChecks.Liveness.Test) > 0 {
-				probe.Handler = api.Handler{
+				probe.ProbeHandler = api.ProbeHandler{
 					Exec: &api.ExecAction{
 						Command: service.HealthChecks.Liveness.Test,
 					},
 				}
 			} else if !reflect.ValueOf(service.HealthChecks.Liveness.HTTPPath).IsZero() &&
 				!reflect.ValueOf(service.HealthChecks.Liveness.HTTPPort).IsZero() {
-				probe.Handler = api.Handler{
+				probe.ProbeHandler = api.ProbeHandler{
 					HTTPGet: &api.HTTPGetAction{
 						Path: service.HealthChecks.Liveness.HTTPPath,
 						Port: intstr.FromInt(int(service.HealthChecks.Liveness.HTTPPort)),
@@ -570,7 +613,7 @@ func (k *Kubernetes) UpdateKubernetesObjects(name string, service kobject.Servic
 		if !reflect.DeepEqual(service.HealthChecks.Readiness, kobject.HealthCheck{}) {
 			probeHealthCheckReadiness := api.Probe{}
 			if len(service.HealthChecks.Readiness.Test) > 0 {
-				probeHealthCheckReadiness.Handler = api.Handler{
+				probeHealthCheckReadiness.ProbeHandler = api.ProbeHandler{
 					Exec: &api.ExecAction{
 						Command: service.HealthChecks.Readiness.Test,
 					},
@@ -594,7 +637,7 @@ func (k *Kubernetes) UpdateKubernetesObjects(name string, service kobject.Servic
 		if service.StopGracePeriod != "" {
 			template.Spec.TerminationGracePeriodSeconds, err = DurationStrToSecondsInt(service.StopGracePeriod)
 			if err != nil {
-				log.Warningf("Failed to parse duration \"%v\" for service \"%v\"", service.StopGracePeriod, name)
+				opt.Diagnostics.Warnf(diagnostics.RuleInvalidValue, service.Name, diagnostics.ServicePath(service.Name, "stop_grace_period"), "Failed to parse duration \"%v\" for service \"%v\"", service.StopGracePeriod, name)
 			}
 		}
 
@@ -603,14 +646,17 @@ func (k *Kubernetes) UpdateKubernetesObjects(name string, service kobject.Servic
 		// Configure resource reservations
 		podSecurityContext := &api.PodSecurityContext{}
 
-		//set pid namespace mode
+		//set pid and ipc namespace modes
 		if service.Pid != "" {
 			if service.Pid == "host" {
-				// podSecurityContext.HostPID = true
+				template.Spec.HostPID = true
 			} else {
-				log.Warningf("Ignoring PID key for service \"%v\". Invalid value \"%v\".", name, service.Pid)
+				opt.Diagnostics.Warnf(diagnostics.RuleInvalidValue, service.Name, diagnostics.ServicePath(service.Name, "pid"), "Ignoring PID key for service \"%v\". Invalid value \"%v\".", name, service.Pid)
 			}
 		}
+		if service.Ipc == "host" {
+			template.Spec.HostIPC = true
+		}
 
 		//set supplementalGroups
 		if service.GroupAdd != nil {
@@ -622,20 +668,23 @@ func (k *Kubernetes) UpdateKubernetesObjects(name string, service kobject.Servic
 		if service.Privileged {
 			securityContext.Privileged = &service.Privileged
 		}
-		if service.User != "" {
-			uid, err := strconv.ParseInt(service.User, 10, 64)
-			if err != nil {
-				log.Warn("Ignoring user directive. User to be specified as a UID (numeric).")
-			} else {
-				securityContext.RunAsUser = &uid
-			}
-		}
+		ConfigUser(service, opt, securityContext)
 
 		//set capabilities if it is not empty
 		if len(capabilities.Add) > 0 || len(capabilities.Drop) > 0 {
 			securityContext.Capabilities = capabilities
 		}
 
+		podAnnotations := ConfigSecurityOpt(service, opt, securityContext)
+		if len(podAnnotations) > 0 && template.ObjectMeta.Annotations == nil {
+			template.ObjectMeta.Annotations = map[string]string{}
+		}
+		for key, value := range podAnnotations {
+			template.ObjectMeta.Annotations[key] = value
+		}
+		ConfigSysctls(podSecurityContext, service, opt)
+		ConfigSecurityProfile(service, opt, securityContext)
+
 		// update template only if securityContext is not empty
 		if *securityContext != (api.SecurityContext{}) {
 			template.Spec.Containers[0].SecurityContext = securityContext
@@ -667,9 +716,19 @@ func (k *Kubernetes) UpdateKubernetesObjects(name string, service kobject.Servic
 		if service.DomainName != "" {
 			template.Spec.Subdomain = service.DomainName
 		}
+		if service.NetworkMode == "host" {
+			template.Spec.HostNetwork = true
+			template.Spec.DNSPolicy = api.DNSClusterFirstWithHostNet
+		}
+		ConfigHostAliases(&template.Spec, service, opt)
+		ConfigDNS(&template.Spec, service, opt)
 
-		if serviceAccountName, ok := service.Labels[compose.LabelServiceAccountName]; ok {
-			template.Spec.ServiceAccountName = serviceAccountName
+		if accountName := podServiceAccount(name, service); accountName != "" {
+			template.Spec.ServiceAccountName = accountName
+		} else {
+			// the pods which don't access the API don't need the token of the default service account
+			automount := false
+			template.Spec.AutomountServiceAccountToken = &automount
 		}
 
 		return nil
@@ -730,11 +789,46 @@ func getServiceGroupID(service kobject.ServiceConfig, mode string) string {
 // 3. If group mode specified, port conflict between services in one group will be ignored, and multiple service should be created.
 // 4. If `volume` group mode specified, we don't have an appropriate name for this combined service, use the first one for now.
 //    A warn/info message should be printed to let the user know.
+// 5. The services sharing the network or the IPC namespace of another service with network_mode: service:<name> or
+//    ipc: service:<name> run in its pods: they join its group, or form one named after it, whatever the group mode.
 func KomposeObjectToServiceConfigGroupMapping(komposeObject *kobject.KomposeObject, opt kobject.ConvertOptions) map[string]kobject.ServiceConfigGroup {
 	serviceConfigGroup := make(map[string]kobject.ServiceConfigGroup)
 
+	groupIDs := map[string]string{}
+	roots := map[string]string{}
 	for name, service := range komposeObject.ServiceConfigs {
-		groupID := getServiceGroupID(service, opt.ServiceGroupMode)
+		groupIDs[name] = getServiceGroupID(service, opt.ServiceGroupMode)
+		if root, err := podRoot(*komposeObject, name); err == nil && root != name {
+			roots[name] = root
+		}
+	}
+	for _, root := range roots {
+		if groupIDs[root] == "" {
+			groupIDs[root] = root
+		}
+	}
+	for name, root := range roots {
+		groupIDs[name] = groupIDs[root]
+		// the pods of the group are attached to the networks of the service
+		service := komposeObject.ServiceConfigs[name]
+		service.Network = komposeObject.ServiceConfigs[root].Network
+		komposeObject.ServiceConfigs[name] = service
+	}
+	// the containers sharing the IPC namespace of another one share its /dev/shm too
+	for name, root := range roots {
+		target := ipcRoot(*komposeObject, name)
+		if targetRoot, err := podRoot(*komposeObject, target); target == name || err != nil || targetRoot != root {
+			continue
+		}
+		service := komposeObject.ServiceConfigs[name]
+		service.Ipc = "service:" + target
+		service.ShmSize = komposeObject.ServiceConfigs[target].ShmSize
+		komposeObject.ServiceConfigs[name] = service
+	}
+
+	for _, name := range SortedKeys(*komposeObject) {
+		service := komposeObject.ServiceConfigs[name]
+		groupID := groupIDs[name]
 		if groupID != "" {
 			service.Name = name
 			service.InGroup = true
@@ -743,9 +837,543 @@ func KomposeObjectToServiceConfigGroupMapping(komposeObject *kobject.KomposeObje
 		}
 	}
 
+	// the service whose pods are shared comes first, its workload is the one of the group
+	for groupID, group := range serviceConfigGroup {
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].Name == groupID && group[j].Name != groupID
+		})
+	}
+
 	return serviceConfigGroup
 }
 
+// networkModeService returns the service whose network a service shares with network_mode: service:<name>
+func networkModeService(service kobject.ServiceConfig) string {
+	if strings.HasPrefix(service.NetworkMode, "service:") {
+		return strings.TrimPrefix(service.NetworkMode, "service:")
+	}
+	return ""
+}
+
+// ipcModeService returns the service whose IPC namespace a service shares with ipc: service:<name>
+func ipcModeService(service kobject.ServiceConfig) string {
+	if strings.HasPrefix(service.Ipc, "service:") {
+		return strings.TrimPrefix(service.Ipc, "service:")
+	}
+	return ""
+}
+
+// ipcRoot returns the service whose IPC namespace a service shares, following the services sharing the IPC
+// namespace of another one, the service itself when it has its own IPC namespace
+func ipcRoot(komposeObject kobject.KomposeObject, name string) string {
+	seen := map[string]bool{name: true}
+	for {
+		target := ipcModeService(komposeObject.ServiceConfigs[name])
+		if _, ok := komposeObject.ServiceConfigs[target]; !ok || seen[target] {
+			return name
+		}
+		seen[target] = true
+		name = target
+	}
+}
+
+// podService returns the service whose pods a service runs in, the one whose network it shares, or else
+// the one whose IPC namespace it shares, with the key referring to it
+func podService(service kobject.ServiceConfig) (string, string) {
+	if target := networkModeService(service); target != "" {
+		return target, "network_mode"
+	}
+	return ipcModeService(service), "ipc"
+}
+
+// podRoot returns the service whose pods a service runs in, following the services sharing the network
+// or the IPC namespace of another one, the service itself when it has its own pods
+func podRoot(komposeObject kobject.KomposeObject, name string) (string, error) {
+	seen := map[string]bool{}
+	for {
+		target, key := podService(komposeObject.ServiceConfigs[name])
+		if target == "" {
+			return name, nil
+		}
+		if seen[name] {
+			return "", errors.Errorf("The %s of service %s refers to itself through service %s", key, name, target)
+		}
+		seen[name] = true
+		if _, ok := komposeObject.ServiceConfigs[target]; !ok {
+			return "", errors.Errorf("The %s of service %s refers to service %s, which doesn't exist", key, name, target)
+		}
+		name = target
+	}
+}
+
+// SharesPod tells a service shares the network or the IPC namespace of another one, with network_mode: service:<name>
+// or ipc: service:<name>, and so runs in its pods
+func SharesPod(komposeObject kobject.KomposeObject) bool {
+	for _, service := range komposeObject.ServiceConfigs {
+		if target, _ := podService(service); target != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckNetworkModes checks the services whose network is shared exist, and warns about the network
+// modes the pods can't have
+func CheckNetworkModes(komposeObject kobject.KomposeObject, opt kobject.ConvertOptions) error {
+	for _, name := range SortedKeys(komposeObject) {
+		service := komposeObject.ServiceConfigs[name]
+		path := diagnostics.ServicePath(service.Name, "network_mode")
+		switch mode := service.NetworkMode; {
+		case mode == "" || mode == "bridge" || mode == "host":
+		case mode == "none":
+			opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, path,
+				"network_mode: none of service %s can't be converted, its pods are still attached to the cluster network", service.Name)
+		case networkModeService(service) != "":
+			if _, err := podRoot(komposeObject, name); err != nil {
+				return err
+			}
+		default:
+			opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, path,
+				"Ignoring network_mode %q of service %s, only host, none and service:<name> are supported", mode, service.Name)
+		}
+	}
+	return nil
+}
+
+// defaultNetwork is the network compose attaches the services declaring no network to
+const defaultNetwork = "default"
+
+// attachDefaultNetwork attaches the services declaring no network to the default network, which isn't declared
+// in the compose files, for its network policy to let their pods reach each other like the declared networks.
+// The pods on the host network aren't subject to the policies, the ones sharing the network of another
+// service are attached to its networks.
+func attachDefaultNetwork(komposeObject *kobject.KomposeObject) {
+	for name, service := range komposeObject.ServiceConfigs {
+		if len(service.Network) > 0 || service.NetworkMode == "host" || networkModeService(service) != "" {
+			continue
+		}
+		service.Network = []string{defaultNetwork}
+		komposeObject.ServiceConfigs[name] = service
+	}
+}
+
+// CheckIpcModes checks the services whose IPC namespace is shared exist, and warns about the IPC modes
+// the pods can't have
+func CheckIpcModes(komposeObject kobject.KomposeObject, opt kobject.ConvertOptions) error {
+	for _, name := range SortedKeys(komposeObject) {
+		service := komposeObject.ServiceConfigs[name]
+		path := diagnostics.ServicePath(service.Name, "ipc")
+		switch mode := service.Ipc; {
+		// the containers of a pod share their IPC namespace, private to the pod
+		case mode == "" || mode == "private" || mode == "shareable" || mode == "host":
+		case ipcModeService(service) != "":
+			root, err := podRoot(komposeObject, name)
+			if err != nil {
+				return err
+			}
+			// the pods of a service sharing the network of another one are the ones of this other service
+			if target, err := podRoot(komposeObject, ipcModeService(service)); err != nil {
+				return err
+			} else if target != root {
+				opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, path,
+					"Ignoring ipc %q of service %s, its pods are the ones of service %s it shares the network of", mode, service.Name, root)
+			}
+		default:
+			opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, path,
+				"Ignoring ipc %q of service %s, only host and service:<name> are supported", mode, service.Name)
+		}
+	}
+	return nil
+}
+
+// containsString tells a list holds a string
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// maxNameservers is the number of name servers a pod can have
+const maxNameservers = 3
+
+// ConfigHostAliases adds the extra_hosts of a service, given as host:ip, to the host aliases of the pods,
+// the host names of an address being gathered
+func ConfigHostAliases(podSpec *api.PodSpec, service kobject.ServiceConfig, opt kobject.ConvertOptions) {
+	for _, entry := range service.ExtraHosts {
+		sep := strings.Index(entry, "=")
+		if sep < 0 {
+			sep = strings.Index(entry, ":")
+		}
+		if sep < 0 || net.ParseIP(entry[sep+1:]) == nil {
+			opt.Diagnostics.Warnf(diagnostics.RuleInvalidValue, service.Name, diagnostics.ServicePath(service.Name, "extra_hosts"),
+				"Ignoring extra host %q of service %s, the address of the host must be an IP", entry, service.Name)
+			continue
+		}
+		host, ip := entry[:sep], net.ParseIP(entry[sep+1:]).String()
+
+		index := -1
+		for i, alias := range podSpec.HostAliases {
+			if alias.IP == ip {
+				index = i
+			}
+		}
+		if index < 0 {
+			podSpec.HostAliases = append(podSpec.HostAliases, api.HostAlias{IP: ip})
+			index = len(podSpec.HostAliases) - 1
+		}
+		if !containsString(podSpec.HostAliases[index].Hostnames, host) {
+			podSpec.HostAliases[index].Hostnames = append(podSpec.HostAliases[index].Hostnames, host)
+		}
+	}
+}
+
+// ConfigDNS adds the dns, dns_search and dns_opt of a service to the DNS config of the pods. The name servers
+// replacing the ones of the cluster like in compose, the DNS policy of the pods becomes None
+func ConfigDNS(podSpec *api.PodSpec, service kobject.ServiceConfig, opt kobject.ConvertOptions) {
+	if len(service.DNS) == 0 && len(service.DNSSearch) == 0 && len(service.DNSOpts) == 0 {
+		return
+	}
+	if podSpec.DNSConfig == nil {
+		podSpec.DNSConfig = &api.PodDNSConfig{}
+	}
+	config := podSpec.DNSConfig
+
+	for _, nameserver := range service.DNS {
+		if net.ParseIP(nameserver) == nil {
+			opt.Diagnostics.Warnf(diagnostics.RuleInvalidValue, service.Name, diagnostics.ServicePath(service.Name, "dns"),
+				"Ignoring DNS server %q of service %s, it must be an IP", nameserver, service.Name)
+			continue
+		}
+		if containsString(config.Nameservers, nameserver) {
+			continue
+		}
+		if len(config.Nameservers) == maxNameservers {
+			opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, diagnostics.ServicePath(service.Name, "dns"),
+				"Ignoring DNS server %s of service %s, the pods can't have more than %d", nameserver, service.Name, maxNameservers)
+			continue
+		}
+		config.Nameservers = append(config.Nameservers, nameserver)
+	}
+	for _, search := range service.DNSSearch {
+		if !containsString(config.Searches, search) {
+			config.Searches = append(config.Searches, search)
+		}
+	}
+	for _, option := range service.DNSOpts {
+		name, value := option, ""
+		if i := strings.Index(option, ":"); i >= 0 {
+			name, value = option[:i], option[i+1:]
+		}
+		dnsOption := api.PodDNSConfigOption{Name: name}
+		if value != "" {
+			dnsOption.Value = &value
+		}
+		config.Options = append(config.Options, dnsOption)
+	}
+
+	if len(config.Nameservers) > 0 {
+		podSpec.DNSPolicy = api.DNSNone
+	}
+}
+
+// AppArmorAnnotationPrefix prefixes the name of the container in the annotation of the pods setting its AppArmor profile
+const AppArmorAnnotationPrefix = "container.apparmor.security.beta.kubernetes.io/"
+
+// safeSysctls are the sysctls the kubelet allows, the other ones must be allowed with --allowed-unsafe-sysctls
+var safeSysctls = map[string]bool{
+	"kernel.shm_rmid_forced":              true,
+	"net.ipv4.ip_local_port_range":        true,
+	"net.ipv4.ip_local_reserved_ports":    true,
+	"net.ipv4.ip_unprivileged_port_start": true,
+	"net.ipv4.ping_group_range":           true,
+	"net.ipv4.tcp_fin_timeout":            true,
+	"net.ipv4.tcp_keepalive_intvl":        true,
+	"net.ipv4.tcp_keepalive_probes":       true,
+	"net.ipv4.tcp_keepalive_time":         true,
+	"net.ipv4.tcp_syncookies":             true,
+}
+
+// isNumericUser returns whether a compose user, given as user[:group], is given with ids only
+func isNumericUser(user string) bool {
+	for _, part := range strings.SplitN(user, ":", 2) {
+		if _, err := strconv.ParseInt(part, 10, 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// ResolveServiceUser returns the user of a service with its named user and group resolved to their ids from
+// its image, with --resolve-users. The user is returned as is when it can't be resolved.
+func ResolveServiceUser(service kobject.ServiceConfig, opt kobject.ConvertOptions) string {
+	if !opt.ResolveUsers || service.User == "" || isNumericUser(service.User) {
+		return service.User
+	}
+	users, err := transformer.ReadImageUsers(service, opt)
+	if err == nil {
+		var user string
+		if user, err = users.ResolveUser(service.User); err == nil {
+			log.Debugf("Resolved user %s of service %s to %s", service.User, service.Name, user)
+			return user
+		}
+	}
+	opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, diagnostics.ServicePath(service.Name, "user"),
+		"Unable to resolve user %s of service %s from its image: %s", service.User, service.Name, err)
+	return service.User
+}
+
+// ConfigUser sets the user and the group of the container of a service, given as uid[:gid], in its security context
+func ConfigUser(service kobject.ServiceConfig, opt kobject.ConvertOptions, securityContext *api.SecurityContext) {
+	if service.User == "" {
+		return
+	}
+	user, group := service.User, ""
+	if i := strings.Index(service.User, ":"); i >= 0 {
+		user, group = service.User[:i], service.User[i+1:]
+	}
+
+	uid, err := strconv.ParseInt(user, 10, 64)
+	if err != nil {
+		opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, diagnostics.ServicePath(service.Name, "user"),
+			"Ignoring user directive %s of service %s. User to be specified as a UID (numeric), or resolved from the image with --resolve-users.", service.User, service.Name)
+		return
+	}
+	securityContext.RunAsUser = &uid
+
+	if group == "" {
+		return
+	}
+	gid, err := strconv.ParseInt(group, 10, 64)
+	if err != nil {
+		opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, diagnostics.ServicePath(service.Name, "user"),
+			"Ignoring group %s of service %s. Group to be specified as a GID (numeric), or resolved from the image with --resolve-users.", group, service.Name)
+		return
+	}
+	securityContext.RunAsGroup = &gid
+}
+
+// ConfigSecurityOpt configures the security context of the container of a service from its read_only and
+// security_opt, and returns the annotations of the pods setting its AppArmor profile
+func ConfigSecurityOpt(service kobject.ServiceConfig, opt kobject.ConvertOptions, securityContext *api.SecurityContext) map[string]string {
+	if service.ReadOnly {
+		readOnly := true
+		securityContext.ReadOnlyRootFilesystem = &readOnly
+	}
+
+	annotations := map[string]string{}
+	path := diagnostics.ServicePath(service.Name, "security_opt")
+	for _, option := range service.SecurityOpt {
+		// docker still accepts the options given as key:value
+		key, value := option, ""
+		if i := strings.IndexAny(option, "=:"); i >= 0 {
+			key, value = option[:i], option[i+1:]
+		}
+
+		switch key {
+		case "no-new-privileges":
+			if value == "" || value == "true" {
+				allowPrivilegeEscalation := false
+				securityContext.AllowPrivilegeEscalation = &allowPrivilegeEscalation
+			} else if value != "false" {
+				opt.Diagnostics.Warnf(diagnostics.RuleInvalidValue, service.Name, path, "Ignoring security option %q of service %s, invalid value", option, service.Name)
+			}
+		case "seccomp":
+			switch value {
+			case "unconfined":
+				securityContext.SeccompProfile = &api.SeccompProfile{Type: api.SeccompProfileTypeUnconfined}
+			case "runtime/default":
+				securityContext.SeccompProfile = &api.SeccompProfile{Type: api.SeccompProfileTypeRuntimeDefault}
+			default:
+				profile := filepath.Base(value)
+				securityContext.SeccompProfile = &api.SeccompProfile{Type: api.SeccompProfileTypeLocalhost, LocalhostProfile: &profile}
+				opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, path,
+					"The seccomp profile %s of service %s must be installed on the nodes, as %s in the seccomp directory of the kubelet", value, service.Name, profile)
+			}
+		case "apparmor":
+			switch value {
+			case "unconfined":
+				annotations[AppArmorAnnotationPrefix+GetContainerName(service)] = "unconfined"
+			case "docker-default", "runtime/default":
+				annotations[AppArmorAnnotationPrefix+GetContainerName(service)] = "runtime/default"
+			default:
+				annotations[AppArmorAnnotationPrefix+GetContainerName(service)] = "localhost/" + value
+				opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, path,
+					"The AppArmor profile %s of service %s must be loaded on the nodes", value, service.Name)
+			}
+		case "label":
+			i := strings.Index(value, ":")
+			if i < 0 {
+				opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, path, "Ignoring security option %q of service %s, only the SELinux user, role, type and level can be set", option, service.Name)
+				continue
+			}
+			if securityContext.SELinuxOptions == nil {
+				securityContext.SELinuxOptions = &api.SELinuxOptions{}
+			}
+			switch label := value[i+1:]; value[:i] {
+			case "user":
+				securityContext.SELinuxOptions.User = label
+			case "role":
+				securityContext.SELinuxOptions.Role = label
+			case "type":
+				securityContext.SELinuxOptions.Type = label
+			case "level":
+				securityContext.SELinuxOptions.Level = label
+			default:
+				opt.Diagnostics.Warnf(diagnostics.RuleInvalidValue, service.Name, path, "Ignoring security option %q of service %s, invalid SELinux label", option, service.Name)
+			}
+		default:
+			opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, path, "Ignoring security option %q of service %s, it has no equivalent", option, service.Name)
+		}
+	}
+	return annotations
+}
+
+// ConfigSysctls adds the sysctls of a service to the ones of the pods, the unsafe ones being reported
+func ConfigSysctls(podSecurityContext *api.PodSecurityContext, service kobject.ServiceConfig, opt kobject.ConvertOptions) {
+	var names []string
+	for name := range service.Sysctls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !safeSysctls[name] {
+			opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, diagnostics.ServicePath(service.Name, "sysctls"),
+				"The sysctl %s of service %s is unsafe, the kubelet of the nodes must allow it with --allowed-unsafe-sysctls", name, service.Name)
+		}
+		found := false
+		for i := range podSecurityContext.Sysctls {
+			if podSecurityContext.Sysctls[i].Name == name {
+				podSecurityContext.Sysctls[i].Value = service.Sysctls[name]
+				found = true
+			}
+		}
+		if !found {
+			podSecurityContext.Sysctls = append(podSecurityContext.Sysctls, api.Sysctl{Name: name, Value: service.Sysctls[name]})
+		}
+	}
+}
+
+// Pod Security Standards the pods can be checked against with --security-profile
+const (
+	SecurityProfileBaseline   = "baseline"
+	SecurityProfileRestricted = "restricted"
+)
+
+// baselineCapabilities are the capabilities the baseline Pod Security Standard allows to add
+var baselineCapabilities = map[string]bool{
+	"AUDIT_WRITE":      true,
+	"CHOWN":            true,
+	"DAC_OVERRIDE":     true,
+	"FOWNER":           true,
+	"FSETID":           true,
+	"KILL":             true,
+	"MKNOD":            true,
+	"NET_BIND_SERVICE": true,
+	"SETFCAP":          true,
+	"SETGID":           true,
+	"SETPCAP":          true,
+	"SETUID":           true,
+	"SYS_CHROOT":       true,
+}
+
+// baselineSELinuxTypes are the SELinux types the baseline Pod Security Standard allows
+var baselineSELinuxTypes = map[string]bool{
+	"":                 true,
+	"container_t":      true,
+	"container_init_t": true,
+	"container_kvm_t":  true,
+}
+
+// ConfigSecurityProfile reports the compose settings of a service violating the Pod Security Standard of
+// --security-profile, which are kept as they are, and hardens the security context of its container for
+// the restricted one
+func ConfigSecurityProfile(service kobject.ServiceConfig, opt kobject.ConvertOptions, securityContext *api.SecurityContext) {
+	if opt.SecurityProfile == "" {
+		return
+	}
+	restricted := opt.SecurityProfile == SecurityProfileRestricted
+	violation := func(key string, format string, args ...interface{}) {
+		opt.Diagnostics.Warnf(diagnostics.RuleSecurityProfile, service.Name, diagnostics.ServicePath(service.Name, key),
+			"Service %s violates the %s Pod Security Standard: %s", service.Name, opt.SecurityProfile, fmt.Sprintf(format, args...))
+	}
+
+	if service.Privileged {
+		violation("privileged", "its container is privileged")
+	}
+	addsSysAdmin := false
+	for _, capability := range service.CapAdd {
+		name := strings.TrimPrefix(strings.ToUpper(capability), "CAP_")
+		addsSysAdmin = addsSysAdmin || name == "SYS_ADMIN" || name == "ALL"
+		if !baselineCapabilities[name] || restricted && name != "NET_BIND_SERVICE" {
+			violation("cap_add", "it adds the capability %s", capability)
+		}
+	}
+	if service.NetworkMode == "host" {
+		violation("network_mode", "its pods use the network of the node")
+	}
+	if service.Pid == "host" {
+		violation("pid", "its pods use the process namespace of the node")
+	}
+	if service.Ipc == "host" {
+		violation("ipc", "its pods use the IPC namespace of the node")
+	}
+	var sysctls []string
+	for name := range service.Sysctls {
+		if !safeSysctls[name] {
+			sysctls = append(sysctls, name)
+		}
+	}
+	sort.Strings(sysctls)
+	for _, name := range sysctls {
+		violation("sysctls", "the sysctl %s is unsafe", name)
+	}
+	if opt.Volumes == "hostPath" && !opt.EmptyVols && len(service.Volumes) > 0 {
+		violation("volumes", "its volumes are mounted from the nodes with --volumes hostPath")
+	}
+	for _, option := range service.SecurityOpt {
+		if option == "apparmor=unconfined" || option == "apparmor:unconfined" {
+			violation("security_opt", "its AppArmor profile is unconfined")
+		}
+	}
+	if securityContext.SeccompProfile != nil && securityContext.SeccompProfile.Type == api.SeccompProfileTypeUnconfined {
+		violation("security_opt", "its seccomp profile is unconfined")
+	}
+	if selinux := securityContext.SELinuxOptions; selinux != nil {
+		if selinux.User != "" || selinux.Role != "" {
+			violation("security_opt", "it sets the SELinux user or role")
+		}
+		if !baselineSELinuxTypes[selinux.Type] {
+			violation("security_opt", "its SELinux type is %s", selinux.Type)
+		}
+	}
+
+	if !restricted {
+		return
+	}
+	if securityContext.RunAsUser != nil && *securityContext.RunAsUser == 0 {
+		violation("user", "its container runs as root")
+	} else {
+		runAsNonRoot := true
+		securityContext.RunAsNonRoot = &runAsNonRoot
+	}
+	if securityContext.Capabilities == nil {
+		securityContext.Capabilities = &api.Capabilities{}
+	}
+	securityContext.Capabilities.Drop = []api.Capability{"ALL"}
+	if securityContext.SeccompProfile == nil {
+		securityContext.SeccompProfile = &api.SeccompProfile{Type: api.SeccompProfileTypeRuntimeDefault}
+	}
+	// the privileged containers and the ones adding CAP_SYS_ADMIN always allow the privilege escalation
+	if securityContext.AllowPrivilegeEscalation == nil && !service.Privileged && !addsSysAdmin {
+		allowPrivilegeEscalation := false
+		securityContext.AllowPrivilegeEscalation = &allowPrivilegeEscalation
+	}
+}
+
 // TranslatePodResource config pod resources
 func TranslatePodResource(service *kobject.ServiceConfig, template *api.PodTemplateSpec) {
 	// Configure the resource limits
@@ -853,6 +1481,66 @@ func (k *Kubernetes) RemoveDupObjects(objs *[]runtime.Object) {
 	*objs = result
 }
 
+// clusterScopedKinds lists the kinds of objects which don't belong to a namespace
+var clusterScopedKinds = map[string]bool{
+	"Namespace":          true,
+	"PersistentVolume":   true,
+	"StorageClass":       true,
+	"ClusterRole":        true,
+	"ClusterRoleBinding": true,
+	"PriorityClass":      true,
+}
+
+// namespaceNameLabel is the label set by Kubernetes on every namespace, with the name of the namespace
+const namespaceNameLabel = "kubernetes.io/metadata.name"
+
+// SetNamespace moves the namespaced objects to the given namespace. The pods allowed by the
+// network policies are restricted to this namespace too, so that the policies keep isolating
+// the networks of the project. Ingresses and routes are moved along with the services they
+// route to, their backends don't have to be rewritten.
+func (k *Kubernetes) SetNamespace(objs []runtime.Object, namespace string) {
+	for _, obj := range objs {
+		if clusterScopedKinds[obj.GetObjectKind().GroupVersionKind().Kind] {
+			continue
+		}
+		if o, ok := obj.(metav1.Object); ok {
+			o.SetNamespace(namespace)
+		}
+		if np, ok := obj.(*networkingv1.NetworkPolicy); ok {
+			for i := range np.Spec.Ingress {
+				setPeersNamespace(np.Spec.Ingress[i].From, namespace)
+			}
+			for i := range np.Spec.Egress {
+				setPeersNamespace(np.Spec.Egress[i].To, namespace)
+			}
+		}
+	}
+}
+
+// setPeersNamespace restricts the pods allowed by network policy peers to the given namespace
+func setPeersNamespace(peers []networkingv1.NetworkPolicyPeer, namespace string) {
+	for i, peer := range peers {
+		if peer.PodSelector != nil && peer.NamespaceSelector == nil {
+			peers[i].NamespaceSelector = &metav1.LabelSelector{
+				MatchLabels: map[string]string{namespaceNameLabel: namespace},
+			}
+		}
+	}
+}
+
+// InitNamespace initializes Kubernetes Namespace object
+func (k *Kubernetes) InitNamespace(namespace string) *api.Namespace {
+	return &api.Namespace{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Namespace",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: namespace,
+		},
+	}
+}
+
 // SortedKeys Ensure the kubernetes objects are in a consistent order
 func SortedKeys(komposeObject kobject.KomposeObject) []string {
 	var sortedKeys []string
@@ -922,6 +1610,83 @@ func FormatFileName(name string) string {
 	return strings.Replace(file, "_", "-", -1)
 }
 
+// SourceKey returns the key of a service an object generated for this service was derived from, like ports[0].
+// An empty key stands for the service itself.
+func SourceKey(service kobject.ServiceConfig, obj runtime.Object) string {
+	switch o := obj.(type) {
+	case *api.Service:
+		if len(service.Port) > 0 {
+			return "ports[0]"
+		}
+	case *networkingv1.Ingress:
+		return "labels." + compose.LabelServiceExpose
+	case *unstructured.Unstructured:
+		if o.GetKind() == "HTTPRoute" {
+			return "labels." + compose.LabelServiceExpose
+		}
+	case *api.PersistentVolumeClaim:
+		for i, volume := range service.Volumes {
+			if volume.PVCName == o.Name || volume.VolumeName == o.Name {
+				return fmt.Sprintf("volumes[%d]", i)
+			}
+		}
+		return "volumes"
+	case *api.ConfigMap:
+		for i, envFile := range service.EnvFile {
+			if FormatEnvName(envFile) == o.Name {
+				return fmt.Sprintf("env_file[%d]", i)
+			}
+		}
+		for i, config := range service.Configs {
+			if FormatFileName(config.Source) == o.Name {
+				return fmt.Sprintf("configs[%d]", i)
+			}
+		}
+		return "volumes"
+	case *networkingv1.NetworkPolicy:
+		if len(service.Port) > 0 && o.Name == publishedPolicyName(service.Name) {
+			return "ports"
+		}
+		return "networks"
+	case *autoscalingv2.HorizontalPodAutoscaler:
+		return "labels." + compose.LabelHPAMaxReplicas
+	case *policyv1.PodDisruptionBudget:
+		switch {
+		case service.PDBMinAvailable != "":
+			return "labels." + compose.LabelPDBMinAvailable
+		case service.PDBMaxUnavailable != "":
+			return "labels." + compose.LabelPDBMaxUnavailable
+		case service.DeployUpdateConfig.Parallelism != nil:
+			return "deploy.update_config.parallelism"
+		}
+	case *api.ServiceAccount:
+		if service.ServiceAccountCreate {
+			return "labels." + compose.LabelServiceAccountCreate
+		}
+		return rbacSourceKey(service)
+	case *rbacv1.Role, *rbacv1.RoleBinding, *rbacv1.ClusterRole, *rbacv1.ClusterRoleBinding:
+		return rbacSourceKey(service)
+	}
+	return ""
+}
+
+// rbacSourceKey returns the key of the label defining the role of a service
+func rbacSourceKey(service kobject.ServiceConfig) string {
+	if service.RBACPolicyFile != "" {
+		return "labels." + compose.LabelRBACPolicyFile
+	}
+	return "labels." + compose.LabelRBACRules
+}
+
+// AnnotateSources records on the objects generated for a service the location of the compose key they were derived from
+func AnnotateSources(service kobject.ServiceConfig, objects []runtime.Object) {
+	for _, obj := range objects {
+		if location, ok := service.Locate(SourceKey(service, obj)); ok {
+			transformer.AnnotateSource(obj, location)
+		}
+	}
+}
+
 //FormatContainerName format Container name
 func FormatContainerName(name string) string {
 	name = strings.Replace(name, "_", "-", -1)
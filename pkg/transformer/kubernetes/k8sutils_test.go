@@ -21,6 +21,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/kubernetes/kompose/pkg/kobject"
@@ -29,6 +30,10 @@ import (
 	"github.com/pkg/errors"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 /*
@@ -67,7 +72,10 @@ func TestCreateService(t *testing.T) {
 	}
 
 	// Test the creation of the service
-	svc := k.CreateService("foo", service)
+	svc, err := k.CreateService("foo", service)
+	if err != nil {
+		t.Error(errors.Wrap(err, "k.CreateService failed"))
+	}
 
 	if svc.Spec.Ports[0].Port != 123 {
 		t.Errorf("Expected port 123 upon conversion, actual %d", svc.Spec.Ports[0].Port)
@@ -516,3 +524,96 @@ func TestServiceWithServiceAccount(t *testing.T) {
 		}
 	}
 }
+
+func TestTransformWithNamespace(t *testing.T) {
+	service := kobject.ServiceConfig{
+		Name:          "app",
+		ContainerName: "name",
+		Image:         "image",
+		Port:          []kobject.Ports{{HostPort: 80, ContainerPort: 80}},
+		Network:       []string{"front"},
+		ExposeService: "example.com",
+	}
+	komposeObject := kobject.KomposeObject{
+		ServiceConfigs: map[string]kobject.ServiceConfig{"app": service},
+	}
+	k := Kubernetes{}
+
+	objects, err := k.Transform(komposeObject, kobject.ConvertOptions{CreateD: true, Namespace: "shop", CreateNamespace: true})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "k.Transform failed"))
+	}
+
+	if ns, ok := objects[0].(*corev1.Namespace); !ok || ns.Name != "shop" || ns.Namespace != "" {
+		t.Fatalf("Expected the namespace shop first, got %#v", objects[0])
+	}
+	kinds := map[string]bool{}
+	for _, obj := range objects[1:] {
+		meta := obj.(metav1.Object)
+		kind := obj.GetObjectKind().GroupVersionKind().Kind
+		kinds[kind] = true
+		if meta.GetNamespace() != "shop" {
+			t.Errorf("Expected %s %s in namespace shop, got %q", kind, meta.GetName(), meta.GetNamespace())
+		}
+		// the published ports are open to any source, the networks to their pods in namespace shop
+		if np, ok := obj.(*networkingv1.NetworkPolicy); ok && np.Name != publishedPolicyName("app") {
+			selector := np.Spec.Ingress[0].From[0].NamespaceSelector
+			if selector == nil || selector.MatchLabels["kubernetes.io/metadata.name"] != "shop" {
+				t.Errorf("Expected the network policy to allow the pods of namespace shop only, got %v", selector)
+			}
+		}
+	}
+	for _, kind := range []string{"Service", "Deployment", "Ingress", "NetworkPolicy"} {
+		if !kinds[kind] {
+			t.Errorf("Expected a %s to be generated, got %v", kind, kinds)
+		}
+	}
+}
+
+func TestRemoveDupObjectsWithNamespace(t *testing.T) {
+	configMap := func(namespace string) runtime.Object {
+		return &corev1.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{Kind: "ConfigMap", APIVersion: "v1"},
+			ObjectMeta: metav1.ObjectMeta{Name: "env", Namespace: namespace},
+		}
+	}
+	objects := []runtime.Object{configMap("a"), configMap("a"), configMap("b")}
+
+	k := Kubernetes{}
+	k.RemoveDupObjects(&objects)
+	if len(objects) != 2 {
+		t.Errorf("Expected the duplicate in namespace a only to be removed, got %d objects", len(objects))
+	}
+}
+
+func TestWithoutStatus(t *testing.T) {
+	k := Kubernetes{}
+	service := kobject.ServiceConfig{Name: "web", HPAMaxReplicas: 5, HPACPU: 50}
+	hpa := k.InitHPA("web", service, metav1.TypeMeta{Kind: "Deployment", APIVersion: "apps/v1"})
+
+	obj, err := withoutStatus(hpa)
+	if err != nil {
+		t.Fatalf("withoutStatus() error = %v", err)
+	}
+	data, err := marshal(obj, true, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "status") || !strings.Contains(string(data), `"maxReplicas": 5`) {
+		t.Errorf("Expected the spec of the HorizontalPodAutoscaler without its status, got %s", data)
+	}
+
+	one := intstr.FromInt(1)
+	obj, err = withoutStatus(k.InitPDB("web", &one, nil))
+	if err != nil {
+		t.Fatalf("withoutStatus() error = %v", err)
+	}
+	if data, _ := marshal(obj, true, 2); strings.Contains(string(data), "status") || !strings.Contains(string(data), `"minAvailable": 1`) {
+		t.Errorf("Expected the spec of the PodDisruptionBudget without its status, got %s", data)
+	}
+
+	deployment := &appsv1.Deployment{}
+	if obj, _ := withoutStatus(deployment); obj != deployment {
+		t.Errorf("Expected the other objects to be left alone")
+	}
+}
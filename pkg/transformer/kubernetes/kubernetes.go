@@ -17,6 +17,8 @@ limitations under the License.
 package kubernetes
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"fmt"
 	"io/ioutil"
@@ -28,10 +30,13 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/tools/godoc/util"
 
+	dockerCliTypes "github.com/docker/cli/cli/compose/types"
 	"github.com/fatih/structs"
+	"github.com/kubernetes/kompose/pkg/diagnostics"
 	"github.com/kubernetes/kompose/pkg/kobject"
 	"github.com/kubernetes/kompose/pkg/loader/compose"
 	"github.com/kubernetes/kompose/pkg/transformer"
@@ -41,12 +46,18 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cast"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	api "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/yaml"
 )
 
 // Kubernetes implements Transformer interface and represents Kubernetes transformer
@@ -63,24 +74,53 @@ const (
 	DeploymentController = "deployment"
 	// DaemonSetController is controller type for DaemonSet
 	DaemonSetController = "daemonset"
+	// StatefulSetController is controller type for StatefulSet
+	StatefulSetController = "statefulset"
 )
 
+const (
+	// ExposeModeIngress exposes the services with Ingresses
+	ExposeModeIngress = "ingress"
+	// ExposeModeGateway exposes the services with HTTPRoutes of the Gateway API
+	ExposeModeGateway = "gateway"
+	// ExposeModeRoute exposes the services with OpenShift Routes
+	ExposeModeRoute = "route"
+)
+
+// GatewayGroup is the API group of the Gateway API
+const GatewayGroup = "gateway.networking.k8s.io"
+
+// CertManagerGroup is the API group of the cert-manager certificates
+const CertManagerGroup = "cert-manager.io"
+
 // CheckUnsupportedKey checks if given komposeObject contains
 // keys that are not supported by this transformer.
 // list of all unsupported keys are stored in unsupportedKey variable
-// returns list of TODO: ....
-func (k *Kubernetes) CheckUnsupportedKey(komposeObject *kobject.KomposeObject, unsupportedKey map[string]bool) []string {
+// returns a diagnostic for every unsupported key, by service
+func (k *Kubernetes) CheckUnsupportedKey(komposeObject *kobject.KomposeObject, unsupportedKey map[string]bool) diagnostics.Diagnostics {
 	// collect all keys found in project
-	var keysFound []string
+	var keysFound diagnostics.Diagnostics
+
+	provider := "Kubernetes"
+	if strings.EqualFold(k.Opt.Provider, "openshift") {
+		provider = "OpenShift"
+	}
+
+	var names []string
+	for name := range komposeObject.ServiceConfigs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-	for _, serviceConfig := range komposeObject.ServiceConfigs {
+	for _, name := range names {
+		serviceConfig := komposeObject.ServiceConfigs[name]
 		// this reflection is used in check for empty arrays
 		val := reflect.ValueOf(serviceConfig)
 		s := structs.New(serviceConfig)
 
 		for _, f := range s.Fields() {
-			// Check if given key is among unsupported keys, and skip it if we already saw this key
-			if alreadySaw, ok := unsupportedKey[f.Name()]; ok && !alreadySaw {
+			// Check if given key is among unsupported keys
+			if unsupportedKey[f.Name()] {
 				if f.IsExported() && !f.IsZero() {
 					// IsZero returns false for empty array/slice ([])
 					// this check if field is Slice, and then it checks its size
@@ -92,8 +132,13 @@ func (k *Kubernetes) CheckUnsupportedKey(komposeObject *kobject.KomposeObject, u
 					}
 					//get tag from kobject service configure
 					tag := f.Tag(komposeObject.LoadedFrom)
-					keysFound = append(keysFound, tag)
-					unsupportedKey[f.Name()] = true
+					keysFound = append(keysFound, diagnostics.Diagnostic{
+						RuleID:   diagnostics.RuleUnsupportedKey,
+						Severity: diagnostics.SeverityWarning,
+						Service:  serviceConfig.Name,
+						Path:     diagnostics.ServicePath(serviceConfig.Name, tag),
+						Message:  fmt.Sprintf("%s provider doesn't support %s key - ignoring for service %s", provider, tag, serviceConfig.Name),
+					})
 				}
 			}
 		}
@@ -142,7 +187,7 @@ func (k *Kubernetes) InitPodSpecWithConfigMap(name string, image string, service
 		volSource.Name = cmVolName
 		key, err := service.GetConfigMapKeyFromMeta(value.Source)
 		if err != nil {
-			log.Warnf("cannot parse config %s , %s", value.Source, err.Error())
+			k.Opt.Diagnostics.Warnf(diagnostics.RuleInvalidValue, service.Name, diagnostics.ServicePath(service.Name, "configs"), "cannot parse config %s , %s", value.Source, err.Error())
 			// mostly it's external
 			continue
 		}
@@ -213,10 +258,10 @@ func (k *Kubernetes) InitSvc(name string, service kobject.ServiceConfig) *api.Se
 }
 
 // InitConfigMapForEnv initializes a ConfigMap object
-func (k *Kubernetes) InitConfigMapForEnv(name string, opt kobject.ConvertOptions, envFile string) *api.ConfigMap {
+func (k *Kubernetes) InitConfigMapForEnv(name string, opt kobject.ConvertOptions, envFile string) (*api.ConfigMap, error) {
 	envs, err := GetEnvsFromFile(envFile, opt)
 	if err != nil {
-		log.Fatalf("Unable to retrieve env file: %s", err)
+		return nil, errors.Wrap(err, "Unable to retrieve env file")
 	}
 
 	// Remove root pathing
@@ -236,7 +281,7 @@ func (k *Kubernetes) InitConfigMapForEnv(name string, opt kobject.ConvertOptions
 		Data: envs,
 	}
 
-	return configMap
+	return configMap, nil
 }
 
 // IntiConfigMapFromFileOrDir will create a configmap from dir or file
@@ -281,7 +326,10 @@ func (k *Kubernetes) IntiConfigMapFromFileOrDir(name, cmName, filePath string, s
 
 	case mode.IsRegular():
 		// do file stuff
-		configMap = k.InitConfigMapFromFile(name, service, filePath)
+		configMap, err = k.InitConfigMapFromFile(name, service, filePath)
+		if err != nil {
+			return nil, err
+		}
 		configMap.Name = cmName
 		configMap.Annotations = map[string]string{
 			"use-subpath": "true",
@@ -321,10 +369,10 @@ func initConfigMapData(configMap *api.ConfigMap, data map[string]string) {
 }
 
 //InitConfigMapFromFile initializes a ConfigMap object
-func (k *Kubernetes) InitConfigMapFromFile(name string, service kobject.ServiceConfig, fileName string) *api.ConfigMap {
+func (k *Kubernetes) InitConfigMapFromFile(name string, service kobject.ServiceConfig, fileName string) (*api.ConfigMap, error) {
 	content, err := GetContentFromFile(fileName)
 	if err != nil {
-		log.Fatalf("Unable to retrieve file: %s", err)
+		return nil, errors.Wrap(err, "Unable to retrieve file")
 	}
 
 	configMapName := ""
@@ -346,7 +394,7 @@ func (k *Kubernetes) InitConfigMapFromFile(name string, service kobject.ServiceC
 
 	data := map[string]string{filepath.Base(fileName): content}
 	initConfigMapData(configMap, data)
-	return configMap
+	return configMap, nil
 }
 
 // InitD initializes Kubernetes Deployment object
@@ -425,261 +473,905 @@ func (k *Kubernetes) InitDS(name string, service kobject.ServiceConfig) *appsv1.
 	return ds
 }
 
-func (k *Kubernetes) initIngress(name string, service kobject.ServiceConfig, port int32) *networkingv1.Ingress {
-	hosts := regexp.MustCompile("[ ,]*,[ ,]*").Split(service.ExposeService, -1)
+// InitSS initializes Kubernetes StatefulSet object. The pods get their network identity from
+// the headless service named like the stateful set, created with the other services.
+func (k *Kubernetes) InitSS(name string, service kobject.ServiceConfig, replicas int) *appsv1.StatefulSet {
+	var podSpec api.PodSpec
+	if len(service.Configs) > 0 {
+		podSpec = k.InitPodSpecWithConfigMap(name, service.Image, service)
+	} else {
+		podSpec = k.InitPodSpec(name, service.Image, service.ImagePullSecret)
+	}
+
+	rp := int32(replicas)
 
-	ingress := &networkingv1.Ingress{
+	ss := &appsv1.StatefulSet{
 		TypeMeta: metav1.TypeMeta{
-			Kind:       "Ingress",
-			APIVersion: "networking.k8s.io/v1",
+			Kind:       "StatefulSet",
+			APIVersion: "apps/v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:        name,
-			Labels:      transformer.ConfigLabels(name),
-			Annotations: transformer.ConfigAnnotations(service),
-		},
-		Spec: networkingv1.IngressSpec{
-			Rules: make([]networkingv1.IngressRule, len(hosts)),
+			Name:   name,
+			Labels: transformer.ConfigAllLabels(name, &service),
 		},
-	}
-	tlsHosts := make([]string, len(hosts))
-	pathType := networkingv1.PathTypePrefix
-	for i, host := range hosts {
-		host, p := transformer.ParseIngressPath(host)
-		if p == "" {
-			p = "/"
-		}
-		ingress.Spec.Rules[i] = networkingv1.IngressRule{
-			IngressRuleValue: networkingv1.IngressRuleValue{
-				HTTP: &networkingv1.HTTPIngressRuleValue{
-					Paths: []networkingv1.HTTPIngressPath{
-						{
-							Path:     p,
-							PathType: &pathType,
-							Backend: networkingv1.IngressBackend{
-								Service: &networkingv1.IngressServiceBackend{
-									Name: name,
-									Port: networkingv1.ServiceBackendPort{
-										Number: port,
-									},
-								},
-							},
-						},
-					},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &rp,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: transformer.ConfigLabels(name),
+			},
+			ServiceName: name,
+			Template: api.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: transformer.ConfigAnnotations(service),
 				},
+				Spec: podSpec,
 			},
-		}
-		if host != "true" {
-			ingress.Spec.Rules[i].Host = host
-			tlsHosts[i] = host
-		}
+		},
 	}
-	if service.ExposeServiceTLS != "" {
-		if service.ExposeServiceTLS != "true" {
-			ingress.Spec.TLS = []networkingv1.IngressTLS{
-				{
-					Hosts:      tlsHosts,
-					SecretName: service.ExposeServiceTLS,
-				},
-			}
-		} else {
-			ingress.Spec.TLS = []networkingv1.IngressTLS{
-				{
-					Hosts: tlsHosts,
-				},
-			}
-		}
+	ss.Spec.Template.Labels = transformer.ConfigLabels(name)
+
+	if update := k.getStatefulSetUpdateStrategy(service); update != nil {
+		ss.Spec.UpdateStrategy = *update
+		log.Debugf("Set statefulset '%s' update strategy: %s", name, update.Type)
 	}
 
-	return ingress
+	return ss
 }
 
-// CreateSecrets create secrets
-func (k *Kubernetes) CreateSecrets(komposeObject kobject.KomposeObject) ([]*api.Secret, error) {
-	var objects []*api.Secret
-	for name, config := range komposeObject.Secrets {
-		if config.File != "" {
-			dataString, err := GetContentFromFile(config.File)
-			if err != nil {
-				log.Fatal("unable to read secret from file: ", config.File)
-				return nil, err
-			}
-			data := []byte(dataString)
-			secret := &api.Secret{
-				TypeMeta: metav1.TypeMeta{
-					Kind:       "Secret",
-					APIVersion: "v1",
-				},
-				ObjectMeta: metav1.ObjectMeta{
-					Name:   FormatResourceName(name),
-					Labels: transformer.ConfigLabels(name),
-				},
-				Type: api.SecretTypeOpaque,
-				Data: map[string][]byte{name: data},
-			}
-			objects = append(objects, secret)
-		} else {
-			log.Warnf("External secrets %s is not currently supported - ignoring", name)
-		}
+// getStatefulSetUpdateStrategy maps deploy.update_config to the update strategy of a stateful set.
+// A stateful set replaces its pods one at a time, the last one first, stopping a pod before starting
+// its replacement: the parallelism and the start-first order can't be kept.
+func (k *Kubernetes) getStatefulSetUpdateStrategy(service kobject.ServiceConfig) *appsv1.StatefulSetUpdateStrategy {
+	config := service.DeployUpdateConfig
+	if config.Order == "" && config.Parallelism == nil {
+		return nil
+	}
+	if config.Parallelism != nil && *config.Parallelism != 1 {
+		k.Opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, diagnostics.ServicePath(service.Name, "deploy.update_config.parallelism"),
+			"A statefulset updates its pods one at a time, ignoring parallelism %d of service %q", *config.Parallelism, service.Name)
+	}
+	if config.Order == "start-first" {
+		k.Opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, diagnostics.ServicePath(service.Name, "deploy.update_config.order"),
+			"A statefulset stops a pod before starting its replacement, ignoring order start-first of service %q", service.Name)
+	}
+
+	partition := int32(0)
+	return &appsv1.StatefulSetUpdateStrategy{
+		Type: appsv1.RollingUpdateStatefulSetStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{
+			Partition: &partition,
+		},
 	}
-	return objects, nil
 }
 
-// CreatePVC initializes PersistentVolumeClaim
-func (k *Kubernetes) CreatePVC(name string, mode string, size string, selectorValue string, storageClassName string) (*api.PersistentVolumeClaim, error) {
-	volSize, err := resource.ParseQuantity(size)
-	if err != nil {
-		return nil, errors.Wrap(err, "resource.ParseQuantity failed, Error parsing size")
+// IsJob tells if a service runs to completion and is converted to a job: a service with a schedule,
+// a service deployed as a job, or a service which isn't restarted when no controller is requested.
+func IsJob(service kobject.ServiceConfig, opt kobject.ConvertOptions) bool {
+	switch {
+	case service.CronJobSchedule != "":
+		return true
+	case service.DeployMode == "replicated-job" || service.DeployMode == "global-job":
+		_, ok := service.Labels[compose.LabelControllerType]
+		return opt.Controller == "" && !ok
+	default:
+		return (service.Restart == "no" || service.Restart == "none" || service.Restart == "on-failure") && !opt.IsPodController()
 	}
+}
 
-	pvc := &api.PersistentVolumeClaim{
+// InitJob initializes Kubernetes Job object
+func (k *Kubernetes) InitJob(name string, service kobject.ServiceConfig, replicas int) *batchv1.Job {
+	return &batchv1.Job{
 		TypeMeta: metav1.TypeMeta{
-			Kind:       "PersistentVolumeClaim",
-			APIVersion: "v1",
+			Kind:       "Job",
+			APIVersion: "batch/v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:   name,
-			Labels: transformer.ConfigLabels(name),
+			Labels: transformer.ConfigAllLabels(name, &service),
 		},
-		Spec: api.PersistentVolumeClaimSpec{
-			Resources: api.ResourceRequirements{
-				Requests: api.ResourceList{
-					api.ResourceStorage: volSize,
+		Spec: k.initJobSpec(name, service, replicas),
+	}
+}
+
+// InitCronJob initializes Kubernetes CronJob object, running the job on the schedule of the service
+func (k *Kubernetes) InitCronJob(name string, service kobject.ServiceConfig, replicas int) *batchv1.CronJob {
+	cronJob := &batchv1.CronJob{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "CronJob",
+			APIVersion: "batch/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: transformer.ConfigAllLabels(name, &service),
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule:                   service.CronJobSchedule,
+			ConcurrencyPolicy:          batchv1.ConcurrencyPolicy(service.CronJobConcurrencyPolicy),
+			SuccessfulJobsHistoryLimit: service.CronJobSuccessfulJobsHistoryLimit,
+			FailedJobsHistoryLimit:     service.CronJobFailedJobsHistoryLimit,
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: transformer.ConfigLabels(name),
 				},
+				Spec: k.initJobSpec(name, service, replicas),
 			},
 		},
 	}
+	return cronJob
+}
 
-	if len(selectorValue) > 0 {
-		pvc.Spec.Selector = &metav1.LabelSelector{
-			MatchLabels: transformer.ConfigLabels(selectorValue),
-		}
-	}
-
-	if mode == "ro" {
-		pvc.Spec.AccessModes = []api.PersistentVolumeAccessMode{api.ReadOnlyMany}
+// initJobSpec creates the specification of the job of a service. A service deployed as a job runs
+// its replicas in parallel, and deploy.restart_policy.max_attempts limits the retries of its pods.
+func (k *Kubernetes) initJobSpec(name string, service kobject.ServiceConfig, replicas int) batchv1.JobSpec {
+	var podSpec api.PodSpec
+	if len(service.Configs) > 0 {
+		podSpec = k.InitPodSpecWithConfigMap(name, service.Image, service)
 	} else {
-		pvc.Spec.AccessModes = []api.PersistentVolumeAccessMode{api.ReadWriteOnce}
+		podSpec = k.InitPodSpec(name, service.Image, service.ImagePullSecret)
 	}
 
-	if len(storageClassName) > 0 {
-		pvc.Spec.StorageClassName = &storageClassName
+	spec := batchv1.JobSpec{
+		Template: api.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels:      transformer.ConfigLabels(name),
+				Annotations: transformer.ConfigAnnotations(service),
+			},
+			Spec: podSpec,
+		},
 	}
 
-	return pvc, nil
-}
+	switch service.DeployMode {
+	case "replicated-job":
+		parallelism, completions := int32(replicas), int32(replicas)
+		spec.Parallelism = &parallelism
+		spec.Completions = &completions
+	case "global-job":
+		parallelism, completions := int32(replicas), int32(replicas)
+		spec.Parallelism = &parallelism
+		spec.Completions = &completions
+		k.Opt.Diagnostics.Warnf(diagnostics.RuleController, service.Name, diagnostics.ServicePath(service.Name, "deploy.mode"),
+			"Kubernetes can't run a job once on every node, the global job of service %q runs %d pods in parallel", service.Name, replicas)
+	}
 
-// ConfigPorts configures the container ports.
-func ConfigPorts(service kobject.ServiceConfig) []api.ContainerPort {
-	var ports []api.ContainerPort
-	exist := map[string]bool{}
-	for _, port := range service.Port {
-		if exist[port.ID()] {
-			continue
-		}
-		containerPort := api.ContainerPort{
-			ContainerPort: port.ContainerPort,
-			HostIP:        port.HostIP,
-		}
-		// If the default is already TCP, no need to include protocol.
-		if protocol := api.Protocol(port.Protocol); protocol != api.ProtocolTCP {
-			containerPort.Protocol = protocol
-		}
-		ports = append(ports, containerPort)
-		exist[port.ID()] = true
+	policy := service.DeployRestartPolicy
+	if service.Restart == "no" || service.Restart == "none" {
+		backoffLimit := int32(0)
+		spec.BackoffLimit = &backoffLimit
+	} else if policy.MaxAttempts != nil {
+		backoffLimit := int32(*policy.MaxAttempts)
+		spec.BackoffLimit = &backoffLimit
+	}
+	if policy.Delay != nil {
+		k.Opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, diagnostics.ServicePath(service.Name, "deploy.restart_policy.delay"),
+			"Kubernetes retries the pods of a job with an exponential back-off delay, ignoring delay %s of service %q", time.Duration(*policy.Delay), service.Name)
 	}
 
-	return ports
+	return spec
 }
 
-func (k *Kubernetes) ConfigLBServicePorts(service kobject.ServiceConfig) ([]api.ServicePort, []api.ServicePort) {
-	var tcpPorts []api.ServicePort
-	var udpPorts []api.ServicePort
-	for _, port := range service.Port {
-		if port.HostPort == 0 {
-			port.HostPort = port.ContainerPort
-		}
-		var targetPort intstr.IntOrString
-		targetPort.IntVal = port.ContainerPort
-		targetPort.StrVal = strconv.Itoa(int(port.ContainerPort))
+// CreateJobAndConfigMapObjects generates the job, or the cron job, of a service which runs to completion
+// and its config maps
+func (k *Kubernetes) CreateJobAndConfigMapObjects(name string, service kobject.ServiceConfig, opt kobject.ConvertOptions) ([]runtime.Object, error) {
+	var objects []runtime.Object
+	var replica int
 
-		servicePort := api.ServicePort{
-			Name:       strconv.Itoa(int(port.HostPort)),
-			Port:       port.HostPort,
-			TargetPort: targetPort,
-		}
+	if opt.IsReplicaSetFlag || service.Replicas == 0 {
+		replica = opt.Replicas
+	} else {
+		replica = service.Replicas
+	}
 
-		if protocol := api.Protocol(port.Protocol); protocol == api.ProtocolTCP {
-			// If the default is already TCP, no need to include protocol.
-			tcpPorts = append(tcpPorts, servicePort)
-		} else {
-			servicePort.Protocol = protocol
-			udpPorts = append(udpPorts, servicePort)
+	if len(service.Configs) > 0 {
+		var err error
+		objects, err = k.createConfigMapFromComposeConfig(name, service, objects)
+		if err != nil {
+			return nil, err
 		}
 	}
-	return tcpPorts, udpPorts
-}
 
-// ConfigServicePorts configure the container service ports.
-func (k *Kubernetes) ConfigServicePorts(service kobject.ServiceConfig) []api.ServicePort {
-	servicePorts := []api.ServicePort{}
-	seenPorts := make(map[int]struct{}, len(service.Port))
+	if service.CronJobSchedule != "" {
+		log.Infof("Create kubernetes cronjob for service %s running on schedule %q", name, service.CronJobSchedule)
+		objects = append(objects, k.InitCronJob(name, service, replica))
+	} else {
+		log.Infof("Create kubernetes job instead of pod controller for service %s, restart policy: %q, deploy mode: %q", name, service.Restart, service.DeployMode)
+		objects = append(objects, k.InitJob(name, service, replica))
+	}
 
-	var servicePort api.ServicePort
-	for _, port := range service.Port {
-		if port.HostPort == 0 {
-			port.HostPort = port.ContainerPort
+	if len(service.EnvFile) > 0 {
+		for _, envFile := range service.EnvFile {
+			configMap, err := k.InitConfigMapForEnv(name, opt, envFile)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, configMap)
 		}
+	}
 
-		var targetPort intstr.IntOrString
-		targetPort.IntVal = port.ContainerPort
-		targetPort.StrVal = strconv.Itoa(int(port.ContainerPort))
+	return objects, nil
+}
 
-		// decide the name based on whether we saw this port before
-		name := strconv.Itoa(int(port.HostPort))
-		if _, ok := seenPorts[int(port.HostPort)]; ok {
-			// https://github.com/kubernetes/kubernetes/issues/2995
-			if service.ServiceType == string(api.ServiceTypeLoadBalancer) {
-				log.Fatalf("Service %s of type LoadBalancer cannot use TCP and UDP for the same port", name)
-			}
-			name = fmt.Sprintf("%s-%s", name, strings.ToLower(port.Protocol))
-		}
+// exposeRule is a path of a host name a service is exposed on, with the port of the service it routes to.
+// The host is empty when the service is exposed without a host name.
+type exposeRule struct {
+	host string
+	path string
+	port int32
+}
 
-		servicePort = api.ServicePort{
-			Name:       name,
-			Port:       port.HostPort,
-			TargetPort: targetPort,
+// exposeRules returns the paths of the host names of kompose.service.expose. A host name giving no
+// path, like example.com rather than example.com/shop, is exposed on the paths of
+// kompose.service.expose.path, / by default. The paths route to the port of kompose.service.expose.port,
+// the first port of the service by default, unless they name one.
+func exposeRules(service kobject.ServiceConfig, svc *api.Service) ([]exposeRule, error) {
+	hasPort := map[int32]bool{}
+	for _, port := range svc.Spec.Ports {
+		hasPort[port.Port] = true
+	}
+	checkPort := func(port int32) error {
+		if !hasPort[port] {
+			return errors.Errorf("kompose.service.expose of service %s routes to port %d, which isn't a port of the service", service.Name, port)
 		}
+		return nil
+	}
 
-		if service.ServiceType == string(api.ServiceTypeNodePort) && service.NodePortPort != 0 {
-			servicePort.NodePort = service.NodePortPort
+	defaultPort := svc.Spec.Ports[0].Port
+	if service.ExposeServicePort != 0 {
+		if err := checkPort(service.ExposeServicePort); err != nil {
+			return nil, err
 		}
+		defaultPort = service.ExposeServicePort
+	}
+	paths := []kobject.ExposePath{{Path: "/"}}
+	if len(service.ExposeServicePath) > 0 {
+		paths = service.ExposeServicePath
+	}
 
-		// If the default is already TCP, no need to include protocol.
-		if protocol := api.Protocol(port.Protocol); protocol != api.ProtocolTCP {
-			servicePort.Protocol = protocol
+	var rules []exposeRule
+	for _, host := range regexp.MustCompile("[ ,]*,[ ,]*").Split(service.ExposeService, -1) {
+		host, p := transformer.ParseIngressPath(host)
+		if host == "true" {
+			host = ""
+		}
+		if p != "" {
+			rules = append(rules, exposeRule{host: host, path: p, port: defaultPort})
+			continue
+		}
+		for _, path := range paths {
+			port := defaultPort
+			if path.Port != 0 {
+				if err := checkPort(path.Port); err != nil {
+					return nil, err
+				}
+				port = path.Port
+			}
+			rules = append(rules, exposeRule{host: host, path: path.Path, port: port})
 		}
-
-		servicePorts = append(servicePorts, servicePort)
-		seenPorts[int(port.HostPort)] = struct{}{}
 	}
-	return servicePorts
+	return rules, nil
 }
 
-//ConfigCapabilities configure POSIX capabilities that can be added or removed to a container
-func ConfigCapabilities(service kobject.ServiceConfig) *api.Capabilities {
-	capsAdd := []api.Capability{}
-	capsDrop := []api.Capability{}
-	for _, capAdd := range service.CapAdd {
-		capsAdd = append(capsAdd, api.Capability(capAdd))
-	}
-	for _, capDrop := range service.CapDrop {
-		capsDrop = append(capsDrop, api.Capability(capDrop))
-	}
-	return &api.Capabilities{
-		Add:  capsAdd,
-		Drop: capsDrop,
-	}
+// exposeAnnotations returns the annotations of the object exposing a service, given by the
+// kompose.service.expose.annotation labels. The other labels of the service only annotate its pods.
+func exposeAnnotations(service kobject.ServiceConfig) map[string]string {
+	annotations := transformer.ConfigAnnotations(kobject.ServiceConfig{
+		WithKomposeAnnotation: service.WithKomposeAnnotation,
+		KomposeCommand:        service.KomposeCommand,
+	})
+	for key, value := range service.ExposeAnnotations {
+		annotations[key] = value
+	}
+	return annotations
+}
+
+func (k *Kubernetes) initIngress(name string, service kobject.ServiceConfig, rules []exposeRule) *networkingv1.Ingress {
+	ingress := &networkingv1.Ingress{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Ingress",
+			APIVersion: "networking.k8s.io/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      transformer.ConfigLabels(name),
+			Annotations: exposeAnnotations(service),
+		},
+	}
+	if service.ExposeIngressClassName != "" {
+		ingress.Spec.IngressClassName = &service.ExposeIngressClassName
+	}
+
+	// the paths of a host name are gathered in a single rule
+	var tlsHosts []string
+	hostRule := map[string]int{}
+	pathType := networkingv1.PathTypePrefix
+	for _, r := range rules {
+		i, ok := hostRule[r.host]
+		if !ok {
+			i = len(ingress.Spec.Rules)
+			hostRule[r.host] = i
+			ingress.Spec.Rules = append(ingress.Spec.Rules, networkingv1.IngressRule{
+				Host: r.host,
+				IngressRuleValue: networkingv1.IngressRuleValue{
+					HTTP: &networkingv1.HTTPIngressRuleValue{},
+				},
+			})
+			tlsHosts = append(tlsHosts, r.host)
+		}
+		http := ingress.Spec.Rules[i].HTTP
+		http.Paths = append(http.Paths, networkingv1.HTTPIngressPath{
+			Path:     r.path,
+			PathType: &pathType,
+			Backend: networkingv1.IngressBackend{
+				Service: &networkingv1.IngressServiceBackend{
+					Name: name,
+					Port: networkingv1.ServiceBackendPort{
+						Number: r.port,
+					},
+				},
+			},
+		})
+	}
+	if secret := k.tlsSecretName(name, service); secret != "" {
+		ingress.Spec.TLS = []networkingv1.IngressTLS{
+			{
+				Hosts:      tlsHosts,
+				SecretName: secret,
+			},
+		}
+	} else if service.ExposeServiceTLS == "true" {
+		ingress.Spec.TLS = []networkingv1.IngressTLS{
+			{
+				Hosts: tlsHosts,
+			},
+		}
+	}
+
+	return ingress
+}
+
+// InitExpose returns the object exposing a service out of the cluster, an Ingress or an HTTPRoute
+// of the Gateway API depending on --expose-mode
+func (k *Kubernetes) InitExpose(name string, service kobject.ServiceConfig, svc *api.Service) (runtime.Object, error) {
+	rules, err := exposeRules(service, svc)
+	if err != nil {
+		return nil, err
+	}
+	if k.Opt.ExposeMode == ExposeModeGateway {
+		if service.ExposeIngressClassName != "" {
+			k.Opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, diagnostics.ServicePath(service.Name, "labels."+compose.LabelServiceExposeIngressClassName),
+				"Service %s is exposed by an HTTPRoute, its ingress class is ignored", service.Name)
+		}
+		return k.initHTTPRoute(name, service, rules), nil
+	}
+	return k.initIngress(name, service, rules), nil
+}
+
+// gatewayRef returns the reference to the parent Gateway of the HTTP routes, given as name or namespace/name
+func gatewayRef(gateway string) map[string]interface{} {
+	ref := map[string]interface{}{
+		"group": GatewayGroup,
+		"kind":  "Gateway",
+		"name":  gateway,
+	}
+	if i := strings.Index(gateway, "/"); i >= 0 {
+		ref["namespace"], ref["name"] = gateway[:i], gateway[i+1:]
+	}
+	return ref
+}
+
+// initHTTPRoute initializes the HTTPRoute of the Gateway API routing the host names of
+// kompose.service.expose to the service. The Gateway API isn't part of the Kubernetes API
+// kompose is built with, so the route is an unstructured object.
+func (k *Kubernetes) initHTTPRoute(name string, service kobject.ServiceConfig, rules []exposeRule) *unstructured.Unstructured {
+	// the rules of an HTTP route apply to all its host names
+	var hostnames []interface{}
+	var routeRules []interface{}
+	hasHost := map[string]bool{}
+	hasRule := map[exposeRule]bool{}
+	for _, r := range rules {
+		if r.host != "" && !hasHost[r.host] {
+			hasHost[r.host] = true
+			hostnames = append(hostnames, r.host)
+		}
+		r.host = ""
+		if hasRule[r] {
+			continue
+		}
+		hasRule[r] = true
+		routeRules = append(routeRules, map[string]interface{}{
+			"matches": []interface{}{
+				map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":  "PathPrefix",
+						"value": r.path,
+					},
+				},
+			},
+			"backendRefs": []interface{}{
+				map[string]interface{}{
+					"name": name,
+					"port": int64(r.port),
+				},
+			},
+		})
+	}
+	if len(routeRules)*len(hasHost) > len(rules) {
+		k.Opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, diagnostics.ServicePath(service.Name, "labels."+compose.LabelServiceExpose),
+			"The paths of the host names of service %s are routed on all its host names by the HTTPRoute", service.Name)
+	}
+	if (service.ExposeServiceTLS != "" || service.ExposeTLSCert != "") && k.Opt.GatewayClass == "" {
+		k.Opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, diagnostics.ServicePath(service.Name, "labels."+compose.LabelServiceExposeTLSSecret),
+			"TLS is terminated by the listeners of Gateway %s, the TLS secret of service %s has to be set on them", k.Opt.Gateway, service.Name)
+	}
+
+	spec := map[string]interface{}{
+		"parentRefs": []interface{}{gatewayRef(k.Opt.Gateway)},
+		"rules":      routeRules,
+	}
+	if len(hostnames) > 0 {
+		spec["hostnames"] = hostnames
+	}
+
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": GatewayGroup + "/v1",
+		"kind":       "HTTPRoute",
+		"metadata":   map[string]interface{}{},
+		"spec":       spec,
+	}}
+	route.SetName(name)
+	route.SetLabels(transformer.ConfigLabels(name))
+	route.SetAnnotations(exposeAnnotations(service))
+	return route
+}
+
+// InitGateway initializes the parent Gateway of the HTTP routes, of the class given by
+// --gateway-class. It listens to HTTP on all the host names, and to HTTPS on the host names of the
+// services given a TLS secret.
+func (k *Kubernetes) InitGateway(komposeObject kobject.KomposeObject, opt kobject.ConvertOptions) *unstructured.Unstructured {
+	listeners := []interface{}{
+		map[string]interface{}{
+			"name":     "http",
+			"protocol": "HTTP",
+			"port":     int64(80),
+		},
+	}
+	// the services sharing a hostname share its listener, which holds all their certificates
+	byHost := map[string]map[string]interface{}{}
+	names := map[string]bool{"http": true}
+	for _, name := range SortedKeys(komposeObject) {
+		service := komposeObject.ServiceConfigs[name]
+		if service.ExposeService == "" {
+			continue
+		}
+		secret := k.tlsSecretName(name, service)
+		if secret == "" {
+			if service.ExposeServiceTLS == "true" {
+				opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, diagnostics.ServicePath(service.Name, "labels."+compose.LabelServiceExposeTLSSecret),
+					"The HTTPS listeners of the Gateway need a TLS secret, service %s isn't given one", service.Name)
+			}
+			continue
+		}
+		certificateRef := map[string]interface{}{
+			"kind": "Secret",
+			"name": secret,
+		}
+		for _, host := range regexp.MustCompile("[ ,]*,[ ,]*").Split(service.ExposeService, -1) {
+			host, _ = transformer.ParseIngressPath(host)
+			if host == "true" {
+				host = ""
+			}
+			if listener, ok := byHost[host]; ok {
+				tls := listener["tls"].(map[string]interface{})
+				refs := tls["certificateRefs"].([]interface{})
+				if !containsCertificateRef(refs, secret) {
+					tls["certificateRefs"] = append(refs, certificateRef)
+				}
+				continue
+			}
+			listener := map[string]interface{}{
+				"name":     gatewayListenerName(host, names),
+				"protocol": "HTTPS",
+				"port":     int64(443),
+				"tls": map[string]interface{}{
+					"mode":            "Terminate",
+					"certificateRefs": []interface{}{certificateRef},
+				},
+			}
+			if host != "" {
+				listener["hostname"] = host
+			}
+			byHost[host] = listener
+			listeners = append(listeners, listener)
+		}
+	}
+
+	gateway := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": GatewayGroup + "/v1",
+		"kind":       "Gateway",
+		"metadata":   map[string]interface{}{},
+		"spec": map[string]interface{}{
+			"gatewayClassName": opt.GatewayClass,
+			"listeners":        listeners,
+		},
+	}}
+	gateway.SetName(opt.Gateway)
+	gateway.SetLabels(transformer.ConfigLabels(opt.Gateway))
+	return gateway
+}
+
+// gatewayListenerName returns a unique listener name for a hostname, made of lowercase alphanumeric
+// characters and dashes as the Gateway API requires, like https-wildcard-example-com for *.example.com
+func gatewayListenerName(host string, names map[string]bool) string {
+	name := "https"
+	if host != "" {
+		host = strings.Replace(strings.ToLower(host), "*", "wildcard", -1)
+		name += "-" + strings.Trim(regexp.MustCompile("[^a-z0-9]+").ReplaceAllString(host, "-"), "-")
+	}
+	if len(name) > 250 {
+		name = strings.TrimRight(name[:250], "-")
+	}
+	unique := name
+	for i := 2; names[unique]; i++ {
+		unique = fmt.Sprintf("%s-%d", name, i)
+	}
+	names[unique] = true
+	return unique
+}
+
+// containsCertificateRef returns whether the certificate references of a listener include a secret
+func containsCertificateRef(refs []interface{}, secret string) bool {
+	for _, ref := range refs {
+		if ref.(map[string]interface{})["name"] == secret {
+			return true
+		}
+	}
+	return false
+}
+
+// tlsSecretName returns the name of the TLS secret of an exposed service, given by
+// kompose.service.expose.tls-secret, or named after the service when the secret is generated from
+// the PEM files of the service or issued by cert-manager
+func (k *Kubernetes) tlsSecretName(name string, service kobject.ServiceConfig) string {
+	if service.ExposeServiceTLS != "" && service.ExposeServiceTLS != "true" {
+		return service.ExposeServiceTLS
+	}
+	if service.ExposeTLSCert != "" || (service.ExposeServiceTLS == "true" && k.Opt.CertManagerIssuer != "") {
+		return FormatResourceName(name + "-tls")
+	}
+	return ""
+}
+
+// exposeHosts returns the host names of kompose.service.expose, without their paths
+func exposeHosts(service kobject.ServiceConfig) []string {
+	var hosts []string
+	for _, host := range regexp.MustCompile("[ ,]*,[ ,]*").Split(service.ExposeService, -1) {
+		if host, _ = transformer.ParseIngressPath(host); host != "true" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// InitExposeTLS returns the TLS secret of an exposed service, issued by cert-manager with
+// --cert-manager-issuer or read from the PEM files of kompose.service.expose.tls-cert and
+// kompose.service.expose.tls-key, nil when the secret isn't generated
+func (k *Kubernetes) InitExposeTLS(name string, service kobject.ServiceConfig) (runtime.Object, error) {
+	secretName := k.tlsSecretName(name, service)
+	if secretName == "" {
+		return nil, nil
+	}
+	if k.Opt.CertManagerIssuer != "" {
+		CheckIssuedTLSFiles(service, k.Opt)
+		if cert := k.initCertificate(name, service, secretName); cert != nil {
+			return cert, nil
+		}
+		return nil, nil
+	}
+	if service.ExposeTLSCert == "" {
+		return nil, nil
+	}
+
+	cert, key, err := k.ReadTLSFiles(service)
+	if err != nil {
+		return nil, err
+	}
+	return &api.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   secretName,
+			Labels: transformer.ConfigLabels(name),
+		},
+		Type: api.SecretTypeTLS,
+		Data: map[string][]byte{
+			api.TLSCertKey:       cert,
+			api.TLSPrivateKeyKey: key,
+		},
+	}, nil
+}
+
+// ReadTLSFiles returns the certificate and the key of an exposed service, read from the PEM files of
+// kompose.service.expose.tls-cert and kompose.service.expose.tls-key. The key has to match the
+// certificate, which has to be valid for the host names of the service.
+func (k *Kubernetes) ReadTLSFiles(service kobject.ServiceConfig) ([]byte, []byte, error) {
+	var files [2][]byte
+	for i, file := range []string{service.ExposeTLSCert, service.ExposeTLSKey} {
+		path, err := composeFilePath(file, k.Opt)
+		if err != nil {
+			return nil, nil, err
+		}
+		if files[i], err = ioutil.ReadFile(path); err != nil {
+			return nil, nil, errors.Wrapf(err, "Unable to read the TLS files of service %s", service.Name)
+		}
+	}
+	cert, key := files[0], files[1]
+
+	pair, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Invalid TLS files %s and %s of service %s", service.ExposeTLSCert, service.ExposeTLSKey, service.Name)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Invalid certificate %s of service %s", service.ExposeTLSCert, service.Name)
+	}
+	for _, host := range exposeHosts(service) {
+		if err := leaf.VerifyHostname(host); err != nil {
+			return nil, nil, errors.Wrapf(err, "The certificate %s of service %s doesn't cover its host name %s", service.ExposeTLSCert, service.Name, host)
+		}
+	}
+	if time.Now().After(leaf.NotAfter) {
+		k.Opt.Diagnostics.Warnf(diagnostics.RuleInvalidValue, service.Name, diagnostics.ServicePath(service.Name, "labels."+compose.LabelServiceExposeTLSCert),
+			"The certificate %s of service %s expired on %s", service.ExposeTLSCert, service.Name, leaf.NotAfter.Format(time.RFC3339))
+	}
+	return cert, key, nil
+}
+
+// CheckIssuedTLSFiles reports the TLS files of a service, which are ignored when cert-manager issues
+// its certificate with --cert-manager-issuer
+func CheckIssuedTLSFiles(service kobject.ServiceConfig, opt kobject.ConvertOptions) {
+	if opt.CertManagerIssuer == "" || (service.ExposeTLSCert == "" && service.ExposeTLSKey == "") {
+		return
+	}
+	label := compose.LabelServiceExposeTLSCert
+	if service.ExposeTLSCert == "" {
+		label = compose.LabelServiceExposeTLSKey
+	}
+	opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, diagnostics.ServicePath(service.Name, "labels."+label),
+		"The TLS files of service %s are ignored, its certificate being issued by cert-manager with --cert-manager-issuer", service.Name)
+}
+
+// CertManagerIssuerRef returns the kind and the name of the issuer given by --cert-manager-issuer,
+// as name or kind/name
+func CertManagerIssuerRef(issuer string) (string, string) {
+	if i := strings.Index(issuer, "/"); i >= 0 {
+		return issuer[:i], issuer[i+1:]
+	}
+	return "Issuer", issuer
+}
+
+// initCertificate initializes the cert-manager Certificate issuing the TLS secret of an exposed
+// service for its host names. cert-manager isn't part of the Kubernetes API kompose is built with,
+// so the certificate is an unstructured object.
+func (k *Kubernetes) initCertificate(name string, service kobject.ServiceConfig, secretName string) *unstructured.Unstructured {
+	var dnsNames []interface{}
+	for _, host := range exposeHosts(service) {
+		dnsNames = append(dnsNames, host)
+	}
+	if len(dnsNames) == 0 {
+		k.Opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, diagnostics.ServicePath(service.Name, "labels."+compose.LabelServiceExpose),
+			"cert-manager can't issue a certificate for service %s, it isn't exposed on host names", service.Name)
+		return nil
+	}
+
+	kind, issuer := CertManagerIssuerRef(k.Opt.CertManagerIssuer)
+	cert := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": CertManagerGroup + "/v1",
+		"kind":       "Certificate",
+		"metadata":   map[string]interface{}{},
+		"spec": map[string]interface{}{
+			"secretName": secretName,
+			"dnsNames":   dnsNames,
+			"issuerRef": map[string]interface{}{
+				"group": CertManagerGroup,
+				"kind":  kind,
+				"name":  issuer,
+			},
+		},
+	}}
+	cert.SetName(name)
+	cert.SetLabels(transformer.ConfigLabels(name))
+	return cert
+}
+
+// CreateSecrets create secrets
+func (k *Kubernetes) CreateSecrets(komposeObject kobject.KomposeObject) ([]*api.Secret, error) {
+	var objects []*api.Secret
+	for name, config := range komposeObject.Secrets {
+		if config.File != "" {
+			dataString, err := GetContentFromFile(config.File)
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to read secret from file %s", config.File)
+			}
+			data := []byte(dataString)
+			secret := &api.Secret{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "Secret",
+					APIVersion: "v1",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   FormatResourceName(name),
+					Labels: transformer.ConfigLabels(name),
+				},
+				Type: api.SecretTypeOpaque,
+				Data: map[string][]byte{name: data},
+			}
+			if location, ok := komposeObject.Sources.Locate("secrets." + name); k.Opt.WithSourceAnnotation && ok {
+				transformer.AnnotateSource(secret, location)
+			}
+			objects = append(objects, secret)
+		} else {
+			k.Opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedKey, "", "secrets."+name+".external", "External secrets %s is not currently supported - ignoring", name)
+		}
+	}
+	return objects, nil
+}
+
+// CreatePVC initializes PersistentVolumeClaim
+func (k *Kubernetes) CreatePVC(name string, mode string, size string, selectorValue string, storageClassName string) (*api.PersistentVolumeClaim, error) {
+	volSize, err := resource.ParseQuantity(size)
+	if err != nil {
+		return nil, errors.Wrap(err, "resource.ParseQuantity failed, Error parsing size")
+	}
+
+	pvc := &api.PersistentVolumeClaim{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "PersistentVolumeClaim",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: transformer.ConfigLabels(name),
+		},
+		Spec: api.PersistentVolumeClaimSpec{
+			Resources: api.ResourceRequirements{
+				Requests: api.ResourceList{
+					api.ResourceStorage: volSize,
+				},
+			},
+		},
+	}
+
+	if len(selectorValue) > 0 {
+		pvc.Spec.Selector = &metav1.LabelSelector{
+			MatchLabels: transformer.ConfigLabels(selectorValue),
+		}
+	}
+
+	if mode == "ro" {
+		pvc.Spec.AccessModes = []api.PersistentVolumeAccessMode{api.ReadOnlyMany}
+	} else {
+		pvc.Spec.AccessModes = []api.PersistentVolumeAccessMode{api.ReadWriteOnce}
+	}
+
+	if len(storageClassName) > 0 {
+		pvc.Spec.StorageClassName = &storageClassName
+	}
+
+	return pvc, nil
+}
+
+// ConfigPorts configures the container ports.
+func ConfigPorts(service kobject.ServiceConfig) []api.ContainerPort {
+	var ports []api.ContainerPort
+	exist := map[string]bool{}
+	for _, port := range service.Port {
+		if exist[port.ID()] {
+			continue
+		}
+		containerPort := api.ContainerPort{
+			ContainerPort: port.ContainerPort,
+			HostIP:        port.HostIP,
+		}
+		// If the default is already TCP, no need to include protocol.
+		if protocol := api.Protocol(port.Protocol); protocol != api.ProtocolTCP {
+			containerPort.Protocol = protocol
+		}
+		ports = append(ports, containerPort)
+		exist[port.ID()] = true
+	}
+
+	return ports
+}
+
+func (k *Kubernetes) ConfigLBServicePorts(service kobject.ServiceConfig) ([]api.ServicePort, []api.ServicePort) {
+	var tcpPorts []api.ServicePort
+	var udpPorts []api.ServicePort
+	for _, port := range service.Port {
+		if port.HostPort == 0 {
+			port.HostPort = port.ContainerPort
+		}
+		var targetPort intstr.IntOrString
+		targetPort.IntVal = port.ContainerPort
+		targetPort.StrVal = strconv.Itoa(int(port.ContainerPort))
+
+		servicePort := api.ServicePort{
+			Name:       strconv.Itoa(int(port.HostPort)),
+			Port:       port.HostPort,
+			TargetPort: targetPort,
+		}
+
+		if protocol := api.Protocol(port.Protocol); protocol == api.ProtocolTCP {
+			// If the default is already TCP, no need to include protocol.
+			tcpPorts = append(tcpPorts, servicePort)
+		} else {
+			servicePort.Protocol = protocol
+			udpPorts = append(udpPorts, servicePort)
+		}
+	}
+	return tcpPorts, udpPorts
+}
+
+// ConfigServicePorts configure the container service ports.
+func (k *Kubernetes) ConfigServicePorts(service kobject.ServiceConfig) ([]api.ServicePort, error) {
+	servicePorts := []api.ServicePort{}
+	seenPorts := make(map[int]struct{}, len(service.Port))
+
+	var servicePort api.ServicePort
+	for _, port := range service.Port {
+		if port.HostPort == 0 {
+			port.HostPort = port.ContainerPort
+		}
+
+		var targetPort intstr.IntOrString
+		targetPort.IntVal = port.ContainerPort
+		targetPort.StrVal = strconv.Itoa(int(port.ContainerPort))
+
+		// decide the name based on whether we saw this port before
+		name := strconv.Itoa(int(port.HostPort))
+		if _, ok := seenPorts[int(port.HostPort)]; ok {
+			// https://github.com/kubernetes/kubernetes/issues/2995
+			if service.ServiceType == string(api.ServiceTypeLoadBalancer) {
+				return nil, fmt.Errorf("Service %s of type LoadBalancer cannot use TCP and UDP for the same port", name)
+			}
+			name = fmt.Sprintf("%s-%s", name, strings.ToLower(port.Protocol))
+		}
+
+		servicePort = api.ServicePort{
+			Name:       name,
+			Port:       port.HostPort,
+			TargetPort: targetPort,
+		}
+
+		if service.ServiceType == string(api.ServiceTypeNodePort) && service.NodePortPort != 0 {
+			servicePort.NodePort = service.NodePortPort
+		}
+
+		// If the default is already TCP, no need to include protocol.
+		if protocol := api.Protocol(port.Protocol); protocol != api.ProtocolTCP {
+			servicePort.Protocol = protocol
+		}
+
+		servicePorts = append(servicePorts, servicePort)
+		seenPorts[int(port.HostPort)] = struct{}{}
+	}
+	return servicePorts, nil
+}
+
+//ConfigCapabilities configure POSIX capabilities that can be added or removed to a container
+func ConfigCapabilities(service kobject.ServiceConfig) *api.Capabilities {
+	capsAdd := []api.Capability{}
+	capsDrop := []api.Capability{}
+	for _, capAdd := range service.CapAdd {
+		capsAdd = append(capsAdd, api.Capability(capAdd))
+	}
+	for _, capDrop := range service.CapDrop {
+		capsDrop = append(capsDrop, api.Capability(capDrop))
+	}
+	return &api.Capabilities{
+		Add:  capsAdd,
+		Drop: capsDrop,
+	}
 }
 
 // ConfigTmpfs configure the tmpfs.
@@ -712,6 +1404,36 @@ func (k *Kubernetes) ConfigTmpfs(name string, service kobject.ServiceConfig) ([]
 	return volumeMounts, volumes
 }
 
+// ConfigShm configures the /dev/shm of the container of a service from its shm_size, as a memory-backed
+// empty volume of this size, the one of the service whose IPC namespace it shares, if any
+func (k *Kubernetes) ConfigShm(service kobject.ServiceConfig) ([]api.VolumeMount, []api.Volume) {
+	if service.ShmSize <= 0 {
+		return nil, nil
+	}
+	// a tmpfs or a volume mounted at /dev/shm takes precedence
+	for _, tmpfs := range service.TmpFs {
+		if strings.Split(tmpfs, ":")[0] == "/dev/shm" {
+			return nil, nil
+		}
+	}
+	for _, volume := range service.Volumes {
+		if volume.Container == "/dev/shm" {
+			return nil, nil
+		}
+	}
+	// the volumes of the containers of a group are the ones of the pods, named after their services
+	volumeName := fmt.Sprintf("%s-shm", service.Name)
+	if target := ipcModeService(service); target != "" {
+		volumeName = fmt.Sprintf("%s-shm", target)
+	}
+	volumeMounts := []api.VolumeMount{{Name: volumeName, MountPath: "/dev/shm"}}
+
+	volSource := k.ConfigEmptyVolumeSource("tmpfs")
+	volSource.EmptyDir.SizeLimit = resource.NewQuantity(int64(service.ShmSize), resource.BinarySI)
+	volumes := []api.Volume{{Name: volumeName, VolumeSource: *volSource}}
+	return volumeMounts, volumes
+}
+
 // ConfigSecretVolumes config volumes from secret.
 // Link: https://docs.docker.com/compose/compose-file/#secrets
 // In kubernetes' Secret resource, it has a data structure like a map[string]bytes, every key will act like the file name
@@ -722,12 +1444,12 @@ func (k *Kubernetes) ConfigSecretVolumes(name string, service kobject.ServiceCon
 	var volumeMounts []api.VolumeMount
 	var volumes []api.Volume
 	if len(service.Secrets) > 0 {
-		for _, secretConfig := range service.Secrets {
+		for i, secretConfig := range service.Secrets {
 			if secretConfig.UID != "" {
-				log.Warnf("Ignore pid in secrets for service: %s", name)
+				k.Opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedKey, service.Name, diagnostics.ServicePath(service.Name, fmt.Sprintf("secrets[%d].uid", i)), "Ignore pid in secrets for service: %s", name)
 			}
 			if secretConfig.GID != "" {
-				log.Warnf("Ignore gid in secrets for service: %s", name)
+				k.Opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedKey, service.Name, diagnostics.ServicePath(service.Name, fmt.Sprintf("secrets[%d].gid", i)), "Ignore gid in secrets for service: %s", name)
 			}
 
 			var itemPath string // should be the filename
@@ -817,7 +1539,7 @@ func (k *Kubernetes) ConfigVolumes(name string, service kobject.ServiceConfig) (
 
 	var count int
 	//iterating over array of `Vols` struct as it contains all necessary information about volumes
-	for _, volume := range service.Volumes {
+	for i, volume := range service.Volumes {
 		// check if ro/rw mode is defined, default rw
 		readonly := len(volume.Mode) > 0 && volume.Mode == "ro"
 
@@ -908,7 +1630,7 @@ func (k *Kubernetes) ConfigVolumes(name string, service kobject.ServiceConfig) (
 		volumes = append(volumes, vol)
 
 		if len(volume.Host) > 0 && (!useHostPath && !useConfigMap) {
-			log.Warningf("Volume mount on the host %q isn't supported - ignoring path on the host", volume.Host)
+			k.Opt.Diagnostics.Warnf(diagnostics.RuleVolumeHostPath, service.Name, diagnostics.ServicePath(service.Name, fmt.Sprintf("volumes[%d]", i)), "Volume mount on the host %q isn't supported - ignoring path on the host", volume.Host)
 		}
 	}
 
@@ -1076,7 +1798,7 @@ func configConstrains(constrains map[string]string, operator api.NodeSelectorOpe
 }
 
 // CreateWorkloadAndConfigMapObjects generates a Kubernetes artifact for each input type service
-func (k *Kubernetes) CreateWorkloadAndConfigMapObjects(name string, service kobject.ServiceConfig, opt kobject.ConvertOptions) []runtime.Object {
+func (k *Kubernetes) CreateWorkloadAndConfigMapObjects(name string, service kobject.ServiceConfig, opt kobject.ConvertOptions) ([]runtime.Object, error) {
 	var objects []runtime.Object
 	var replica int
 
@@ -1093,7 +1815,7 @@ func (k *Kubernetes) CreateWorkloadAndConfigMapObjects(name string, service kobj
 			opt.CreateD = false
 			opt.CreateDS = true
 		} else if opt.Controller != "daemonset" {
-			log.Warnf("Global deploy mode service is best converted to daemonset, now it convert to %s", opt.Controller)
+			opt.Diagnostics.Warnf(diagnostics.RuleController, service.Name, diagnostics.ServicePath(service.Name, "deploy.mode"), "Global deploy mode service is best converted to daemonset, now it convert to %s", opt.Controller)
 		}
 	}
 
@@ -1103,13 +1825,21 @@ func (k *Kubernetes) CreateWorkloadAndConfigMapObjects(name string, service kobj
 		opt.CreateDS = false
 		opt.CreateRC = false
 		if opt.Controller != "" {
-			log.Warnf("Use label %s type %s for service %s, ignore %s flags", compose.LabelControllerType, val, name, opt.Controller)
+			opt.Diagnostics.Warnf(diagnostics.RuleController, service.Name, diagnostics.ServicePath(service.Name, "labels."+compose.LabelControllerType), "Use label %s type %s for service %s, ignore %s flags", compose.LabelControllerType, val, name, opt.Controller)
 		}
 		opt.Controller = val
 	}
 
+	if service.DeployMode == "replicated-job" || service.DeployMode == "global-job" {
+		opt.Diagnostics.Warnf(diagnostics.RuleController, service.Name, diagnostics.ServicePath(service.Name, "deploy.mode"), "Job deploy mode service is best converted to job, now it convert to %s", opt.Controller)
+	}
+
 	if len(service.Configs) > 0 {
-		objects = k.createConfigMapFromComposeConfig(name, service, objects)
+		var err error
+		objects, err = k.createConfigMapFromComposeConfig(name, service, objects)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if opt.CreateD || opt.Controller == DeploymentController {
@@ -1120,49 +1850,44 @@ func (k *Kubernetes) CreateWorkloadAndConfigMapObjects(name string, service kobj
 		objects = append(objects, k.InitDS(name, service))
 	}
 
+	if opt.Controller == StatefulSetController {
+		objects = append(objects, k.InitSS(name, service, replica))
+	}
+
 	if len(service.EnvFile) > 0 {
 		for _, envFile := range service.EnvFile {
-			configMap := k.InitConfigMapForEnv(name, opt, envFile)
+			configMap, err := k.InitConfigMapForEnv(name, opt, envFile)
+			if err != nil {
+				return nil, err
+			}
 			objects = append(objects, configMap)
 		}
 	}
 
-	return objects
+	return objects, nil
 }
 
-func (k *Kubernetes) createConfigMapFromComposeConfig(name string, service kobject.ServiceConfig, objects []runtime.Object) []runtime.Object {
+func (k *Kubernetes) createConfigMapFromComposeConfig(name string, service kobject.ServiceConfig, objects []runtime.Object) ([]runtime.Object, error) {
 	for _, config := range service.Configs {
 		currentConfigName := config.Source
 		currentConfigObj := service.ConfigsMetaData[currentConfigName]
 		if currentConfigObj.External.External {
 			continue
 		}
-		currentFileName := currentConfigObj.File
-		configMap := k.InitConfigMapFromFile(name, service, currentFileName)
+		currentFileName := currentConfigObj.File
+		configMap, err := k.InitConfigMapFromFile(name, service, currentFileName)
+		if err != nil {
+			return nil, err
+		}
 		objects = append(objects, configMap)
 	}
-	return objects
-}
-
-// InitPod initializes Kubernetes Pod object
-func (k *Kubernetes) InitPod(name string, service kobject.ServiceConfig) *api.Pod {
-	pod := api.Pod{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "Pod",
-			APIVersion: "v1",
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        name,
-			Labels:      transformer.ConfigLabels(name),
-			Annotations: transformer.ConfigAnnotations(service),
-		},
-		Spec: k.InitPodSpec(name, service.Image, service.ImagePullSecret),
-	}
-	return &pod
+	return objects, nil
 }
 
-// CreateNetworkPolicy initializes Network policy
-func (k *Kubernetes) CreateNetworkPolicy(networkName string) (*networkingv1.NetworkPolicy, error) {
+// CreateNetworkPolicy isolates the pods of a network: they only accept connections from the pods
+// of the network. When egress is modelled, the pods of an internal network only connect to the
+// pods of the network too, the pods of the other networks connect anywhere.
+func (k *Kubernetes) CreateNetworkPolicy(networkName string, network dockerCliTypes.NetworkConfig, egress bool) (*networkingv1.NetworkPolicy, error) {
 	str := "true"
 	np := &networkingv1.NetworkPolicy{
 		TypeMeta: metav1.TypeMeta{
@@ -1187,9 +1912,131 @@ func (k *Kubernetes) CreateNetworkPolicy(networkName string) (*networkingv1.Netw
 		},
 	}
 
+	if egress {
+		np.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress}
+		if network.Internal {
+			np.Spec.Egress = []networkingv1.NetworkPolicyEgressRule{{
+				To: []networkingv1.NetworkPolicyPeer{{
+					PodSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"io.kompose.network/" + networkName: str},
+					},
+				}},
+			}}
+		} else {
+			np.Spec.Egress = []networkingv1.NetworkPolicyEgressRule{{}}
+		}
+	}
+
 	return np, nil
 }
 
+// publishedPolicyName returns the name of the network policy opening the published ports of a service
+func publishedPolicyName(name string) string {
+	return FormatResourceName(name + "-published")
+}
+
+// CreatePublishedPortsPolicy opens the published ports of a service, which the isolation of its
+// networks would block, to any pod or client, or to the pods of the namespace of the ingress
+// controller given by --network-policy-ingress-namespace. The ports only exposed to the other
+// services aren't opened. It returns nil when the service publishes no port.
+func (k *Kubernetes) CreatePublishedPortsPolicy(name string, service kobject.ServiceConfig, opt kobject.ConvertOptions) *networkingv1.NetworkPolicy {
+	var ports []networkingv1.NetworkPolicyPort
+	for _, port := range service.Port {
+		if port.Exposed {
+			continue
+		}
+		protocol := api.ProtocolTCP
+		if port.Protocol != "" {
+			protocol = api.Protocol(port.Protocol)
+		}
+		targetPort := intstr.FromInt(int(port.ContainerPort))
+		ports = append(ports, networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &targetPort})
+	}
+	if len(ports) == 0 {
+		return nil
+	}
+
+	rule := networkingv1.NetworkPolicyIngressRule{Ports: ports}
+	if opt.NetworkIngressNamespace != "" {
+		rule.From = []networkingv1.NetworkPolicyPeer{{
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{namespaceNameLabel: opt.NetworkIngressNamespace},
+			},
+		}}
+	}
+	return &networkingv1.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "NetworkPolicy",
+			APIVersion: "networking.k8s.io/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   publishedPolicyName(name),
+			Labels: transformer.ConfigLabels(name),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: transformer.ConfigLabels(name),
+			},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{rule},
+		},
+	}
+}
+
+// InitDefaultNetworkPolicies returns the network policies applying to all the pods when egress is
+// modelled: the one allowing DNS lookups, and the one denying the traffic the other policies don't
+// allow with --network-policy-default-deny
+func (k *Kubernetes) InitDefaultNetworkPolicies(opt kobject.ConvertOptions) []runtime.Object {
+	typeMeta := metav1.TypeMeta{
+		Kind:       "NetworkPolicy",
+		APIVersion: "networking.k8s.io/v1",
+	}
+	udp, tcp := api.ProtocolUDP, api.ProtocolTCP
+	dnsPort := intstr.FromInt(53)
+	objects := []runtime.Object{&networkingv1.NetworkPolicy{
+		TypeMeta:   typeMeta,
+		ObjectMeta: metav1.ObjectMeta{Name: "allow-dns"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+			Egress: []networkingv1.NetworkPolicyEgressRule{{
+				To: []networkingv1.NetworkPolicyPeer{{
+					NamespaceSelector: &metav1.LabelSelector{},
+					PodSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"k8s-app": "kube-dns"},
+					},
+				}},
+				Ports: []networkingv1.NetworkPolicyPort{
+					{Protocol: &udp, Port: &dnsPort},
+					{Protocol: &tcp, Port: &dnsPort},
+				},
+			}},
+		},
+	}}
+	if opt.NetworkDefaultDeny {
+		objects = append(objects, &networkingv1.NetworkPolicy{
+			TypeMeta:   typeMeta,
+			ObjectMeta: metav1.ObjectMeta{Name: "default-deny"},
+			Spec: networkingv1.NetworkPolicySpec{
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+			},
+		})
+	}
+	return objects
+}
+
+// egressModelled tells the network policies restrict the egress of the pods, with
+// --network-policy-default-deny or when a network is internal
+func egressModelled(komposeObject kobject.KomposeObject, opt kobject.ConvertOptions) bool {
+	if opt.NetworkDefaultDeny {
+		return true
+	}
+	for _, network := range komposeObject.Networks {
+		if network.Internal {
+			return true
+		}
+	}
+	return false
+}
+
 func buildServiceImage(opt kobject.ConvertOptions, service kobject.ServiceConfig, name string) error {
 	// Must build the images before conversion (got to add service.Image in case 'image' key isn't provided
 	// Check that --build is set to true
@@ -1223,7 +2070,8 @@ func buildServiceImage(opt kobject.ConvertOptions, service kobject.ServiceConfig
 	return nil
 }
 
-func (k *Kubernetes) configKubeServiceAndIngressForService(service kobject.ServiceConfig, name string, objects *[]runtime.Object) {
+func (k *Kubernetes) configKubeServiceAndIngressForService(service kobject.ServiceConfig, name string, objects *[]runtime.Object) error {
+	statefulSet := findStatefulSet(*objects)
 	if k.PortsExist(service) {
 		if service.ServiceType == "LoadBalancer" {
 			svcs := k.CreateLBService(name, service)
@@ -1231,30 +2079,399 @@ func (k *Kubernetes) configKubeServiceAndIngressForService(service kobject.Servi
 				*objects = append(*objects, svc)
 			}
 			if len(svcs) > 1 {
-				log.Warningf("Create multiple service to avoid using mixed protocol in the same service when it's loadbalander type")
+				k.Opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, diagnostics.ServicePath(service.Name, "ports"), "Create multiple service to avoid using mixed protocol in the same service when it's loadbalander type")
 			}
 		} else {
-			svc := k.CreateService(name, service)
+			svc, err := k.CreateService(name, service)
+			if err != nil {
+				return err
+			}
 			*objects = append(*objects, svc)
 			if service.ExposeService != "" {
-				*objects = append(*objects, k.initIngress(name, service, svc.Spec.Ports[0].Port))
+				expose, err := k.InitExpose(name, service, svc)
+				if err != nil {
+					return err
+				}
+				*objects = append(*objects, expose)
+				secret, err := k.InitExposeTLS(name, service)
+				if err != nil {
+					return err
+				}
+				if secret != nil {
+					*objects = append(*objects, secret)
+				}
 			}
 		}
 	} else {
-		if service.ServiceType == "Headless" {
+		if service.ServiceType == "Headless" || statefulSet != nil {
 			svc := k.CreateHeadlessService(name, service)
 			*objects = append(*objects, svc)
 		} else {
-			log.Warnf("Service %q won't be created because 'ports' is not specified", service.Name)
+			k.Opt.Diagnostics.Warnf(diagnostics.RuleServiceSkipped, service.Name, diagnostics.ServicePath(service.Name, "ports"), "Service %q won't be created because 'ports' is not specified", service.Name)
+		}
+	}
+	if statefulSet != nil {
+		return k.configGoverningService(service, name, statefulSet, objects)
+	}
+	return nil
+}
+
+// configGoverningService sets the headless service governing the network identity of the pods of
+// a stateful set. The service of a compose service with ports balances the connections between the
+// pods, so a headless service with the same ports is added next to it.
+func (k *Kubernetes) configGoverningService(service kobject.ServiceConfig, name string, statefulSet *appsv1.StatefulSet, objects *[]runtime.Object) error {
+	selector := transformer.ConfigLabels(name)
+	for _, obj := range *objects {
+		if svc, ok := obj.(*api.Service); ok && svc.Spec.ClusterIP == "None" && reflect.DeepEqual(svc.Spec.Selector, selector) {
+			statefulSet.Spec.ServiceName = svc.Name
+			return nil
+		}
+	}
+
+	svc, err := k.CreateService(name, service)
+	if err != nil {
+		return err
+	}
+	svc.Name = FormatResourceName(svc.Name + "-headless")
+	svc.Spec.Type = api.ServiceTypeClusterIP
+	svc.Spec.ClusterIP = "None"
+	for i := range svc.Spec.Ports {
+		svc.Spec.Ports[i].NodePort = 0
+	}
+	*objects = append(*objects, svc)
+	statefulSet.Spec.ServiceName = svc.Name
+	return nil
+}
+
+// setJobRestartPolicy restarts the failed containers of a job whose service is always restarted,
+// the pods of a job have to terminate
+func setJobRestartPolicy(template *api.PodTemplateSpec) {
+	if template.Spec.RestartPolicy == api.RestartPolicyAlways {
+		template.Spec.RestartPolicy = api.RestartPolicyOnFailure
+	}
+}
+
+// findStatefulSet returns the stateful set of the objects of a service, if any
+func findStatefulSet(objects []runtime.Object) *appsv1.StatefulSet {
+	for _, obj := range objects {
+		if ss, ok := obj.(*appsv1.StatefulSet); ok {
+			return ss
+		}
+	}
+	return nil
+}
+
+// ConfigVolumeClaimTemplates moves the claims created for the volumes of a stateful set to its
+// volume claim templates, so that every replica gets its own volume. It returns the claims and
+// the volumes left to create.
+func (k *Kubernetes) ConfigVolumeClaimTemplates(objects []runtime.Object, PVCs []*api.PersistentVolumeClaim, volumes []api.Volume) ([]*api.PersistentVolumeClaim, []api.Volume) {
+	statefulSet := findStatefulSet(objects)
+	if statefulSet == nil || len(PVCs) == 0 {
+		return PVCs, volumes
+	}
+
+	claims := map[string]bool{}
+	for _, template := range statefulSet.Spec.VolumeClaimTemplates {
+		claims[template.Name] = true
+	}
+	for _, pvc := range PVCs {
+		// the services of a group may share a volume
+		if claims[pvc.Name] {
+			continue
+		}
+		claims[pvc.Name] = true
+		statefulSet.Spec.VolumeClaimTemplates = append(statefulSet.Spec.VolumeClaimTemplates, api.PersistentVolumeClaim{
+			ObjectMeta: pvc.ObjectMeta,
+			Spec:       pvc.Spec,
+		})
+	}
+
+	// the pods mount the volumes of the templates by the name of the template
+	var podVolumes []api.Volume
+	for _, volume := range volumes {
+		if claim := volume.PersistentVolumeClaim; claim != nil && claims[claim.ClaimName] {
+			continue
+		}
+		podVolumes = append(podVolumes, volume)
+	}
+	return nil, podVolumes
+}
+
+// InitHPA initializes Kubernetes HorizontalPodAutoscaler object scaling a workload
+func (k *Kubernetes) InitHPA(name string, service kobject.ServiceConfig, target metav1.TypeMeta) *autoscalingv2.HorizontalPodAutoscaler {
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "HorizontalPodAutoscaler",
+			APIVersion: "autoscaling/v2",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: transformer.ConfigLabels(name),
+		},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+				Kind:       target.Kind,
+				Name:       name,
+				APIVersion: target.APIVersion,
+			},
+			MinReplicas: service.HPAMinReplicas,
+			MaxReplicas: service.HPAMaxReplicas,
+		},
+	}
+
+	utilization := func(resource api.ResourceName, percent int32) autoscalingv2.MetricSpec {
+		return autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name: resource,
+				Target: autoscalingv2.MetricTarget{
+					Type:               autoscalingv2.UtilizationMetricType,
+					AverageUtilization: &percent,
+				},
+			},
+		}
+	}
+	if service.HPACPU != 0 {
+		hpa.Spec.Metrics = append(hpa.Spec.Metrics, utilization(api.ResourceCPU, service.HPACPU))
+	}
+	if service.HPAMemory != 0 {
+		hpa.Spec.Metrics = append(hpa.Spec.Metrics, utilization(api.ResourceMemory, service.HPAMemory))
+	}
+	return hpa
+}
+
+// ConfigHorizontalPodAutoscaler adds the horizontal pod autoscaler of a service scaling
+// its deployment or stateful set
+func (k *Kubernetes) ConfigHorizontalPodAutoscaler(service kobject.ServiceConfig, name string, opt kobject.ConvertOptions, objects *[]runtime.Object) {
+	if service.HPAMaxReplicas == 0 {
+		return
+	}
+	path := diagnostics.ServicePath(service.Name, "labels."+compose.LabelHPAMaxReplicas)
+
+	var target *metav1.TypeMeta
+	var replicas *int32
+	for _, obj := range *objects {
+		switch o := obj.(type) {
+		case *appsv1.Deployment:
+			target, replicas = &o.TypeMeta, o.Spec.Replicas
+		case *appsv1.StatefulSet:
+			target, replicas = &o.TypeMeta, o.Spec.Replicas
+		case *deployapi.DeploymentConfig:
+			// the deployment configs are generated with the legacy v1 version
+			target, replicas = &metav1.TypeMeta{Kind: "DeploymentConfig", APIVersion: "apps.openshift.io/v1"}, &o.Spec.Replicas
 		}
 	}
+	if target == nil {
+		opt.Diagnostics.Warnf(diagnostics.RuleController, service.Name, path, "No horizontal pod autoscaler created for service %q, only a deployment or a statefulset can be scaled", service.Name)
+		return
+	}
+
+	min := int32(1)
+	if service.HPAMinReplicas != nil {
+		min = *service.HPAMinReplicas
+	}
+	if opt.IsReplicaSetFlag && replicas != nil && (*replicas < min || *replicas > service.HPAMaxReplicas) {
+		opt.Diagnostics.Warnf(diagnostics.RuleInvalidValue, service.Name, path,
+			"The %d replicas set with --replicas are out of the %d to %d replicas of the horizontal pod autoscaler of service %q, the autoscaler will scale them", *replicas, min, service.HPAMaxReplicas, service.Name)
+	}
+	*objects = append(*objects, k.InitHPA(name, service, *target))
+}
+
+// InitPDB initializes Kubernetes PodDisruptionBudget object, selecting the pods of the service like
+// its workload
+func (k *Kubernetes) InitPDB(name string, minAvailable *intstr.IntOrString, maxUnavailable *intstr.IntOrString) *policyv1.PodDisruptionBudget {
+	return &policyv1.PodDisruptionBudget{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "PodDisruptionBudget",
+			APIVersion: "policy/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: transformer.ConfigLabels(name),
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MinAvailable:   minAvailable,
+			MaxUnavailable: maxUnavailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: transformer.ConfigLabels(name),
+			},
+		},
+	}
+}
+
+// ConfigPodDisruptionBudget adds the pod disruption budget of a service, limiting the pods a node
+// drain takes down at once. The kompose.pdb labels set it, otherwise a service with more than one
+// replica gets one allowing as many unavailable pods as deploy.update_config.parallelism, 1 by default.
+func (k *Kubernetes) ConfigPodDisruptionBudget(service kobject.ServiceConfig, name string, objects *[]runtime.Object) {
+	var replicas int32
+	for _, obj := range *objects {
+		switch o := obj.(type) {
+		case *appsv1.Deployment:
+			replicas = *o.Spec.Replicas
+		case *appsv1.StatefulSet:
+			replicas = *o.Spec.Replicas
+		case *deployapi.DeploymentConfig:
+			replicas = o.Spec.Replicas
+		}
+	}
+	if service.HPAMinReplicas != nil && *service.HPAMinReplicas > replicas {
+		replicas = *service.HPAMinReplicas
+	}
+
+	switch {
+	case service.PDBMinAvailable != "":
+		minAvailable := intstr.Parse(service.PDBMinAvailable)
+		*objects = append(*objects, k.InitPDB(name, &minAvailable, nil))
+	case service.PDBMaxUnavailable != "":
+		maxUnavailable := intstr.Parse(service.PDBMaxUnavailable)
+		*objects = append(*objects, k.InitPDB(name, nil, &maxUnavailable))
+	case replicas > 1:
+		maxUnavailable := intstr.FromInt(1)
+		if parallelism := service.DeployUpdateConfig.Parallelism; parallelism != nil {
+			// a parallelism of 0 updates all the replicas at once
+			if *parallelism == 0 {
+				return
+			}
+			maxUnavailable = intstr.FromInt(cast.ToInt(*parallelism))
+		}
+		*objects = append(*objects, k.InitPDB(name, nil, &maxUnavailable))
+	}
+}
+
+// podServiceAccount returns the service account of the pods of a service: the one named by
+// kompose.serviceaccount-name, or the one generated for the service. It is empty when the pods
+// don't access the API.
+func podServiceAccount(name string, service kobject.ServiceConfig) string {
+	if accountName, ok := service.Labels[compose.LabelServiceAccountName]; ok {
+		return accountName
+	}
+	if service.ServiceAccountCreate || len(service.RBACRules) > 0 || service.RBACPolicyFile != "" {
+		return name
+	}
+	return ""
+}
+
+// InitServiceAccount initializes Kubernetes ServiceAccount object
+func (k *Kubernetes) InitServiceAccount(accountName string, name string) *api.ServiceAccount {
+	return &api.ServiceAccount{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ServiceAccount",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   accountName,
+			Labels: transformer.ConfigLabels(name),
+		},
+	}
+}
+
+// ConfigServiceAccount adds the service account of a service, when kompose.serviceaccount.create is
+// set or when the service is given RBAC rules, and the Role or the ClusterRole holding the rules,
+// bound to the service account. A service account named by kompose.serviceaccount-name is expected
+// to exist, unless kompose.serviceaccount.create is set.
+func (k *Kubernetes) ConfigServiceAccount(service kobject.ServiceConfig, name string, opt kobject.ConvertOptions, objects *[]runtime.Object) error {
+	accountName := podServiceAccount(name, service)
+	if accountName == "" {
+		return nil
+	}
+	if _, ok := service.Labels[compose.LabelServiceAccountName]; !ok || service.ServiceAccountCreate {
+		*objects = append(*objects, k.InitServiceAccount(accountName, name))
+	}
+
+	kind, rules := "Role", service.RBACRules
+	if service.RBACPolicyFile != "" {
+		var err error
+		kind, rules, err = readPolicyFile(service.RBACPolicyFile, opt)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to load the policy file of service %s", service.Name)
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	meta := metav1.ObjectMeta{
+		Name:   name,
+		Labels: transformer.ConfigLabels(name),
+	}
+	subjects := []rbacv1.Subject{{
+		Kind:      rbacv1.ServiceAccountKind,
+		Name:      accountName,
+		Namespace: opt.Namespace,
+	}}
+	roleRef := rbacv1.RoleRef{
+		APIGroup: rbacv1.GroupName,
+		Kind:     kind,
+		Name:     name,
+	}
+	typeMeta := func(kind string) metav1.TypeMeta {
+		return metav1.TypeMeta{Kind: kind, APIVersion: rbacv1.SchemeGroupVersion.String()}
+	}
+
+	if kind == "Role" {
+		*objects = append(*objects,
+			&rbacv1.Role{TypeMeta: typeMeta("Role"), ObjectMeta: meta, Rules: rules},
+			&rbacv1.RoleBinding{TypeMeta: typeMeta("RoleBinding"), ObjectMeta: meta, Subjects: subjects, RoleRef: roleRef},
+		)
+		return nil
+	}
+
+	// the service account bound to a cluster role has to be given its namespace
+	if subjects[0].Namespace == "" {
+		subjects[0].Namespace = "default"
+		opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, diagnostics.ServicePath(service.Name, "labels."+compose.LabelRBACPolicyFile),
+			"The cluster role binding of service %s binds the service account of the default namespace, set --namespace to bind the one of another namespace", service.Name)
+	}
+	*objects = append(*objects,
+		&rbacv1.ClusterRole{TypeMeta: typeMeta("ClusterRole"), ObjectMeta: meta, Rules: rules},
+		&rbacv1.ClusterRoleBinding{TypeMeta: typeMeta("ClusterRoleBinding"), ObjectMeta: meta, Subjects: subjects, RoleRef: roleRef},
+	)
+	return nil
+}
+
+// composeFilePath returns the path of a file named relative to the compose file
+func composeFilePath(file string, opt kobject.ConvertOptions) (string, error) {
+	if filepath.IsAbs(file) {
+		return file, nil
+	}
+	composeDir, err := transformer.GetComposeFileDir(opt.InputFiles)
+	if err != nil {
+		return "", errors.Wrap(err, "Unable to load file context")
+	}
+	return filepath.Join(composeDir, file), nil
+}
+
+// readPolicyFile returns the kind and the rules of the Role or the ClusterRole held by a file,
+// named relative to the compose file
+func readPolicyFile(file string, opt kobject.ConvertOptions) (string, []rbacv1.PolicyRule, error) {
+	file, err := composeFilePath(file, opt)
+	if err != nil {
+		return "", nil, err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	var role rbacv1.ClusterRole
+	if err := yaml.NewYAMLOrJSONDecoder(f, 4096).Decode(&role); err != nil {
+		return "", nil, errors.Wrapf(err, "Unable to parse %s", file)
+	}
+	if role.Kind != "Role" && role.Kind != "ClusterRole" {
+		return "", nil, errors.Errorf("%s must hold a Role or a ClusterRole, got %q", file, role.Kind)
+	}
+	return role.Kind, role.Rules, nil
 }
 
-func (k *Kubernetes) configNetworkPolicyForService(service kobject.ServiceConfig, name string, objects *[]runtime.Object) error {
+// configNetworkPolicyForService adds the network policies isolating the networks of a service, and
+// the one opening its published ports when its pods are isolated
+func (k *Kubernetes) configNetworkPolicyForService(komposeObject kobject.KomposeObject, service kobject.ServiceConfig, name string, opt kobject.ConvertOptions, objects *[]runtime.Object) error {
+	egress := egressModelled(komposeObject, opt)
 	if len(service.Network) > 0 {
 		for _, net := range service.Network {
 			log.Infof("Network %s is detected at Source, shall be converted to equivalent NetworkPolicy at Destination", net)
-			np, err := k.CreateNetworkPolicy(net)
+			np, err := k.CreateNetworkPolicy(net, komposeObject.Networks[net], egress)
 
 			if err != nil {
 				return errors.Wrapf(err, "Unable to create Network Policy for network %v for service %v", net, name)
@@ -1262,6 +2479,11 @@ func (k *Kubernetes) configNetworkPolicyForService(service kobject.ServiceConfig
 			*objects = append(*objects, np)
 		}
 	}
+	if len(service.Network) > 0 || opt.NetworkDefaultDeny {
+		if np := k.CreatePublishedPortsPolicy(name, service, opt); np != nil {
+			*objects = append(*objects, np)
+		}
+	}
 	return nil
 }
 
@@ -1281,7 +2503,17 @@ func (k *Kubernetes) Transform(komposeObject kobject.KomposeObject, opt kobject.
 		}
 	}
 
-	if opt.ServiceGroupMode != "" {
+	if err := CheckNetworkModes(komposeObject, opt); err != nil {
+		return nil, err
+	}
+	if err := CheckIpcModes(komposeObject, opt); err != nil {
+		return nil, err
+	}
+	if opt.NetworkDefaultDeny {
+		attachDefaultNetwork(&komposeObject)
+	}
+
+	if opt.ServiceGroupMode != "" || SharesPod(komposeObject) {
 		log.Debugf("Service group mode is: %s", opt.ServiceGroupMode)
 		komposeObjectToServiceConfigGroupMapping := KomposeObjectToServiceConfigGroupMapping(&komposeObject, opt)
 		for name, group := range komposeObjectToServiceConfigGroupMapping {
@@ -1306,6 +2538,8 @@ func (k *Kubernetes) Transform(komposeObject kobject.KomposeObject, opt kobject.
 			portsUses := map[string]bool{}
 
 			for _, service := range group {
+				serviceObjects := len(objects)
+
 				// first do ports check
 				ports := ConfigPorts(service)
 				for _, port := range ports {
@@ -1318,26 +2552,40 @@ func (k *Kubernetes) Transform(komposeObject kobject.KomposeObject, opt kobject.
 
 				log.Infof("Group Service %s to [%s]", service.Name, name)
 				service.WithKomposeAnnotation = opt.WithKomposeAnnotation
-				podSpec.Append(AddContainer(service, opt))
+				service.KomposeCommand = opt.Command
 
 				if err := buildServiceImage(opt, service, service.Name); err != nil {
 					return nil, err
 				}
+				service.User = ResolveServiceUser(service, opt)
+				podSpec.Append(AddContainer(service, opt))
+
 				// override..
-				objects = append(objects, k.CreateWorkloadAndConfigMapObjects(name, service, opt)...)
-				k.configKubeServiceAndIngressForService(service, name, &objects)
+				workloads, err := k.CreateWorkloadAndConfigMapObjects(name, service, opt)
+				if err != nil {
+					return nil, err
+				}
+				objects = append(objects, workloads...)
+				if err := k.configKubeServiceAndIngressForService(service, name, &objects); err != nil {
+					return nil, err
+				}
 
 				// Configure the container volumes.
 				volumesMount, volumes, pvc, cms, err := k.ConfigVolumes(name, service)
 				if err != nil {
 					return nil, errors.Wrap(err, "k.ConfigVolumes failed")
 				}
+				pvc, volumes = k.ConfigVolumeClaimTemplates(objects, pvc, volumes)
 				// Configure Tmpfs
 				if len(service.TmpFs) > 0 {
 					TmpVolumesMount, TmpVolumes := k.ConfigTmpfs(name, service)
 					volumes = append(volumes, TmpVolumes...)
 					volumesMount = append(volumesMount, TmpVolumesMount...)
 				}
+				// Configure shm_size
+				shmVolumesMount, shmVolumes := k.ConfigShm(service)
+				volumes = append(volumes, shmVolumes...)
+				volumesMount = append(volumesMount, shmVolumesMount...)
 				podSpec.Append(
 					SetVolumeMounts(volumesMount),
 					SetVolumes(volumes),
@@ -1362,28 +2610,40 @@ func (k *Kubernetes) Transform(komposeObject kobject.KomposeObject, opt kobject.
 					SetPorts(service),
 					ImagePullPolicy(name, service),
 					RestartPolicy(name, service),
-					SecurityContext(name, service),
+					SecurityContext(name, service, opt),
 					LivenessProbe(service),
 					ReadinessProbe(service),
 					HostName(service),
 					DomainName(service),
+					NetworkMode(service),
+					HostAliases(service, opt),
+					DNS(service, opt),
 					ResourcesLimits(service),
 					ResourcesRequests(service),
-					TerminationGracePeriodSeconds(name, service),
+					TerminationGracePeriodSeconds(name, service, opt),
 				)
 
-				if serviceAccountName, ok := service.Labels[compose.LabelServiceAccountName]; ok {
-					podSpec.Append(ServiceAccountName(serviceAccountName))
-				}
+				podSpec.Append(ServiceAccountName(podServiceAccount(name, service)))
 
 				err = k.UpdateKubernetesObjectsMultipleContainers(name, service, &objects, podSpec)
 				if err != nil {
 					return nil, errors.Wrap(err, "Error transforming Kubernetes objects")
 				}
 
-				if err = k.configNetworkPolicyForService(service, service.Name, &objects); err != nil {
+				k.ConfigHorizontalPodAutoscaler(service, name, opt, &objects)
+				k.ConfigPodDisruptionBudget(service, name, &objects)
+
+				if err = k.ConfigServiceAccount(service, name, opt, &objects); err != nil {
+					return nil, err
+				}
+
+				if err = k.configNetworkPolicyForService(komposeObject, service, service.Name, opt, &objects); err != nil {
 					return nil, err
 				}
+
+				if opt.WithSourceAnnotation {
+					AnnotateSources(service, objects[serviceObjects:])
+				}
 			}
 
 			allobjects = append(allobjects, objects...)
@@ -1401,38 +2661,75 @@ func (k *Kubernetes) Transform(komposeObject kobject.KomposeObject, opt kobject.
 		var objects []runtime.Object
 
 		service.WithKomposeAnnotation = opt.WithKomposeAnnotation
+		service.KomposeCommand = opt.Command
 
 		if err := buildServiceImage(opt, service, name); err != nil {
 			return nil, err
 		}
+		service.User = ResolveServiceUser(service, opt)
 
-		// Generate pod only and nothing more
-		if (service.Restart == "no" || service.Restart == "on-failure") && !opt.IsPodController() {
-			log.Infof("Create kubernetes pod instead of pod controller due to restart policy: %s", service.Restart)
-			pod := k.InitPod(name, service)
-			objects = append(objects, pod)
+		// Generate a job for the services which run to completion
+		var err error
+		if IsJob(service, opt) {
+			objects, err = k.CreateJobAndConfigMapObjects(name, service, opt)
 		} else {
-			objects = k.CreateWorkloadAndConfigMapObjects(name, service, opt)
+			objects, err = k.CreateWorkloadAndConfigMapObjects(name, service, opt)
+		}
+		if err != nil {
+			return nil, err
 		}
 
-		k.configKubeServiceAndIngressForService(service, name, &objects)
+		if err := k.configKubeServiceAndIngressForService(service, name, &objects); err != nil {
+			return nil, err
+		}
 
-		err := k.UpdateKubernetesObjects(name, service, opt, &objects)
+		err = k.UpdateKubernetesObjects(name, service, opt, &objects)
 		if err != nil {
 			return nil, errors.Wrap(err, "Error transforming Kubernetes objects")
 		}
 
-		if err := k.configNetworkPolicyForService(service, name, &objects); err != nil {
+		k.ConfigHorizontalPodAutoscaler(service, name, opt, &objects)
+		k.ConfigPodDisruptionBudget(service, name, &objects)
+
+		if err := k.ConfigServiceAccount(service, name, opt, &objects); err != nil {
+			return nil, err
+		}
+
+		if err := k.configNetworkPolicyForService(komposeObject, service, name, opt, &objects); err != nil {
 			return nil, err
 		}
+
+		if opt.WithSourceAnnotation {
+			AnnotateSources(service, objects)
+		}
 		allobjects = append(allobjects, objects...)
 	}
 
+	if opt.ExposeMode == ExposeModeGateway && opt.GatewayClass != "" {
+		allobjects = append(allobjects, k.InitGateway(komposeObject, opt))
+	}
+	if egressModelled(komposeObject, opt) {
+		allobjects = append(allobjects, k.InitDefaultNetworkPolicies(opt)...)
+	}
+
+	if opt.Namespace != "" {
+		k.SetNamespace(allobjects, opt.Namespace)
+	}
+	if opt.ProjectName != "" {
+		namer := &ProjectNamer{Project: opt.ProjectName, Diagnostics: opt.Diagnostics}
+		namer.Rename(allobjects)
+	}
+
 	// sort all object so Services are first
 	k.SortServicesFirst(&allobjects)
 	k.RemoveDupObjects(&allobjects)
 	// k.FixWorkloadVersion(&allobjects)
 
+	// the namespace has to be created before the objects it holds
+	if opt.CreateNamespace {
+		allobjects = append([]runtime.Object{k.InitNamespace(opt.Namespace)}, allobjects...)
+	}
+
 	return allobjects, nil
 }
 
@@ -1451,6 +2748,26 @@ func (k *Kubernetes) UpdateController(obj runtime.Object, updateTemplate func(*a
 			return errors.Wrap(err, "updateTemplate failed")
 		}
 		updateMeta(&t.ObjectMeta)
+	case *appsv1.StatefulSet:
+		err = updateTemplate(&t.Spec.Template)
+		if err != nil {
+			return errors.Wrap(err, "updateTemplate failed")
+		}
+		updateMeta(&t.ObjectMeta)
+	case *batchv1.Job:
+		err = updateTemplate(&t.Spec.Template)
+		if err != nil {
+			return errors.Wrap(err, "updateTemplate failed")
+		}
+		setJobRestartPolicy(&t.Spec.Template)
+		updateMeta(&t.ObjectMeta)
+	case *batchv1.CronJob:
+		err = updateTemplate(&t.Spec.JobTemplate.Spec.Template)
+		if err != nil {
+			return errors.Wrap(err, "updateTemplate failed")
+		}
+		setJobRestartPolicy(&t.Spec.JobTemplate.Spec.Template)
+		updateMeta(&t.ObjectMeta)
 	case *deployapi.DeploymentConfig:
 		err = updateTemplate(t.Spec.Template)
 		if err != nil {
@@ -17,22 +17,39 @@ limitations under the License.
 package kubernetes
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	dockerCliTypes "github.com/docker/cli/cli/compose/types"
+	"github.com/docker/libcompose/yaml"
 
+	"github.com/kubernetes/kompose/pkg/diagnostics"
 	"github.com/kubernetes/kompose/pkg/kobject"
 	"github.com/kubernetes/kompose/pkg/loader/compose"
 	"github.com/kubernetes/kompose/pkg/transformer"
 	deployapi "github.com/openshift/api/apps/v1"
 	"github.com/pkg/errors"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	api "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	policyv1 "k8s.io/api/policy/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -296,13 +313,13 @@ func TestKomposeConvert(t *testing.T) {
 		opt             kobject.ConvertOptions
 		expectedNumObjs int
 	}{
-		// objects generated are deployment, service nework policies (2) and pvc
-		"Convert to Deployments (D)":                  {newKomposeObject(), kobject.ConvertOptions{CreateD: true, Replicas: replicas, IsReplicaSetFlag: true}, 6},
-		"Convert to Deployments (D) with v3 replicas": {newKomposeObject(), kobject.ConvertOptions{CreateD: true}, 6},
-		"Convert to DaemonSets (DS)":                  {newKomposeObject(), kobject.ConvertOptions{CreateDS: true}, 6},
-		// objects generated are deployment, daemonset, ReplicationController, service and pvc
-		"Convert to D, DS, and RC":                  {newKomposeObject(), kobject.ConvertOptions{CreateD: true, CreateDS: true, CreateRC: true, Replicas: replicas, IsReplicaSetFlag: true}, 7},
-		"Convert to D, DS, and RC with v3 replicas": {newKomposeObject(), kobject.ConvertOptions{CreateD: true, CreateDS: true, CreateRC: true}, 7},
+		// objects generated are deployment, pod disruption budget, service, nework policies (2), published ports policy and pvc
+		"Convert to Deployments (D)":                  {newKomposeObject(), kobject.ConvertOptions{CreateD: true, Replicas: replicas, IsReplicaSetFlag: true}, 8},
+		"Convert to Deployments (D) with v3 replicas": {newKomposeObject(), kobject.ConvertOptions{CreateD: true}, 8},
+		"Convert to DaemonSets (DS)":                  {newKomposeObject(), kobject.ConvertOptions{CreateDS: true}, 7},
+		// objects generated are deployment, pod disruption budget, daemonset, ReplicationController, service, network policies (3) and pvc
+		"Convert to D, DS, and RC":                  {newKomposeObject(), kobject.ConvertOptions{CreateD: true, CreateDS: true, CreateRC: true, Replicas: replicas, IsReplicaSetFlag: true}, 9},
+		"Convert to D, DS, and RC with v3 replicas": {newKomposeObject(), kobject.ConvertOptions{CreateD: true, CreateDS: true, CreateRC: true}, 9},
 		// TODO: add more tests
 	}
 
@@ -482,16 +499,16 @@ func TestConvertRestartOptions(t *testing.T) {
 		}
 
 		if len(objs) != 1 {
-			t.Errorf("Expected only one pod, more elements generated.")
+			t.Errorf("Expected only one job, more elements generated.")
 		}
 
 		for _, obj := range objs {
-			if pod, ok := obj.(*api.Pod); ok {
-				if pod.Spec.RestartPolicy != test.restartPolicy {
-					t.Errorf("Expected restartPolicy as %s, got %#v", test.restartPolicy, pod.Spec.RestartPolicy)
+			if job, ok := obj.(*batchv1.Job); ok {
+				if job.Spec.Template.Spec.RestartPolicy != test.restartPolicy {
+					t.Errorf("Expected restartPolicy as %s, got %#v", test.restartPolicy, job.Spec.Template.Spec.RestartPolicy)
 				}
 			} else {
-				t.Errorf("Expected 'pod' object not found one")
+				t.Errorf("Expected 'job' object not found one")
 			}
 		}
 	}
@@ -744,6 +761,292 @@ func TestServiceAccountNameOnMultipleContainers(t *testing.T) {
 	}
 }
 
+func TestNetworkMode(t *testing.T) {
+	createConfig := func(name string, networkMode string) kobject.ServiceConfig {
+		config := newSimpleServiceConfig()
+		config.Name = name
+		config.ContainerName = name
+		config.NetworkMode = networkMode
+		return config
+	}
+
+	vpn := createConfig("vpn", "")
+	vpn.Network = []string{"front"}
+	komposeObject := kobject.KomposeObject{
+		ServiceConfigs: map[string]kobject.ServiceConfig{
+			"vpn":   vpn,
+			"app":   createConfig("app", "service:vpn"),
+			"agent": createConfig("agent", "host"),
+		},
+	}
+
+	k := Kubernetes{}
+	objs, err := k.Transform(komposeObject, kobject.ConvertOptions{CreateD: true})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "k.Transform failed"))
+	}
+
+	deployments := map[string]*appsv1.Deployment{}
+	for _, obj := range objs {
+		if deployment, ok := obj.(*appsv1.Deployment); ok {
+			deployments[deployment.Name] = deployment
+		}
+	}
+	if len(deployments) != 2 {
+		t.Fatalf("Expected 2 deployments, got %d", len(deployments))
+	}
+
+	podSpec := deployments["vpn"].Spec.Template.Spec
+	if len(podSpec.Containers) != 2 || podSpec.Containers[0].Name != "vpn" || podSpec.Containers[1].Name != "app" {
+		t.Errorf("Expected containers vpn and app in the pods of vpn, got %v", podSpec.Containers)
+	}
+	if podSpec.HostNetwork {
+		t.Errorf("Expected the pods of vpn not to use the host network")
+	}
+	if deployments["vpn"].Spec.Template.Labels["io.kompose.network/front"] != "true" {
+		t.Errorf("Expected the pods of vpn to be attached to network front, got labels %v", deployments["vpn"].Spec.Template.Labels)
+	}
+
+	podSpec = deployments["agent"].Spec.Template.Spec
+	if !podSpec.HostNetwork || podSpec.DNSPolicy != api.DNSClusterFirstWithHostNet {
+		t.Errorf("Expected the pods of agent to use the host network with DNS policy %s, got %v and %s",
+			api.DNSClusterFirstWithHostNet, podSpec.HostNetwork, podSpec.DNSPolicy)
+	}
+
+	komposeObject.ServiceConfigs["app"] = createConfig("app", "service:db")
+	if _, err := k.Transform(komposeObject, kobject.ConvertOptions{CreateD: true}); err == nil {
+		t.Errorf("Expected an error for the network_mode of a missing service")
+	}
+}
+
+func TestPidIpcAndShm(t *testing.T) {
+	createConfig := func(name string, ipc string, shmSize int64) kobject.ServiceConfig {
+		config := newSimpleServiceConfig()
+		config.Name = name
+		config.ContainerName = name
+		config.Ipc = ipc
+		config.ShmSize = yaml.MemStringorInt(shmSize)
+		return config
+	}
+
+	agent := createConfig("agent", "host", 0)
+	agent.Pid = "host"
+	komposeObject := kobject.KomposeObject{
+		ServiceConfigs: map[string]kobject.ServiceConfig{
+			"db":      createConfig("db", "", 256<<20),
+			"sidecar": createConfig("sidecar", "service:db", 64<<20),
+			"agent":   agent,
+		},
+	}
+
+	k := Kubernetes{}
+	objs, err := k.Transform(komposeObject, kobject.ConvertOptions{CreateD: true})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "k.Transform failed"))
+	}
+
+	deployments := map[string]*appsv1.Deployment{}
+	for _, obj := range objs {
+		if deployment, ok := obj.(*appsv1.Deployment); ok {
+			deployments[deployment.Name] = deployment
+		}
+	}
+	if len(deployments) != 2 {
+		t.Fatalf("Expected 2 deployments, got %d", len(deployments))
+	}
+
+	podSpec := deployments["agent"].Spec.Template.Spec
+	if !podSpec.HostPID || !podSpec.HostIPC {
+		t.Errorf("Expected the pods of agent to use the process and IPC namespaces of the node, got %v and %v", podSpec.HostPID, podSpec.HostIPC)
+	}
+
+	// the sidecar shares the /dev/shm of db, of its size
+	podSpec = deployments["db"].Spec.Template.Spec
+	if len(podSpec.Containers) != 2 || podSpec.HostIPC {
+		t.Fatalf("Expected containers db and sidecar in the pods of db, with their own IPC namespace, got %v", podSpec.Containers)
+	}
+	expectedMount := []api.VolumeMount{{Name: "db-shm", MountPath: "/dev/shm"}}
+	for _, container := range podSpec.Containers {
+		if !reflect.DeepEqual(container.VolumeMounts, expectedMount) {
+			t.Errorf("Expected the volume mounts %v in container %s, got %v", expectedMount, container.Name, container.VolumeMounts)
+		}
+	}
+	if len(podSpec.Volumes) != 1 {
+		t.Fatalf("Expected the volume db-shm, got %v", podSpec.Volumes)
+	}
+	if emptyDir := podSpec.Volumes[0].EmptyDir; emptyDir == nil || emptyDir.Medium != api.StorageMediumMemory || emptyDir.SizeLimit.String() != "256Mi" {
+		t.Errorf("Expected the memory-backed volume db-shm of 256Mi, got %v", podSpec.Volumes)
+	}
+}
+
+func TestHostAliasesAndDNS(t *testing.T) {
+	service := newSimpleServiceConfig()
+	service.ExtraHosts = []string{"partner.example.com:10.0.0.5", "api.partner.example.com=10.0.0.5", "v6host:::1", "gateway:host-gateway"}
+	service.DNSSearch = []string{"corp.example.com"}
+	service.DNSOpts = []string{"ndots:2", "rotate"}
+
+	ndots := "2"
+	expectedAliases := []api.HostAlias{
+		{IP: "10.0.0.5", Hostnames: []string{"partner.example.com", "api.partner.example.com"}},
+		{IP: "::1", Hostnames: []string{"v6host"}},
+	}
+	expectedConfig := &api.PodDNSConfig{
+		Searches: []string{"corp.example.com"},
+		Options:  []api.PodDNSConfigOption{{Name: "ndots", Value: &ndots}, {Name: "rotate"}},
+	}
+
+	testCases := map[string]struct {
+		dns            []string
+		expectedPolicy api.DNSPolicy
+	}{
+		"Without DNS servers, the cluster DNS is kept":  {nil, ""},
+		"With DNS servers, the cluster DNS is replaced": {[]string{"1.1.1.1"}, api.DNSNone},
+	}
+
+	for name, test := range testCases {
+		t.Log("Test case:", name)
+		service.DNS = test.dns
+		komposeObject := kobject.KomposeObject{ServiceConfigs: map[string]kobject.ServiceConfig{"app": service}}
+
+		k := Kubernetes{}
+		objs, err := k.Transform(komposeObject, kobject.ConvertOptions{CreateD: true})
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "k.Transform failed"))
+		}
+		for _, obj := range objs {
+			deployment, ok := obj.(*appsv1.Deployment)
+			if !ok {
+				continue
+			}
+			podSpec := deployment.Spec.Template.Spec
+			if !reflect.DeepEqual(podSpec.HostAliases, expectedAliases) {
+				t.Errorf("Expected host aliases %v, got %v", expectedAliases, podSpec.HostAliases)
+			}
+			expectedConfig.Nameservers = test.dns
+			if !reflect.DeepEqual(podSpec.DNSConfig, expectedConfig) {
+				t.Errorf("Expected DNS config %v, got %v", expectedConfig, podSpec.DNSConfig)
+			}
+			if podSpec.DNSPolicy != test.expectedPolicy {
+				t.Errorf("Expected DNS policy %q, got %q", test.expectedPolicy, podSpec.DNSPolicy)
+			}
+		}
+	}
+}
+
+func TestSecurityOptions(t *testing.T) {
+	service := newSimpleServiceConfig()
+	service.ReadOnly = true
+	service.SecurityOpt = []string{"no-new-privileges:true", "seccomp=unconfined", "apparmor=my-profile", "label=level:s0:c100,c200"}
+	service.Sysctls = map[string]string{"net.ipv4.tcp_syncookies": "1", "net.core.somaxconn": "1024"}
+	komposeObject := kobject.KomposeObject{ServiceConfigs: map[string]kobject.ServiceConfig{"app": service}}
+
+	k := Kubernetes{}
+	objs, err := k.Transform(komposeObject, kobject.ConvertOptions{CreateD: true})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "k.Transform failed"))
+	}
+
+	readOnly, allowPrivilegeEscalation := true, false
+	expectedContext := &api.SecurityContext{
+		ReadOnlyRootFilesystem:   &readOnly,
+		AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+		SeccompProfile:           &api.SeccompProfile{Type: api.SeccompProfileTypeUnconfined},
+		SELinuxOptions:           &api.SELinuxOptions{Level: "s0:c100,c200"},
+	}
+	expectedSysctls := []api.Sysctl{{Name: "net.core.somaxconn", Value: "1024"}, {Name: "net.ipv4.tcp_syncookies", Value: "1"}}
+	for _, obj := range objs {
+		deployment, ok := obj.(*appsv1.Deployment)
+		if !ok {
+			continue
+		}
+		template := deployment.Spec.Template
+		if !reflect.DeepEqual(template.Spec.Containers[0].SecurityContext, expectedContext) {
+			t.Errorf("Expected security context %v, got %v", expectedContext, template.Spec.Containers[0].SecurityContext)
+		}
+		if template.Spec.SecurityContext == nil || !reflect.DeepEqual(template.Spec.SecurityContext.Sysctls, expectedSysctls) {
+			t.Errorf("Expected sysctls %v, got %v", expectedSysctls, template.Spec.SecurityContext)
+		}
+		if profile := template.Annotations[AppArmorAnnotationPrefix+"name"]; profile != "localhost/my-profile" {
+			t.Errorf("Expected AppArmor profile localhost/my-profile, got %q", profile)
+		}
+	}
+}
+
+func TestSecurityProfile(t *testing.T) {
+	rootService := newSimpleServiceConfig()
+	rootService.User = "0"
+
+	testCases := map[string]struct {
+		service         kobject.ServiceConfig
+		securityProfile string
+		expectedContext *api.SecurityContext
+	}{
+		"Baseline profile keeps the security context": {newSimpleServiceConfig(), SecurityProfileBaseline, nil},
+		"Restricted profile hardens the security context": {newSimpleServiceConfig(), SecurityProfileRestricted, &api.SecurityContext{
+			Capabilities:             &api.Capabilities{Drop: []api.Capability{"ALL"}},
+			RunAsNonRoot:             &[]bool{true}[0],
+			SeccompProfile:           &api.SeccompProfile{Type: api.SeccompProfileTypeRuntimeDefault},
+			AllowPrivilegeEscalation: &[]bool{false}[0],
+		}},
+		"Restricted profile keeps the root user": {rootService, SecurityProfileRestricted, &api.SecurityContext{
+			Capabilities:             &api.Capabilities{Drop: []api.Capability{"ALL"}},
+			RunAsUser:                &[]int64{0}[0],
+			SeccompProfile:           &api.SeccompProfile{Type: api.SeccompProfileTypeRuntimeDefault},
+			AllowPrivilegeEscalation: &[]bool{false}[0],
+		}},
+	}
+
+	for name, test := range testCases {
+		t.Log("Test case:", name)
+		komposeObject := kobject.KomposeObject{ServiceConfigs: map[string]kobject.ServiceConfig{"app": test.service}}
+
+		k := Kubernetes{}
+		objs, err := k.Transform(komposeObject, kobject.ConvertOptions{CreateD: true, SecurityProfile: test.securityProfile})
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "k.Transform failed"))
+		}
+		for _, obj := range objs {
+			if deployment, ok := obj.(*appsv1.Deployment); ok {
+				if securityContext := deployment.Spec.Template.Spec.Containers[0].SecurityContext; !reflect.DeepEqual(securityContext, test.expectedContext) {
+					t.Errorf("Expected security context %v, got %v", test.expectedContext, securityContext)
+				}
+			}
+		}
+	}
+}
+
+func TestUserAndGroup(t *testing.T) {
+	testCases := map[string]struct {
+		user            string
+		expectedContext *api.SecurityContext
+	}{
+		"User only":              {"1000", &api.SecurityContext{RunAsUser: &[]int64{1000}[0]}},
+		"User and group":         {"1000:2000", &api.SecurityContext{RunAsUser: &[]int64{1000}[0], RunAsGroup: &[]int64{2000}[0]}},
+		"Named group is ignored": {"1000:staff", &api.SecurityContext{RunAsUser: &[]int64{1000}[0]}},
+		"Named user is ignored":  {"postgres", nil},
+	}
+
+	for name, test := range testCases {
+		t.Log("Test case:", name)
+		service := newSimpleServiceConfig()
+		service.User = test.user
+		komposeObject := kobject.KomposeObject{ServiceConfigs: map[string]kobject.ServiceConfig{"app": service}}
+
+		k := Kubernetes{}
+		objs, err := k.Transform(komposeObject, kobject.ConvertOptions{CreateD: true})
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "k.Transform failed"))
+		}
+		for _, obj := range objs {
+			if deployment, ok := obj.(*appsv1.Deployment); ok {
+				if securityContext := deployment.Spec.Template.Spec.Containers[0].SecurityContext; !reflect.DeepEqual(securityContext, test.expectedContext) {
+					t.Errorf("Expected security context %v, got %v", test.expectedContext, securityContext)
+				}
+			}
+		}
+	}
+}
+
 func TestCreatePVC(t *testing.T) {
 	storageClassName := "custom-storage-class-name"
 	k := Kubernetes{}
@@ -755,3 +1058,684 @@ func TestCreatePVC(t *testing.T) {
 		t.Errorf("Expected %s returned, got %s", storageClassName, *result.Spec.StorageClassName)
 	}
 }
+
+func TestSourceAnnotation(t *testing.T) {
+	service := newSimpleServiceConfig()
+	service.Port = []kobject.Ports{{HostPort: 80, ContainerPort: 80}}
+	service.Sources = kobject.SourceMap{
+		"services.app":          {File: "docker-compose.yml", Line: 3, Path: "services.app"},
+		"services.app.ports[0]": {File: "docker-compose.yml", Line: 6, Path: "services.app.ports[0]"},
+	}
+	komposeObject := kobject.KomposeObject{ServiceConfigs: map[string]kobject.ServiceConfig{"app": service}}
+
+	for _, withSourceAnnotation := range []bool{true, false} {
+		k := Kubernetes{}
+		objs, err := k.Transform(komposeObject, kobject.ConvertOptions{CreateD: true, WithSourceAnnotation: withSourceAnnotation})
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "k.Transform failed"))
+		}
+
+		expected := map[string]string{
+			"Service":    "docker-compose.yml:6#services.app.ports[0]",
+			"Deployment": "docker-compose.yml:3#services.app",
+		}
+		for _, obj := range objs {
+			var kind string
+			var annotations map[string]string
+			switch o := obj.(type) {
+			case *api.Service:
+				kind, annotations = "Service", o.Annotations
+			case *appsv1.Deployment:
+				kind, annotations = "Deployment", o.Annotations
+			default:
+				continue
+			}
+			source, ok := annotations[transformer.SourceAnnotation]
+			if !withSourceAnnotation {
+				if ok {
+					t.Errorf("Expected no source annotation on %s, got %s", kind, source)
+				}
+				continue
+			}
+			if source != expected[kind] {
+				t.Errorf("Expected %s to be annotated with %s, got %q", kind, expected[kind], source)
+			}
+		}
+	}
+}
+
+func TestProjectName(t *testing.T) {
+	web := newSimpleServiceConfig()
+	web.Name = "web"
+	web.Port = []kobject.Ports{{HostPort: 80, ContainerPort: 80}}
+	web.Environment = []kobject.EnvVar{
+		{Name: "DB_URL", Value: "postgres://user@db:5432/app"},
+		{Name: "HOST", Value: "db.example.com"},
+		{Name: "DB_HOST", Value: "db"},
+		{Name: "DB_ADDRS", Value: "db:5432,replica:5432"},
+		{Name: "GREETING", Value: "hello web"},
+		{Name: "DB_DOC", Value: "see https://example.com/db"},
+	}
+	web.Network = []string{"front"}
+	web.Volumes = []kobject.Volumes{{SvcName: "web", MountPath: "/data", Container: "/data", PVCName: "web-claim0"}}
+	db := newSimpleServiceConfig()
+	db.Name = "db"
+	db.Port = []kobject.Ports{{HostPort: 5432, ContainerPort: 5432}}
+	backup := newSimpleServiceConfig()
+	backup.Name = "backup"
+	backup.CronJobSchedule = "0 3 * * *"
+	komposeObject := kobject.KomposeObject{
+		ServiceConfigs: map[string]kobject.ServiceConfig{"web": web, "db": db, "backup": backup},
+	}
+
+	k := Kubernetes{}
+	objs, err := k.Transform(komposeObject, kobject.ConvertOptions{CreateD: true, ProjectName: "shop"})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "k.Transform failed"))
+	}
+
+	for _, obj := range objs {
+		meta := obj.(metav1.Object)
+		if !strings.HasPrefix(meta.GetName(), "shop-") || meta.GetLabels()[PartOfLabel] != "shop" {
+			t.Errorf("Expected %s to be named and labelled after the project, got %s %v", obj.GetObjectKind().GroupVersionKind().Kind, meta.GetName(), meta.GetLabels())
+		}
+		switch o := obj.(type) {
+		case *batchv1.CronJob:
+			if o.Spec.JobTemplate.Labels[PartOfLabel] != "shop" || o.Spec.JobTemplate.Spec.Template.Labels[PartOfLabel] != "shop" {
+				t.Errorf("Expected the job template of cron job %s to be labelled after the project, got %v", o.Name, o.Spec.JobTemplate.Labels)
+			}
+		case *api.Service:
+			if o.Spec.Selector[transformer.Selector] != o.Name {
+				t.Errorf("Expected service %s to select its pods, got %v", o.Name, o.Spec.Selector)
+			}
+		case *appsv1.Deployment:
+			if o.Spec.Selector.MatchLabels[transformer.Selector] != o.Name || o.Spec.Template.Labels[transformer.Selector] != o.Name {
+				t.Errorf("Expected deployment %s to select its pods, got %v", o.Name, o.Spec.Selector.MatchLabels)
+			}
+			if o.Name != "shop-web" {
+				continue
+			}
+			if _, ok := o.Spec.Template.Labels["io.kompose.network/shop-front"]; !ok {
+				t.Errorf("Expected the network label to be renamed, got %v", o.Spec.Template.Labels)
+			}
+			if claim := o.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim.ClaimName; claim != "shop-web-claim0" {
+				t.Errorf("Expected the claim to be renamed, got %s", claim)
+			}
+			env := map[string]string{}
+			for _, e := range o.Spec.Template.Spec.Containers[0].Env {
+				env[e.Name] = e.Value
+			}
+			expected := map[string]string{
+				"DB_URL":   "postgres://user@shop-db:5432/app",
+				"HOST":     "db.example.com",
+				"DB_HOST":  "shop-db",
+				"DB_ADDRS": "shop-db:5432,replica:5432",
+				"GREETING": "hello web",
+				"DB_DOC":   "see https://example.com/db",
+			}
+			if !reflect.DeepEqual(env, expected) {
+				t.Errorf("Expected the host names of the services to be renamed, got %v", env)
+			}
+		}
+	}
+}
+
+func TestProjectNamerPrefix(t *testing.T) {
+	p := ProjectNamer{Project: "shop"}
+	if name := p.Prefix("web_1"); name != "shop-web-1" {
+		t.Errorf("Expected shop-web-1, got %s", name)
+	}
+
+	long := strings.Repeat("a", 60)
+	name := p.Prefix(long)
+	if len(name) > 63 || !strings.HasPrefix(name, "shop-aaa") {
+		t.Errorf("Expected a name truncated to a DNS label, got %s", name)
+	}
+	if name == p.Prefix(long+"b") {
+		t.Errorf("Expected the truncated names to stay unique, got %s twice", name)
+	}
+	if name != p.Prefix(long) {
+		t.Errorf("Expected the truncated name to be stable")
+	}
+}
+
+func TestStatefulSet(t *testing.T) {
+	parallelism := uint64(1)
+	db := newSimpleServiceConfig()
+	db.Name = "db"
+	db.Port = []kobject.Ports{{HostPort: 5432, ContainerPort: 5432}}
+	db.Volumes = []kobject.Volumes{{SvcName: "db", MountPath: "/data", Container: "/data", PVCName: "db-claim0"}}
+	db.DeployUpdateConfig.Parallelism = &parallelism
+	broker := newSimpleServiceConfig()
+	broker.Name = "broker"
+	komposeObject := kobject.KomposeObject{
+		ServiceConfigs: map[string]kobject.ServiceConfig{"db": db, "broker": broker},
+	}
+
+	k := Kubernetes{}
+	objs, err := k.Transform(komposeObject, kobject.ConvertOptions{Controller: StatefulSetController})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "k.Transform failed"))
+	}
+
+	statefulSets := map[string]*appsv1.StatefulSet{}
+	services := map[string]*api.Service{}
+	for _, obj := range objs {
+		switch o := obj.(type) {
+		case *appsv1.StatefulSet:
+			statefulSets[o.Name] = o
+		case *api.Service:
+			services[o.Name] = o
+		case *api.PersistentVolumeClaim:
+			t.Errorf("Expected the claims to be templates of the stateful set, got claim %s", o.Name)
+		}
+	}
+
+	ss, ok := statefulSets["db"]
+	if !ok {
+		t.Fatalf("Expected a stateful set for db, got %v", objs)
+	}
+	if len(ss.Spec.VolumeClaimTemplates) != 1 || ss.Spec.VolumeClaimTemplates[0].Name != "db-claim0" {
+		t.Errorf("Expected a claim template db-claim0, got %v", ss.Spec.VolumeClaimTemplates)
+	}
+	if len(ss.Spec.Template.Spec.Volumes) != 0 {
+		t.Errorf("Expected the pods to mount the claim templates, got volumes %v", ss.Spec.Template.Spec.Volumes)
+	}
+	if ss.Spec.UpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+		t.Errorf("Expected a rolling update strategy, got %v", ss.Spec.UpdateStrategy)
+	}
+	if ss.Spec.ServiceName != "db-headless" || services["db-headless"] == nil || services["db-headless"].Spec.ClusterIP != "None" {
+		t.Errorf("Expected db to be governed by the headless service db-headless, got %s", ss.Spec.ServiceName)
+	}
+	if services["db"] == nil || services["db"].Spec.ClusterIP == "None" {
+		t.Errorf("Expected the service db to be kept, got %v", services["db"])
+	}
+
+	// a service without ports gets a headless service with its own name
+	ss, ok = statefulSets["broker"]
+	if !ok {
+		t.Fatalf("Expected a stateful set for broker, got %v", objs)
+	}
+	if ss.Spec.ServiceName != "broker" || services["broker"] == nil || services["broker"].Spec.ClusterIP != "None" {
+		t.Errorf("Expected broker to be governed by the headless service broker, got %s", ss.Spec.ServiceName)
+	}
+}
+
+func TestJob(t *testing.T) {
+	maxAttempts := uint64(3)
+	migrate := newSimpleServiceConfig()
+	migrate.Name = "migrate"
+	migrate.Restart = "on-failure"
+	migrate.DeployRestartPolicy.MaxAttempts = &maxAttempts
+	worker := newSimpleServiceConfig()
+	worker.Name = "worker"
+	worker.DeployMode = "replicated-job"
+	worker.Replicas = 4
+	backup := newSimpleServiceConfig()
+	backup.Name = "backup"
+	backup.CronJobSchedule = "0 3 * * *"
+	backup.CronJobConcurrencyPolicy = string(batchv1.ForbidConcurrent)
+	komposeObject := kobject.KomposeObject{
+		ServiceConfigs: map[string]kobject.ServiceConfig{"migrate": migrate, "worker": worker, "backup": backup},
+	}
+
+	k := Kubernetes{}
+	objs, err := k.Transform(komposeObject, kobject.ConvertOptions{CreateD: true, Replicas: 1})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "k.Transform failed"))
+	}
+
+	jobs := map[string]*batchv1.Job{}
+	var cronJob *batchv1.CronJob
+	for _, obj := range objs {
+		switch o := obj.(type) {
+		case *batchv1.Job:
+			jobs[o.Name] = o
+		case *batchv1.CronJob:
+			cronJob = o
+		case *appsv1.Deployment, *api.Pod:
+			t.Errorf("Expected only jobs, got %s", obj.GetObjectKind().GroupVersionKind().Kind)
+		}
+	}
+
+	if job := jobs["migrate"]; job == nil || job.Spec.BackoffLimit == nil || *job.Spec.BackoffLimit != 3 {
+		t.Errorf("Expected the job migrate to be retried 3 times, got %v", job)
+	}
+	if job := jobs["worker"]; job == nil || *job.Spec.Parallelism != 4 || *job.Spec.Completions != 4 ||
+		job.Spec.Template.Spec.RestartPolicy != api.RestartPolicyOnFailure {
+		t.Errorf("Expected the job worker to run 4 pods in parallel, got %v", job)
+	}
+	if cronJob == nil || cronJob.APIVersion != "batch/v1" || cronJob.Spec.Schedule != "0 3 * * *" || cronJob.Spec.ConcurrencyPolicy != batchv1.ForbidConcurrent ||
+		cronJob.Spec.JobTemplate.Spec.Template.Spec.RestartPolicy != api.RestartPolicyOnFailure {
+		t.Errorf("Expected the cron job backup to run daily at 3, got %v", cronJob)
+	}
+}
+
+func TestHorizontalPodAutoscaler(t *testing.T) {
+	min := int32(2)
+	web := newSimpleServiceConfig()
+	web.Name = "web"
+	web.CPUReservation = 500
+	web.HPAMinReplicas = &min
+	web.HPAMaxReplicas = 10
+	web.HPACPU = 70
+	komposeObject := kobject.KomposeObject{
+		ServiceConfigs: map[string]kobject.ServiceConfig{"web": web},
+	}
+
+	for _, controller := range []string{DeploymentController, StatefulSetController} {
+		k := Kubernetes{}
+		objs, err := k.Transform(komposeObject, kobject.ConvertOptions{Controller: controller, Replicas: 1})
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "k.Transform failed"))
+		}
+
+		var hpa *autoscalingv2.HorizontalPodAutoscaler
+		var target string
+		for _, obj := range objs {
+			switch o := obj.(type) {
+			case *autoscalingv2.HorizontalPodAutoscaler:
+				hpa = o
+			case *appsv1.Deployment, *appsv1.StatefulSet:
+				target = o.GetObjectKind().GroupVersionKind().Kind
+			}
+		}
+		if hpa == nil {
+			t.Fatalf("Expected a horizontal pod autoscaler for controller %s", controller)
+		}
+		if hpa.APIVersion != "autoscaling/v2" || hpa.Spec.ScaleTargetRef.Kind != target || hpa.Spec.ScaleTargetRef.Name != "web" {
+			t.Errorf("Expected the autoscaler to scale the %s web, got %v", target, hpa.Spec.ScaleTargetRef)
+		}
+		if *hpa.Spec.MinReplicas != 2 || hpa.Spec.MaxReplicas != 10 {
+			t.Errorf("Expected 2 to 10 replicas, got %d to %d", *hpa.Spec.MinReplicas, hpa.Spec.MaxReplicas)
+		}
+		if len(hpa.Spec.Metrics) != 1 || hpa.Spec.Metrics[0].Resource.Name != api.ResourceCPU || *hpa.Spec.Metrics[0].Resource.Target.AverageUtilization != 70 {
+			t.Errorf("Expected a target of 70%% of the CPU, got %v", hpa.Spec.Metrics)
+		}
+	}
+}
+
+func TestPodDisruptionBudget(t *testing.T) {
+	parallelism := uint64(2)
+	web := newSimpleServiceConfig()
+	web.Name = "web"
+	web.Replicas = 4
+	web.DeployUpdateConfig.Parallelism = &parallelism
+	db := newSimpleServiceConfig()
+	db.Name = "db"
+	db.PDBMinAvailable = "50%"
+	cache := newSimpleServiceConfig()
+	cache.Name = "cache"
+	komposeObject := kobject.KomposeObject{
+		ServiceConfigs: map[string]kobject.ServiceConfig{"web": web, "db": db, "cache": cache},
+	}
+
+	k := Kubernetes{}
+	objs, err := k.Transform(komposeObject, kobject.ConvertOptions{CreateD: true, Replicas: 1})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "k.Transform failed"))
+	}
+
+	pdbs := map[string]*policyv1.PodDisruptionBudget{}
+	for _, obj := range objs {
+		if pdb, ok := obj.(*policyv1.PodDisruptionBudget); ok {
+			pdbs[pdb.Name] = pdb
+		}
+	}
+
+	if pdb := pdbs["web"]; pdb == nil || pdb.Spec.MaxUnavailable == nil || pdb.Spec.MaxUnavailable.IntValue() != 2 ||
+		!reflect.DeepEqual(pdb.Spec.Selector.MatchLabels, transformer.ConfigLabels("web")) {
+		t.Errorf("Expected web to allow 2 unavailable pods, got %v", pdb)
+	}
+	if pdb := pdbs["db"]; pdb == nil || pdb.Spec.MinAvailable == nil || pdb.Spec.MinAvailable.String() != "50%" {
+		t.Errorf("Expected db to keep 50%% of its pods available, got %v", pdb)
+	}
+	if pdb, ok := pdbs["cache"]; ok {
+		t.Errorf("Expected no pod disruption budget for a single replica, got %v", pdb)
+	}
+}
+
+func TestServiceAccount(t *testing.T) {
+	web := newSimpleServiceConfig()
+	web.Name = "web"
+	web.RBACRules = []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}}
+	db := newSimpleServiceConfig()
+	db.Name = "db"
+	komposeObject := kobject.KomposeObject{
+		ServiceConfigs: map[string]kobject.ServiceConfig{"web": web, "db": db},
+	}
+
+	k := Kubernetes{}
+	objs, err := k.Transform(komposeObject, kobject.ConvertOptions{CreateD: true, Replicas: 1, Namespace: "demo"})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "k.Transform failed"))
+	}
+
+	kinds := map[string]bool{}
+	for _, obj := range objs {
+		switch o := obj.(type) {
+		case *appsv1.Deployment:
+			spec := o.Spec.Template.Spec
+			switch o.Name {
+			case "web":
+				if spec.ServiceAccountName != "web" || spec.AutomountServiceAccountToken != nil {
+					t.Errorf("Expected web to run as service account web, got %q", spec.ServiceAccountName)
+				}
+			case "db":
+				if spec.ServiceAccountName != "" || spec.AutomountServiceAccountToken == nil || *spec.AutomountServiceAccountToken {
+					t.Errorf("Expected db not to mount a service account token")
+				}
+			}
+		case *api.ServiceAccount:
+			kinds["ServiceAccount"] = o.Name == "web"
+		case *rbacv1.Role:
+			kinds["Role"] = o.Name == "web" && reflect.DeepEqual(o.Rules, web.RBACRules)
+		case *rbacv1.RoleBinding:
+			kinds["RoleBinding"] = o.RoleRef.Name == "web" && len(o.Subjects) == 1 &&
+				o.Subjects[0].Name == "web" && o.Subjects[0].Namespace == "demo"
+		}
+	}
+	for _, kind := range []string{"ServiceAccount", "Role", "RoleBinding"} {
+		if !kinds[kind] {
+			t.Errorf("Expected a %s for web", kind)
+		}
+	}
+}
+
+func TestIngressPaths(t *testing.T) {
+	service := newServiceConfig()
+	service.ExposeService = "shop.example.com,admin.example.com/admin"
+	service.ExposeServicePath = []kobject.ExposePath{{Path: "/api", Port: 8080}, {Path: "/"}}
+	service.ExposeIngressClassName = "nginx"
+	service.ExposeAnnotations = map[string]string{"nginx.ingress.kubernetes.io/proxy-body-size": "8m"}
+	svc := &api.Service{Spec: api.ServiceSpec{Ports: []api.ServicePort{{Port: 3000}, {Port: 8080}}}}
+
+	k := Kubernetes{}
+	obj, err := k.InitExpose("app", service, svc)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "k.InitExpose failed"))
+	}
+	ing, ok := obj.(*networkingv1.Ingress)
+	if !ok {
+		t.Fatalf("Expected an Ingress, got %v", obj)
+	}
+
+	if ing.Spec.IngressClassName == nil || *ing.Spec.IngressClassName != "nginx" {
+		t.Errorf("Expected the ingress class nginx, got %v", ing.Spec.IngressClassName)
+	}
+	if ing.Annotations["nginx.ingress.kubernetes.io/proxy-body-size"] != "8m" {
+		t.Errorf("Expected the expose annotations, got %v", ing.Annotations)
+	}
+	if len(ing.Spec.Rules) != 2 {
+		t.Fatalf("Expected one rule per host, got %v", ing.Spec.Rules)
+	}
+	paths := ing.Spec.Rules[0].HTTP.Paths
+	if len(paths) != 2 || paths[0].Path != "/api" || paths[0].Backend.Service.Port.Number != 8080 ||
+		paths[1].Path != "/" || paths[1].Backend.Service.Port.Number != 3000 {
+		t.Errorf("Expected /api to route to 8080 and / to 3000, got %v", paths)
+	}
+	paths = ing.Spec.Rules[1].HTTP.Paths
+	if len(paths) != 1 || paths[0].Path != "/admin" || paths[0].Backend.Service.Port.Number != 3000 {
+		t.Errorf("Expected /admin to route to 3000, got %v", paths)
+	}
+
+	service.ExposeServicePath = []kobject.ExposePath{{Path: "/", Port: 9090}}
+	if _, err := k.InitExpose("app", service, svc); err == nil {
+		t.Errorf("Expected an error for a port the service doesn't expose")
+	}
+}
+
+func TestHTTPRoute(t *testing.T) {
+	service := newServiceConfig()
+	service.ExposeService = "shop.example.com,www.example.com"
+	service.ExposeServicePath = []kobject.ExposePath{{Path: "/shop"}}
+	svc := &api.Service{Spec: api.ServiceSpec{Ports: []api.ServicePort{{Port: 8080}}}}
+
+	k := Kubernetes{Opt: kobject.ConvertOptions{ExposeMode: ExposeModeGateway, Gateway: "infra/shared"}}
+	obj, err := k.InitExpose("app", service, svc)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "k.InitExpose failed"))
+	}
+	route, ok := obj.(*unstructured.Unstructured)
+	if !ok || route.GetKind() != "HTTPRoute" {
+		t.Fatalf("Expected an HTTPRoute, got %v", route)
+	}
+
+	hostnames, _, _ := unstructured.NestedStringSlice(route.Object, "spec", "hostnames")
+	if !reflect.DeepEqual(hostnames, []string{"shop.example.com", "www.example.com"}) {
+		t.Errorf("Expected the host names of the service, got %v", hostnames)
+	}
+	parents, _, _ := unstructured.NestedSlice(route.Object, "spec", "parentRefs")
+	if len(parents) != 1 || parents[0].(map[string]interface{})["namespace"] != "infra" || parents[0].(map[string]interface{})["name"] != "shared" {
+		t.Errorf("Expected the Gateway infra/shared as parent, got %v", parents)
+	}
+	rules, _, _ := unstructured.NestedSlice(route.Object, "spec", "rules")
+	if len(rules) != 1 {
+		t.Fatalf("Expected one rule, got %v", rules)
+	}
+	rule := rules[0].(map[string]interface{})
+	path, _, _ := unstructured.NestedString(rule["matches"].([]interface{})[0].(map[string]interface{}), "path", "value")
+	backend := rule["backendRefs"].([]interface{})[0].(map[string]interface{})
+	if path != "/shop" || backend["name"] != "app" || backend["port"] != int64(8080) {
+		t.Errorf("Expected /shop routed to app:8080, got %v", rule)
+	}
+}
+
+func TestInitGateway(t *testing.T) {
+	web := newSimpleServiceConfig()
+	web.Name = "web"
+	web.ExposeService = "example.com,*.example.com/static"
+	web.ExposeServiceTLS = "web-tls"
+	api := newSimpleServiceConfig()
+	api.Name = "api"
+	api.ExposeService = "example.com/api"
+	api.ExposeServiceTLS = "api-tls"
+	komposeObject := kobject.KomposeObject{
+		ServiceConfigs: map[string]kobject.ServiceConfig{"web": web, "api": api},
+	}
+
+	k := Kubernetes{}
+	gateway := k.InitGateway(komposeObject, kobject.ConvertOptions{Gateway: "public", GatewayClass: "istio"})
+	if gateway.GetLabels()[transformer.Selector] != "public" {
+		t.Errorf("Expected the Gateway to be labelled, got %v", gateway.GetLabels())
+	}
+
+	listeners, _, _ := unstructured.NestedSlice(gateway.Object, "spec", "listeners")
+	certificates := map[string][]string{}
+	hostnames := map[string]interface{}{}
+	for _, l := range listeners {
+		listener := l.(map[string]interface{})
+		name := listener["name"].(string)
+		hostnames[name] = listener["hostname"]
+		refs, _, _ := unstructured.NestedSlice(listener, "tls", "certificateRefs")
+		for _, ref := range refs {
+			certificates[name] = append(certificates[name], ref.(map[string]interface{})["name"].(string))
+		}
+	}
+	expected := map[string]interface{}{"http": nil, "https-example-com": "example.com", "https-wildcard-example-com": "*.example.com"}
+	if !reflect.DeepEqual(hostnames, expected) {
+		t.Errorf("Expected one listener by hostname, with valid names, got %v", hostnames)
+	}
+	if !reflect.DeepEqual(certificates["https-example-com"], []string{"api-tls", "web-tls"}) {
+		t.Errorf("Expected the certificates of api and web on the example.com listener, got %v", certificates["https-example-com"])
+	}
+}
+
+// writeTLSFiles writes a self-signed certificate for the host names, and its key, to PEM files
+func writeTLSFiles(t *testing.T, dir string, hosts ...string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     hosts,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestExposeTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kompose-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	service := newServiceConfig()
+	service.ExposeService = "shop.example.com,www.example.com/shop"
+	service.ExposeTLSCert, service.ExposeTLSKey = writeTLSFiles(t, dir, "shop.example.com", "*.example.com")
+
+	k := Kubernetes{}
+	obj, err := k.InitExposeTLS("app", service)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "k.InitExposeTLS failed"))
+	}
+	secret, ok := obj.(*api.Secret)
+	if !ok || secret.Name != "app-tls" || secret.Type != api.SecretTypeTLS || len(secret.Data[api.TLSCertKey]) == 0 || len(secret.Data[api.TLSPrivateKeyKey]) == 0 {
+		t.Errorf("Expected the TLS secret app-tls, got %v", obj)
+	}
+
+	svc := &api.Service{Spec: api.ServiceSpec{Ports: []api.ServicePort{{Port: 8080}}}}
+	expose, err := k.InitExpose("app", service, svc)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "k.InitExpose failed"))
+	}
+	tls := expose.(*networkingv1.Ingress).Spec.TLS
+	if len(tls) != 1 || tls[0].SecretName != "app-tls" || !reflect.DeepEqual(tls[0].Hosts, []string{"shop.example.com", "www.example.com"}) {
+		t.Errorf("Expected the ingress to use app-tls for its hosts, got %v", tls)
+	}
+
+	service.ExposeService = "shop.example.org"
+	if _, err := k.InitExposeTLS("app", service); err == nil {
+		t.Errorf("Expected an error for a host name the certificate doesn't cover")
+	}
+
+	k.Opt.CertManagerIssuer = "ClusterIssuer/letsencrypt"
+	k.Opt.Diagnostics = &diagnostics.Collector{}
+	obj, err = k.InitExposeTLS("app", service)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "k.InitExposeTLS failed"))
+	}
+	if diags := k.Opt.Diagnostics.Diagnostics(); len(diags) != 1 || diags[0].Path != "services.app.labels.kompose.service.expose.tls-cert" {
+		t.Errorf("Expected the TLS files ignored with cert-manager to be reported, got %v", diags)
+	}
+	cert, ok := obj.(*unstructured.Unstructured)
+	if !ok || cert.GetKind() != "Certificate" {
+		t.Fatalf("Expected a Certificate, got %v", obj)
+	}
+	dnsNames, _, _ := unstructured.NestedStringSlice(cert.Object, "spec", "dnsNames")
+	issuer, _, _ := unstructured.NestedStringMap(cert.Object, "spec", "issuerRef")
+	secretName, _, _ := unstructured.NestedString(cert.Object, "spec", "secretName")
+	if !reflect.DeepEqual(dnsNames, []string{"shop.example.org"}) || issuer["kind"] != "ClusterIssuer" || issuer["name"] != "letsencrypt" || secretName != "app-tls" {
+		t.Errorf("Expected a certificate for shop.example.org issued by ClusterIssuer letsencrypt into app-tls, got %v", cert.Object["spec"])
+	}
+}
+
+func TestNetworkPolicies(t *testing.T) {
+	service := newServiceConfig()
+	service.Network = []string{"back", "front"}
+	service.Port = []kobject.Ports{{HostPort: 8080, ContainerPort: 80}, {HostPort: 9000, ContainerPort: 9000, Exposed: true}}
+	komposeObject := kobject.KomposeObject{
+		ServiceConfigs: map[string]kobject.ServiceConfig{"app": service},
+		Networks: map[string]dockerCliTypes.NetworkConfig{
+			"back":  {Name: "back", Internal: true},
+			"front": {Name: "front"},
+		},
+	}
+	k := Kubernetes{}
+	objs, err := k.Transform(komposeObject, kobject.ConvertOptions{CreateD: true, NetworkIngressNamespace: "ingress-nginx"})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "k.Transform failed"))
+	}
+
+	policies := map[string]*networkingv1.NetworkPolicy{}
+	for _, obj := range objs {
+		if np, ok := obj.(*networkingv1.NetworkPolicy); ok {
+			policies[np.Name] = np
+		}
+	}
+	if len(policies) != 4 || policies["allow-dns"] == nil || policies["default-deny"] != nil {
+		t.Fatalf("Expected the policies of the networks, of the published ports and allowing DNS, got %v", policies)
+	}
+
+	back, front := policies["back"], policies["front"]
+	if len(back.Spec.Egress) != 1 || len(back.Spec.Egress[0].To) != 1 || back.Spec.Egress[0].To[0].PodSelector.MatchLabels["io.kompose.network/back"] != "true" {
+		t.Errorf("Expected the internal network to only reach its pods, got %v", back.Spec.Egress)
+	}
+	if len(front.Spec.Egress) != 1 || len(front.Spec.Egress[0].To) != 0 {
+		t.Errorf("Expected the network to reach anywhere, got %v", front.Spec.Egress)
+	}
+
+	published := policies["app-published"]
+	if published == nil {
+		t.Fatalf("Expected a policy opening the published ports, got %v", policies)
+	}
+	rule := published.Spec.Ingress[0]
+	if len(rule.Ports) != 1 || rule.Ports[0].Port.IntValue() != 80 {
+		t.Errorf("Expected the published port 80 only to be opened, got %v", rule.Ports)
+	}
+	if len(rule.From) != 1 || rule.From[0].NamespaceSelector.MatchLabels["kubernetes.io/metadata.name"] != "ingress-nginx" {
+		t.Errorf("Expected the published ports to be opened to namespace ingress-nginx, got %v", rule.From)
+	}
+}
+
+func TestNetworkPoliciesDefaultNetwork(t *testing.T) {
+	web := newSimpleServiceConfig()
+	web.Name = "web"
+	web.Port = []kobject.Ports{{HostPort: 8080, ContainerPort: 80}}
+	db := newSimpleServiceConfig()
+	db.Name = "db"
+	db.Port = []kobject.Ports{{ContainerPort: 5432, Exposed: true}}
+	komposeObject := kobject.KomposeObject{
+		ServiceConfigs: map[string]kobject.ServiceConfig{"web": web, "db": db},
+	}
+	k := Kubernetes{}
+	objs, err := k.Transform(komposeObject, kobject.ConvertOptions{CreateD: true, NetworkDefaultDeny: true})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "k.Transform failed"))
+	}
+
+	policies := map[string]*networkingv1.NetworkPolicy{}
+	for _, obj := range objs {
+		switch o := obj.(type) {
+		case *networkingv1.NetworkPolicy:
+			policies[o.Name] = o
+		case *appsv1.Deployment:
+			if o.Spec.Template.Labels["io.kompose.network/default"] != "true" {
+				t.Errorf("Expected the pods of %s to be attached to the default network, got %v", o.Name, o.Spec.Template.Labels)
+			}
+		}
+	}
+	if len(policies) != 4 || policies["web-published"] == nil || policies["allow-dns"] == nil || policies["default-deny"] == nil {
+		t.Fatalf("Expected the policies of the default network, of the published ports, allowing DNS and denying the rest, got %v", policies)
+	}
+
+	network := policies["default"]
+	if network == nil {
+		t.Fatalf("Expected a policy for the default network, got %v", policies)
+	}
+	if len(network.Spec.Ingress) != 1 || network.Spec.Ingress[0].From[0].PodSelector.MatchLabels["io.kompose.network/default"] != "true" {
+		t.Errorf("Expected the pods of the default network to reach each other, got %v", network.Spec.Ingress)
+	}
+	if len(network.Spec.Egress) != 1 || len(network.Spec.Egress[0].To) != 0 {
+		t.Errorf("Expected the default network to reach anywhere, got %v", network.Spec.Egress)
+	}
+}
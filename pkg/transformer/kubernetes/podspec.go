@@ -2,12 +2,11 @@ package kubernetes
 
 import (
 	"reflect"
-	"strconv"
 
 	mapset "github.com/deckarep/golang-set"
+	"github.com/kubernetes/kompose/pkg/diagnostics"
 	"github.com/kubernetes/kompose/pkg/kobject"
 	"github.com/pkg/errors"
-	log "github.com/sirupsen/logrus"
 	api "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -15,6 +14,8 @@ import (
 
 type PodSpec struct {
 	api.PodSpec
+	// Annotations are the annotations of the pods, like the AppArmor profiles of their containers
+	Annotations map[string]string
 }
 
 type PodSpecOption func(*PodSpec)
@@ -48,13 +49,13 @@ func AddContainer(service kobject.ServiceConfig, opt kobject.ConvertOptions) Pod
 	}
 }
 
-func TerminationGracePeriodSeconds(name string, service kobject.ServiceConfig) PodSpecOption {
+func TerminationGracePeriodSeconds(name string, service kobject.ServiceConfig, opt kobject.ConvertOptions) PodSpecOption {
 	return func(podSpec *PodSpec) {
 		var err error
 		if service.StopGracePeriod != "" {
 			podSpec.TerminationGracePeriodSeconds, err = DurationStrToSecondsInt(service.StopGracePeriod)
 			if err != nil {
-				log.Warningf("Failed to parse duration \"%v\" for service \"%v\"", service.StopGracePeriod, name)
+				opt.Diagnostics.Warnf(diagnostics.RuleInvalidValue, service.Name, diagnostics.ServicePath(service.Name, "stop_grace_period"), "Failed to parse duration \"%v\" for service \"%v\"", service.StopGracePeriod, name)
 			}
 		}
 	}
@@ -103,19 +104,25 @@ func ResourcesRequests(service kobject.ServiceConfig) PodSpecOption {
 }
 
 // SecurityContext Configure SecurityContext
-func SecurityContext(name string, service kobject.ServiceConfig) PodSpecOption {
+func SecurityContext(name string, service kobject.ServiceConfig, opt kobject.ConvertOptions) PodSpecOption {
 	return func(podSpec *PodSpec) {
-		// Configure resource reservations
+		// Configure resource reservations, keeping the sysctls of the other containers
 		podSecurityContext := &api.PodSecurityContext{}
+		if podSpec.SecurityContext != nil {
+			podSecurityContext.Sysctls = podSpec.SecurityContext.Sysctls
+		}
 
-		//set pid namespace mode
+		//set pid and ipc namespace modes
 		if service.Pid != "" {
 			if service.Pid == "host" {
-				// podSecurityContext.HostPID = true
+				podSpec.HostPID = true
 			} else {
-				log.Warningf("Ignoring PID key for service \"%v\". Invalid value \"%v\".", name, service.Pid)
+				opt.Diagnostics.Warnf(diagnostics.RuleInvalidValue, service.Name, diagnostics.ServicePath(service.Name, "pid"), "Ignoring PID key for service \"%v\". Invalid value \"%v\".", name, service.Pid)
 			}
 		}
+		if service.Ipc == "host" {
+			podSpec.HostIPC = true
+		}
 
 		//set supplementalGroups
 		if service.GroupAdd != nil {
@@ -127,14 +134,7 @@ func SecurityContext(name string, service kobject.ServiceConfig) PodSpecOption {
 		if service.Privileged {
 			securityContext.Privileged = &service.Privileged
 		}
-		if service.User != "" {
-			uid, err := strconv.ParseInt(service.User, 10, 64)
-			if err != nil {
-				log.Warn("Ignoring user directive. User to be specified as a UID (numeric).")
-			} else {
-				securityContext.RunAsUser = &uid
-			}
-		}
+		ConfigUser(service, opt, securityContext)
 
 		// Configure capabilities
 		capabilities := ConfigCapabilities(service)
@@ -144,9 +144,22 @@ func SecurityContext(name string, service kobject.ServiceConfig) PodSpecOption {
 			securityContext.Capabilities = capabilities
 		}
 
-		// update template only if securityContext is not empty
+		for key, value := range ConfigSecurityOpt(service, opt, securityContext) {
+			if podSpec.Annotations == nil {
+				podSpec.Annotations = map[string]string{}
+			}
+			podSpec.Annotations[key] = value
+		}
+		ConfigSysctls(podSecurityContext, service, opt)
+		ConfigSecurityProfile(service, opt, securityContext)
+
+		// update the container of the service only if securityContext is not empty
 		if *securityContext != (api.SecurityContext{}) {
-			podSpec.Containers[0].SecurityContext = securityContext
+			for i := range podSpec.Containers {
+				if GetContainerName(service) == podSpec.Containers[i].Name {
+					podSpec.Containers[i].SecurityContext = securityContext
+				}
+			}
 		}
 		if !reflect.DeepEqual(*podSecurityContext, api.PodSecurityContext{}) {
 			podSpec.SecurityContext = podSecurityContext
@@ -258,6 +271,32 @@ func DomainName(service kobject.ServiceConfig) PodSpecOption {
 	}
 }
 
+// NetworkMode runs the pod in the network of the node with network_mode: host
+func NetworkMode(service kobject.ServiceConfig) PodSpecOption {
+	return func(podSpec *PodSpec) {
+		if service.NetworkMode == "host" {
+			podSpec.HostNetwork = true
+			if podSpec.DNSPolicy != api.DNSNone {
+				podSpec.DNSPolicy = api.DNSClusterFirstWithHostNet
+			}
+		}
+	}
+}
+
+// HostAliases adds the extra_hosts of the service to the hosts file of the pod
+func HostAliases(service kobject.ServiceConfig, opt kobject.ConvertOptions) PodSpecOption {
+	return func(podSpec *PodSpec) {
+		ConfigHostAliases(&podSpec.PodSpec, service, opt)
+	}
+}
+
+// DNS adds the dns, dns_search and dns_opt of the service to the DNS config of the pod
+func DNS(service kobject.ServiceConfig, opt kobject.ConvertOptions) PodSpecOption {
+	return func(podSpec *PodSpec) {
+		ConfigDNS(&podSpec.PodSpec, service, opt)
+	}
+}
+
 func LivenessProbe(service kobject.ServiceConfig) PodSpecOption {
 	return func(podSpec *PodSpec) {
 		// Configure the HealthCheck
@@ -266,14 +305,14 @@ func LivenessProbe(service kobject.ServiceConfig) PodSpecOption {
 			probe := api.Probe{}
 
 			if len(service.HealthChecks.Liveness.Test) > 0 {
-				probe.Handler = api.Handler{
+				probe.ProbeHandler = api.ProbeHandler{
 					Exec: &api.ExecAction{
 						Command: service.HealthChecks.Liveness.Test,
 					},
 				}
 			} else if !reflect.ValueOf(service.HealthChecks.Liveness.HTTPPath).IsZero() &&
 				!reflect.ValueOf(service.HealthChecks.Liveness.HTTPPort).IsZero() {
-				probe.Handler = api.Handler{
+				probe.ProbeHandler = api.ProbeHandler{
 					HTTPGet: &api.HTTPGetAction{
 						Path: service.HealthChecks.Liveness.HTTPPath,
 						Port: intstr.FromInt(int(service.HealthChecks.Liveness.HTTPPort)),
@@ -304,7 +343,7 @@ func ReadinessProbe(service kobject.ServiceConfig) PodSpecOption {
 		if !reflect.DeepEqual(service.HealthChecks.Readiness, kobject.HealthCheck{}) {
 			probeHealthCheckReadiness := api.Probe{}
 			if len(service.HealthChecks.Readiness.Test) > 0 {
-				probeHealthCheckReadiness.Handler = api.Handler{
+				probeHealthCheckReadiness.ProbeHandler = api.ProbeHandler{
 					Exec: &api.ExecAction{
 						Command: service.HealthChecks.Readiness.Test,
 					},
@@ -329,9 +368,19 @@ func ReadinessProbe(service kobject.ServiceConfig) PodSpecOption {
 	}
 }
 
+// ServiceAccountName sets the service account of the pod. The pods without one don't access the
+// API, they don't mount the token of the default service account.
 func ServiceAccountName(serviceAccountName string) PodSpecOption {
 	return func(podSpec *PodSpec) {
+		if serviceAccountName == "" {
+			if podSpec.ServiceAccountName == "" {
+				automount := false
+				podSpec.AutomountServiceAccountToken = &automount
+			}
+			return
+		}
 		podSpec.ServiceAccountName = serviceAccountName
+		podSpec.AutomountServiceAccountToken = nil
 	}
 }
 
@@ -0,0 +1,406 @@
+/*
+Copyright 2017 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/kubernetes/kompose/pkg/diagnostics"
+	"github.com/kubernetes/kompose/pkg/transformer"
+	deployapi "github.com/openshift/api/apps/v1"
+	buildapi "github.com/openshift/api/build/v1"
+	"github.com/spf13/cast"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	api "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// PartOfLabel is the label recording the compose project an object belongs to
+const PartOfLabel = "app.kubernetes.io/part-of"
+
+// networkLabelPrefix prefixes the labels of the pods attached to a network
+const networkLabelPrefix = "io.kompose.network/"
+
+// ProjectNamer prefixes the names of the objects generated for a compose project with the name
+// of the project, so that several projects can be deployed in the same namespace.
+type ProjectNamer struct {
+	Project string
+	// Diagnostics collects the environment variables rewritten to refer to the renamed services
+	Diagnostics *diagnostics.Collector
+
+	// names holds the names of the objects being renamed, by kind
+	names map[string]map[string]bool
+}
+
+// maxPrefixedNameLength is the length limit of the DNS labels, like the names of the services and the
+// values of the labels
+const maxPrefixedNameLength = 63
+
+// Prefix returns the name prefixed with the name of the project. A name longer than a DNS label is
+// truncated, and suffixed with a hash of the full name to keep it unique.
+func (p *ProjectNamer) Prefix(name string) string {
+	prefixed := FormatResourceName(p.Project + "-" + name)
+	if len(prefixed) <= maxPrefixedNameLength {
+		return prefixed
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(prefixed)))[:8]
+	return strings.TrimRight(prefixed[:maxPrefixedNameLength-len(hash)-1], "-.") + "-" + hash
+}
+
+// Renamed returns the new name of an object of the given kind. The objects which are not
+// generated, like external secrets, keep their name.
+func (p *ProjectNamer) Renamed(kind string, name string) string {
+	if p.names[kind][name] {
+		return p.Prefix(name)
+	}
+	return name
+}
+
+// Rename prefixes the names of the namespaced objects, and the labels and selectors kompose uses
+// to match them, and rewrites the references between the objects. The services being renamed,
+// the environment variables using them as host names are rewritten too: an alias service with
+// the former name would collide with the services of the other projects.
+func (p *ProjectNamer) Rename(objs []runtime.Object) {
+	p.names = map[string]map[string]bool{}
+	for _, obj := range objs {
+		kind := obj.GetObjectKind().GroupVersionKind().Kind
+		if o, ok := obj.(metav1.Object); ok && !clusterScopedKinds[kind] {
+			if p.names[kind] == nil {
+				p.names[kind] = map[string]bool{}
+			}
+			p.names[kind][o.GetName()] = true
+		}
+	}
+
+	// the config maps holding environment variables are found from the pods using them
+	envConfigMaps := map[string]string{}
+	for _, obj := range objs {
+		kind := obj.GetObjectKind().GroupVersionKind().Kind
+		if binding, ok := obj.(*rbacv1.ClusterRoleBinding); ok {
+			p.renameSubjects(binding.Subjects)
+		}
+		if clusterScopedKinds[kind] {
+			continue
+		}
+		p.renameObject(obj, envConfigMaps)
+	}
+	for _, obj := range objs {
+		if cm, ok := obj.(*api.ConfigMap); ok {
+			if service, ok := envConfigMaps[cm.Name]; ok {
+				for key, value := range cm.Data {
+					cm.Data[key] = p.renameHosts(service, key, value)
+				}
+			}
+		}
+	}
+	for _, obj := range objs {
+		if o, ok := obj.(metav1.Object); ok && !clusterScopedKinds[obj.GetObjectKind().GroupVersionKind().Kind] {
+			o.SetName(p.Prefix(o.GetName()))
+		}
+	}
+}
+
+// renameObject rewrites the labels, selectors and references of an object
+func (p *ProjectNamer) renameObject(obj runtime.Object, envConfigMaps map[string]string) {
+	if o, ok := obj.(metav1.Object); ok {
+		labels := p.renameLabels(o.GetLabels())
+		labels[PartOfLabel] = p.Project
+		o.SetLabels(labels)
+	}
+
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		p.renameLabelSelector(o.Spec.Selector)
+		p.renameTemplate(&o.Spec.Template, envConfigMaps)
+	case *appsv1.DaemonSet:
+		p.renameLabelSelector(o.Spec.Selector)
+		p.renameTemplate(&o.Spec.Template, envConfigMaps)
+	case *appsv1.StatefulSet:
+		p.renameLabelSelector(o.Spec.Selector)
+		p.renameTemplate(&o.Spec.Template, envConfigMaps)
+		o.Spec.ServiceName = p.Renamed("Service", o.Spec.ServiceName)
+		for i := range o.Spec.VolumeClaimTemplates {
+			o.Spec.VolumeClaimTemplates[i].Labels = p.renameLabels(o.Spec.VolumeClaimTemplates[i].Labels)
+		}
+	case *batchv1.Job:
+		p.renameTemplate(&o.Spec.Template, envConfigMaps)
+	case *batchv1.CronJob:
+		o.Spec.JobTemplate.Labels = p.renameLabels(o.Spec.JobTemplate.Labels)
+		o.Spec.JobTemplate.Labels[PartOfLabel] = p.Project
+		p.renameTemplate(&o.Spec.JobTemplate.Spec.Template, envConfigMaps)
+	case *deployapi.DeploymentConfig:
+		o.Spec.Selector = p.renameLabels(o.Spec.Selector)
+		if o.Spec.Template != nil {
+			p.renameTemplate(o.Spec.Template, envConfigMaps)
+		}
+		for _, trigger := range o.Spec.Triggers {
+			if trigger.ImageChangeParams != nil {
+				p.renameImageStreamTag(&trigger.ImageChangeParams.From)
+			}
+		}
+	case *buildapi.BuildConfig:
+		if o.Spec.Output.To != nil {
+			p.renameImageStreamTag(o.Spec.Output.To)
+		}
+	case *api.Pod:
+		p.renamePodSpec(o.Labels[transformer.Selector], &o.Spec, envConfigMaps)
+	case *api.Service:
+		if o.Spec.Selector != nil {
+			o.Spec.Selector = p.renameLabels(o.Spec.Selector)
+		}
+	case *networkingv1.Ingress:
+		for i := range o.Spec.TLS {
+			o.Spec.TLS[i].SecretName = p.Renamed("Secret", o.Spec.TLS[i].SecretName)
+		}
+		if o.Spec.DefaultBackend != nil && o.Spec.DefaultBackend.Service != nil {
+			o.Spec.DefaultBackend.Service.Name = p.Renamed("Service", o.Spec.DefaultBackend.Service.Name)
+		}
+		for _, rule := range o.Spec.Rules {
+			if rule.HTTP == nil {
+				continue
+			}
+			for _, path := range rule.HTTP.Paths {
+				if path.Backend.Service != nil {
+					path.Backend.Service.Name = p.Renamed("Service", path.Backend.Service.Name)
+				}
+			}
+		}
+	case *autoscalingv2.HorizontalPodAutoscaler:
+		o.Spec.ScaleTargetRef.Name = p.Renamed(o.Spec.ScaleTargetRef.Kind, o.Spec.ScaleTargetRef.Name)
+	case *policyv1.PodDisruptionBudget:
+		p.renameLabelSelector(o.Spec.Selector)
+	case *unstructured.Unstructured:
+		switch o.GetKind() {
+		case "HTTPRoute":
+			p.renameHTTPRoute(o)
+		case "Gateway":
+			p.renameGateway(o)
+		}
+	case *rbacv1.RoleBinding:
+		o.RoleRef.Name = p.Renamed(o.RoleRef.Kind, o.RoleRef.Name)
+		p.renameSubjects(o.Subjects)
+	case *networkingv1.NetworkPolicy:
+		p.renameLabelSelector(&o.Spec.PodSelector)
+		for _, rule := range o.Spec.Ingress {
+			for _, peer := range rule.From {
+				p.renameLabelSelector(peer.PodSelector)
+			}
+		}
+		for _, rule := range o.Spec.Egress {
+			for _, peer := range rule.To {
+				p.renameLabelSelector(peer.PodSelector)
+			}
+		}
+	}
+}
+
+// renameLabels returns the labels with the service and network labels renamed
+func (p *ProjectNamer) renameLabels(labels map[string]string) map[string]string {
+	renamed := map[string]string{}
+	for key, value := range labels {
+		switch {
+		case key == transformer.Selector:
+			renamed[key] = p.Prefix(value)
+		case strings.HasPrefix(key, networkLabelPrefix):
+			renamed[networkLabelPrefix+p.Prefix(strings.TrimPrefix(key, networkLabelPrefix))] = value
+		default:
+			renamed[key] = value
+		}
+	}
+	return renamed
+}
+
+func (p *ProjectNamer) renameLabelSelector(selector *metav1.LabelSelector) {
+	if selector != nil && selector.MatchLabels != nil {
+		selector.MatchLabels = p.renameLabels(selector.MatchLabels)
+	}
+}
+
+// renameHTTPRoute rewrites the services an HTTP route routes to, and its parent Gateway when generated
+func (p *ProjectNamer) renameHTTPRoute(route *unstructured.Unstructured) {
+	parents, _, _ := unstructured.NestedSlice(route.Object, "spec", "parentRefs")
+	for _, parent := range parents {
+		if ref, ok := parent.(map[string]interface{}); ok && ref["namespace"] == nil {
+			ref["name"] = p.Renamed("Gateway", cast.ToString(ref["name"]))
+		}
+	}
+	rules, _, _ := unstructured.NestedSlice(route.Object, "spec", "rules")
+	for _, rule := range rules {
+		backends, _, _ := unstructured.NestedSlice(rule.(map[string]interface{}), "backendRefs")
+		for _, backend := range backends {
+			if ref, ok := backend.(map[string]interface{}); ok {
+				ref["name"] = p.Renamed("Service", cast.ToString(ref["name"]))
+			}
+		}
+		unstructured.SetNestedSlice(rule.(map[string]interface{}), backends, "backendRefs")
+	}
+	unstructured.SetNestedSlice(route.Object, parents, "spec", "parentRefs")
+	unstructured.SetNestedSlice(route.Object, rules, "spec", "rules")
+}
+
+// renameGateway rewrites the generated TLS secrets of the listeners of a Gateway
+func (p *ProjectNamer) renameGateway(gateway *unstructured.Unstructured) {
+	listeners, _, _ := unstructured.NestedSlice(gateway.Object, "spec", "listeners")
+	for _, listener := range listeners {
+		refs, _, _ := unstructured.NestedSlice(listener.(map[string]interface{}), "tls", "certificateRefs")
+		for _, ref := range refs {
+			if ref, ok := ref.(map[string]interface{}); ok && ref["namespace"] == nil {
+				ref["name"] = p.Renamed("Secret", cast.ToString(ref["name"]))
+			}
+		}
+		if len(refs) > 0 {
+			unstructured.SetNestedSlice(listener.(map[string]interface{}), refs, "tls", "certificateRefs")
+		}
+	}
+	unstructured.SetNestedSlice(gateway.Object, listeners, "spec", "listeners")
+}
+
+// renameSubjects rewrites the generated service accounts bound to a role
+func (p *ProjectNamer) renameSubjects(subjects []rbacv1.Subject) {
+	for i := range subjects {
+		if subjects[i].Kind == rbacv1.ServiceAccountKind {
+			subjects[i].Name = p.Renamed("ServiceAccount", subjects[i].Name)
+		}
+	}
+}
+
+func (p *ProjectNamer) renameTemplate(template *api.PodTemplateSpec, envConfigMaps map[string]string) {
+	service := template.Labels[transformer.Selector]
+	template.Labels = p.renameLabels(template.Labels)
+	template.Labels[PartOfLabel] = p.Project
+	p.renamePodSpec(service, &template.Spec, envConfigMaps)
+}
+
+// renamePodSpec rewrites the references of a pod to the volumes, config maps and secrets, and the
+// environment variables refering to the services. service is the compose service of the pod.
+func (p *ProjectNamer) renamePodSpec(service string, spec *api.PodSpec, envConfigMaps map[string]string) {
+	spec.ServiceAccountName = p.Renamed("ServiceAccount", spec.ServiceAccountName)
+	for i := range spec.Volumes {
+		source := &spec.Volumes[i].VolumeSource
+		if source.PersistentVolumeClaim != nil {
+			source.PersistentVolumeClaim.ClaimName = p.Renamed("PersistentVolumeClaim", source.PersistentVolumeClaim.ClaimName)
+		}
+		if source.ConfigMap != nil {
+			source.ConfigMap.Name = p.Renamed("ConfigMap", source.ConfigMap.Name)
+		}
+		if source.Secret != nil {
+			source.Secret.SecretName = p.Renamed("Secret", source.Secret.SecretName)
+		}
+	}
+
+	for i := range spec.InitContainers {
+		p.renameContainer(service, &spec.InitContainers[i], envConfigMaps)
+	}
+	for i := range spec.Containers {
+		p.renameContainer(service, &spec.Containers[i], envConfigMaps)
+	}
+}
+
+func (p *ProjectNamer) renameContainer(service string, container *api.Container, envConfigMaps map[string]string) {
+	for i := range container.Env {
+		env := &container.Env[i]
+		if env.ValueFrom == nil {
+			env.Value = p.renameHosts(service, env.Name, env.Value)
+			continue
+		}
+		if ref := env.ValueFrom.ConfigMapKeyRef; ref != nil {
+			if p.names["ConfigMap"][ref.Name] {
+				envConfigMaps[ref.Name] = service
+			}
+			ref.Name = p.Renamed("ConfigMap", ref.Name)
+		}
+		if ref := env.ValueFrom.SecretKeyRef; ref != nil {
+			ref.Name = p.Renamed("Secret", ref.Name)
+		}
+	}
+	for i := range container.EnvFrom {
+		source := &container.EnvFrom[i]
+		if source.ConfigMapRef != nil {
+			if p.names["ConfigMap"][source.ConfigMapRef.Name] {
+				envConfigMaps[source.ConfigMapRef.Name] = service
+			}
+			source.ConfigMapRef.Name = p.Renamed("ConfigMap", source.ConfigMapRef.Name)
+		}
+		if source.SecretRef != nil {
+			source.SecretRef.Name = p.Renamed("Secret", source.SecretRef.Name)
+		}
+	}
+}
+
+// renameImageStreamTag rewrites a reference to a tag of an image stream, like web:latest
+func (p *ProjectNamer) renameImageStreamTag(ref *api.ObjectReference) {
+	if ref.Kind != "ImageStreamTag" {
+		return
+	}
+	parts := strings.SplitN(ref.Name, ":", 2)
+	if renamed := p.Renamed("ImageStream", parts[0]); renamed != parts[0] {
+		ref.Name = strings.Replace(ref.Name, parts[0], renamed, 1)
+	}
+}
+
+// hostToken matches the words which may be host names
+var hostToken = regexp.MustCompile(`[A-Za-z0-9_.-]+`)
+
+// renameHosts rewrites the names of the renamed services used as host names in the value of
+// an environment variable, as in db, db:5432 or postgres://user@db/name. The other words of the
+// value are left alone, even when they are named like a service.
+func (p *ProjectNamer) renameHosts(service string, name string, value string) string {
+	var renamed strings.Builder
+	last := 0
+	for _, match := range hostToken.FindAllStringIndex(value, -1) {
+		start, end := match[0], match[1]
+		if !p.names["Service"][value[start:end]] || !isHostPosition(value, start, end) {
+			continue
+		}
+		renamed.WriteString(value[last:start])
+		renamed.WriteString(p.Prefix(value[start:end]))
+		last = end
+	}
+	if last == 0 {
+		return value
+	}
+	renamed.WriteString(value[last:])
+	p.Diagnostics.Infof(diagnostics.RuleRenamedService, service, diagnostics.ServicePath(service, "environment."+name),
+		"Environment variable %s of service %s refers to a service renamed with the project name %q", name, service, p.Project)
+	return renamed.String()
+}
+
+// isHostPosition returns whether the word of a value between start and end is a host name: the
+// whole value, the host of a URL, or a host followed by a port, alone or in a list
+func isHostPosition(value string, start int, end int) bool {
+	if start == 0 && end == len(value) {
+		return true
+	}
+	before, after := value[:start], value[end:]
+	if strings.HasSuffix(before, "://") || (strings.HasSuffix(before, "@") && strings.Contains(before, "://")) {
+		return after == "" || strings.ContainsAny(after[:1], ":/?#")
+	}
+	if len(after) < 2 || after[0] != ':' || after[1] < '0' || after[1] > '9' {
+		return false
+	}
+	return before == "" || strings.ContainsAny(before[len(before)-1:], ",; \t=")
+}
@@ -20,8 +20,11 @@ import (
 	"fmt"
 	"os"
 	"sort"
+	"strings"
 
+	"github.com/kubernetes/kompose/pkg/diagnostics"
 	"github.com/kubernetes/kompose/pkg/kobject"
+	"github.com/kubernetes/kompose/pkg/loader/compose"
 	"github.com/kubernetes/kompose/pkg/transformer"
 	"github.com/kubernetes/kompose/pkg/transformer/kubernetes"
 	deployapi "github.com/openshift/api/apps/v1"
@@ -251,12 +254,68 @@ func (o *OpenShift) initRoute(name string, service kobject.ServiceConfig, port i
 	return route
 }
 
+// initRoutes initializes the routes of a service. A route has a single path and port: the paths given
+// to kompose.service.expose.path get a route each, named after the service and the position of the path.
+func (o *OpenShift) initRoutes(name string, service kobject.ServiceConfig, port int32) []*routeapi.Route {
+	if len(service.ExposeServicePath) == 0 {
+		return []*routeapi.Route{o.initRoute(name, service, port)}
+	}
+	var routes []*routeapi.Route
+	for i, path := range service.ExposeServicePath {
+		routePort := port
+		if path.Port != 0 {
+			routePort = path.Port
+		}
+		route := o.initRoute(name, service, routePort)
+		if i > 0 {
+			route.Name = fmt.Sprintf("%s-%d", name, i+1)
+		}
+		route.Spec.Path = path.Path
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// configRouteTLS terminates TLS at the router for the services given a certificate: the route holds
+// the certificate of the PEM files of the service, or has it issued by cert-manager with
+// --cert-manager-issuer, which requires the openshift-routes extension of cert-manager
+func (o *OpenShift) configRouteTLS(service kobject.ServiceConfig, route *routeapi.Route) error {
+	if o.Opt.CertManagerIssuer != "" && (service.ExposeServiceTLS != "" || service.ExposeTLSCert != "") {
+		kind, issuer := kubernetes.CertManagerIssuerRef(o.Opt.CertManagerIssuer)
+		route.Annotations = map[string]string{
+			"cert-manager.io/issuer-kind": kind,
+			"cert-manager.io/issuer-name": issuer,
+		}
+		route.Spec.TLS = &routeapi.TLSConfig{Termination: routeapi.TLSTerminationEdge}
+		return nil
+	}
+	if service.ExposeTLSCert == "" {
+		return nil
+	}
+
+	cert, key, err := o.ReadTLSFiles(service)
+	if err != nil {
+		return err
+	}
+	route.Spec.TLS = &routeapi.TLSConfig{
+		Termination: routeapi.TLSTerminationEdge,
+		Certificate: string(cert),
+		Key:         string(key),
+	}
+	return nil
+}
+
 // Transform maps komposeObject to openshift objects
 // returns objects that are already sorted in the way that Services are first
 func (o *OpenShift) Transform(komposeObject kobject.KomposeObject, opt kobject.ConvertOptions) ([]runtime.Object, error) {
-	noSupKeys := o.Kubernetes.CheckUnsupportedKey(&komposeObject, unsupportedKey)
-	for _, keyName := range noSupKeys {
-		log.Warningf("OpenShift provider doesn't support %s key - ignoring", keyName)
+	for _, d := range o.Kubernetes.CheckUnsupportedKey(&komposeObject, unsupportedKey) {
+		opt.Diagnostics.Report(d)
+	}
+	if err := kubernetes.CheckNetworkModes(komposeObject, opt); err != nil {
+		return nil, err
+	}
+	if err := kubernetes.CheckIpcModes(komposeObject, opt); err != nil {
+		return nil, err
 	}
 	// this will hold all the converted data
 	var allobjects []runtime.Object
@@ -280,6 +339,15 @@ func (o *OpenShift) Transform(komposeObject kobject.KomposeObject, opt kobject.C
 		service := komposeObject.ServiceConfigs[name]
 		var objects []runtime.Object
 
+		if strings.HasPrefix(service.NetworkMode, "service:") {
+			opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, diagnostics.ServicePath(service.Name, "network_mode"),
+				"The OpenShift provider doesn't group the services, service %s runs in its own pods", service.Name)
+		}
+		if strings.HasPrefix(service.Ipc, "service:") {
+			opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, diagnostics.ServicePath(service.Name, "ipc"),
+				"The OpenShift provider doesn't group the services, service %s runs in its own pods", service.Name)
+		}
+
 		//replicas
 		var replica int
 		if opt.IsReplicaSetFlag || service.Replicas == 0 {
@@ -310,26 +378,33 @@ func (o *OpenShift) Transform(komposeObject kobject.KomposeObject, opt kobject.C
 			// Build the container!
 			err := transformer.BuildDockerImage(service, name)
 			if err != nil {
-				log.Fatalf("Unable to build Docker container for service %v: %v", name, err)
+				return nil, errors.Wrapf(err, "Unable to build Docker container for service %v", name)
 			}
 
 			// Push the built container to the repo!
 			err = transformer.PushDockerImageWithOpt(service, name, opt)
 			if err != nil {
-				log.Fatalf("Unable to push Docker image for service %v: %v", name, err)
+				return nil, errors.Wrapf(err, "Unable to push Docker image for service %v", name)
 			}
 		}
+		service.User = kubernetes.ResolveServiceUser(service, opt)
 
-		// Generate pod only and nothing more
-		if service.Restart == "no" || service.Restart == "on-failure" {
+		// Generate a job only and nothing more
+		runOnce := service.Restart == "no" || service.Restart == "none" || service.Restart == "on-failure"
+		if runOnce || kubernetes.IsJob(service, opt) {
 			// Error out if Controller Object is specified with restart: 'on-failure'
-			if opt.IsDeploymentConfigFlag {
+			if opt.IsDeploymentConfigFlag && runOnce && service.CronJobSchedule == "" {
 				return nil, errors.New("Controller object cannot be specified with restart: 'on-failure'")
 			}
-			pod := o.InitPod(name, service)
-			objects = append(objects, pod)
+			objects, err = o.CreateJobAndConfigMapObjects(name, service, opt)
+			if err != nil {
+				return nil, err
+			}
 		} else {
-			objects = o.CreateWorkloadAndConfigMapObjects(name, service, opt)
+			objects, err = o.CreateWorkloadAndConfigMapObjects(name, service, opt)
+			if err != nil {
+				return nil, err
+			}
 
 			if opt.CreateDeploymentConfig {
 				objects = append(objects, o.initDeploymentConfig(name, service, replica)) // OpenShift DeploymentConfigs
@@ -390,14 +465,42 @@ func (o *OpenShift) Transform(komposeObject kobject.KomposeObject, opt kobject.C
 					objects = append(objects, svc)
 				}
 				if len(svcs) > 1 {
-					log.Warningf("Create multiple service to avoid using mixed protocol in the same service when it's loadbalander type")
+					opt.Diagnostics.Warnf(diagnostics.RuleUnsupportedValue, service.Name, diagnostics.ServicePath(service.Name, "ports"), "Create multiple service to avoid using mixed protocol in the same service when it's loadbalander type")
 				}
 			} else {
-				svc := o.CreateService(name, service)
+				svc, err := o.CreateService(name, service)
+				if err != nil {
+					return nil, err
+				}
 				objects = append(objects, svc)
 
 				if service.ExposeService != "" {
-					objects = append(objects, o.initRoute(name, service, svc.Spec.Ports[0].Port))
+					if opt.ExposeMode == kubernetes.ExposeModeRoute || opt.ExposeMode == "" {
+						port := svc.Spec.Ports[0].Port
+						if service.ExposeServicePort != 0 {
+							port = service.ExposeServicePort
+						}
+						kubernetes.CheckIssuedTLSFiles(service, opt)
+						for _, route := range o.initRoutes(name, service, port) {
+							if err := o.configRouteTLS(service, route); err != nil {
+								return nil, err
+							}
+							objects = append(objects, route)
+						}
+					} else {
+						expose, err := o.InitExpose(name, service, svc)
+						if err != nil {
+							return nil, err
+						}
+						objects = append(objects, expose)
+						secret, err := o.InitExposeTLS(name, service)
+						if err != nil {
+							return nil, err
+						}
+						if secret != nil {
+							objects = append(objects, secret)
+						}
+					}
 				}
 			}
 		} else if service.ServiceType == "Headless" {
@@ -410,13 +513,72 @@ func (o *OpenShift) Transform(komposeObject kobject.KomposeObject, opt kobject.C
 			return nil, errors.Wrap(err, "Error transforming Kubernetes objects")
 		}
 
+		o.ConfigHorizontalPodAutoscaler(service, name, opt, &objects)
+		o.ConfigPodDisruptionBudget(service, name, &objects)
+
+		if err = o.ConfigServiceAccount(service, name, opt, &objects); err != nil {
+			return nil, err
+		}
+
+		if opt.WithSourceAnnotation {
+			annotateSources(service, objects)
+		}
 		allobjects = append(allobjects, objects...)
 	}
 
+	if opt.ExposeMode == kubernetes.ExposeModeGateway && opt.GatewayClass != "" {
+		allobjects = append(allobjects, o.InitGateway(komposeObject, opt))
+	}
+
+	if opt.Namespace != "" {
+		o.SetNamespace(allobjects, opt.Namespace)
+	}
+	if opt.ProjectName != "" {
+		renameProject(allobjects, opt)
+	}
+
 	// sort all object so Services are first
 	o.SortServicesFirst(&allobjects)
 	o.RemoveDupObjects(&allobjects)
 	// o.FixWorkloadVersion(&allobjects)
 
+	// the namespace has to be created before the objects it holds
+	if opt.CreateNamespace {
+		allobjects = append([]runtime.Object{o.InitNamespace(opt.Namespace)}, allobjects...)
+	}
+
 	return allobjects, nil
 }
+
+// annotateSources records on the objects generated for a service the location of the compose key
+// they were derived from, see kubernetes.SourceKey for the objects which are not specific to OpenShift
+func annotateSources(service kobject.ServiceConfig, objects []runtime.Object) {
+	for _, obj := range objects {
+		var key string
+		switch obj.(type) {
+		case *routeapi.Route:
+			key = "labels." + compose.LabelServiceExpose
+		case *imageapi.ImageStream:
+			key = "image"
+		case *buildapi.BuildConfig:
+			key = "build"
+		default:
+			key = kubernetes.SourceKey(service, obj)
+		}
+		if location, ok := service.Locate(key); ok {
+			transformer.AnnotateSource(obj, location)
+		}
+	}
+}
+
+// renameProject prefixes the names of the objects with the name of the project, see kubernetes.ProjectNamer,
+// and rewrites the references of the objects which are specific to OpenShift
+func renameProject(objects []runtime.Object, opt kobject.ConvertOptions) {
+	namer := &kubernetes.ProjectNamer{Project: opt.ProjectName, Diagnostics: opt.Diagnostics}
+	namer.Rename(objects)
+	for _, obj := range objects {
+		if route, ok := obj.(*routeapi.Route); ok && route.Spec.To.Kind == "Service" {
+			route.Spec.To.Name = namer.Renamed("Service", route.Spec.To.Name)
+		}
+	}
+}
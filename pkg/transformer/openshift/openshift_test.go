@@ -125,6 +125,32 @@ func TestKomposeConvertRoute(t *testing.T) {
 	}
 }
 
+func TestInitRoutes(t *testing.T) {
+	o := OpenShift{}
+	sc := newServiceConfig()
+	sc.ExposeService = "example.com"
+	sc.ExposeServicePath = []kobject.ExposePath{{Path: "/"}, {Path: "/api", Port: 9090}}
+	routes := o.initRoutes("app", sc, 8080)
+
+	if len(routes) != 2 {
+		t.Fatalf("Expected a route by path, got %d", len(routes))
+	}
+	expected := []struct {
+		name string
+		path string
+		port int32
+	}{{"app", "/", 8080}, {"app-2", "/api", 9090}}
+	for i, route := range routes {
+		if route.Name != expected[i].name || route.Spec.Path != expected[i].path || route.Spec.Port.TargetPort.IntVal != expected[i].port {
+			t.Errorf("Expected route %s of path %s to port %d, got %s of path %s to port %d", expected[i].name, expected[i].path, expected[i].port,
+				route.Name, route.Spec.Path, route.Spec.Port.TargetPort.IntVal)
+		}
+		if route.Spec.To.Name != "app" || route.Spec.Host != "example.com" {
+			t.Errorf("Expected route %s to example.com routed to service app, got %v", route.Name, route.Spec)
+		}
+	}
+}
+
 //Test getting git remote url for a directory
 func TestGetGitRemote(t *testing.T) {
 	var output string
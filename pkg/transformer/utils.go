@@ -20,7 +20,6 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"strings"
@@ -32,11 +31,16 @@ import (
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // Selector used as labels and selector
 const Selector = "io.kompose.service"
 
+// SourceAnnotation records the compose key an object was generated from
+const SourceAnnotation = "kompose.io/source"
+
 // Exists returns true if a file path exists.
 // Otherwise, returns false.
 func Exists(p string) bool {
@@ -254,22 +258,33 @@ func ConfigAnnotations(service kobject.ServiceConfig) map[string]string {
 		return annotations
 	}
 
-	annotations["kompose.cmd"] = strings.Join(os.Args, " ")
-	versionCmd := exec.Command("kompose", "version")
-	out, err := versionCmd.Output()
-	if err != nil {
-		errors.Wrap(err, "Failed to get kompose version")
-	}
-	annotations["kompose.version"] = strings.Trim(string(out), " \n")
-
-	// If the version is blank (couldn't retrieve the kompose version for whatever reason)
-	if annotations["kompose.version"] == "" {
-		annotations["kompose.version"] = version.VERSION + " (" + version.GITCOMMIT + ")"
+	if service.KomposeCommand != "" {
+		annotations["kompose.cmd"] = service.KomposeCommand
 	}
+	annotations["kompose.version"] = version.VERSION + " (" + version.GITCOMMIT + ")"
 
 	return annotations
 }
 
+// AnnotateSource records on an object the location of the compose key it was generated from.
+// An object already annotated, like an object shared by the services of a group, is left as is.
+func AnnotateSource(obj runtime.Object, location kobject.SourceLocation) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		log.Debugf("Unable to annotate the source of %T: %v", obj, err)
+		return
+	}
+	annotations := accessor.GetAnnotations()
+	if _, ok := annotations[SourceAnnotation]; ok {
+		return
+	}
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[SourceAnnotation] = location.String()
+	accessor.SetAnnotations(annotations)
+}
+
 // Print either prints to stdout or to file/s
 func Print(name, path string, trailing string, data []byte, toStdout, generateJSON bool, f *os.File, provider string) (string, error) {
 	file := ""
@@ -444,3 +459,26 @@ func PushDockerImageWithOpt(service kobject.ServiceConfig, serviceName string, o
 
 	return nil
 }
+
+// ReadImageUsers reads the users and the groups of the image of a service, from the OCI image layout of
+// --oci-layout, or else from the local docker daemon
+func ReadImageUsers(service kobject.ServiceConfig, opt kobject.ConvertOptions) (docker.ImageUsers, error) {
+	image := service.Image
+	if image == "" && opt.Build == "local" && service.Build != "" {
+		image = service.Name
+	}
+	if image == "" {
+		return docker.ImageUsers{}, fmt.Errorf("no image to resolve the users of service %s from", service.Name)
+	}
+
+	if opt.OCILayout != "" {
+		return docker.ReadOCILayoutUsers(opt.OCILayout, image)
+	}
+
+	client, err := docker.Client()
+	if err != nil {
+		return docker.ImageUsers{}, err
+	}
+	users := docker.Users{Client: *client}
+	return users.ReadImageUsers(image)
+}
@@ -0,0 +1,351 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docker
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	dockerlib "github.com/fsouza/go-dockerclient"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// The files of an image holding its users and its groups
+const (
+	passwdFile = "etc/passwd"
+	groupFile  = "etc/group"
+)
+
+// ImageUser is a user of an image, with the id of its primary group
+type ImageUser struct {
+	UID int64
+	GID int64
+}
+
+// ImageUsers are the users and the groups of an image, read from its /etc/passwd and /etc/group
+type ImageUsers struct {
+	Users  map[string]ImageUser
+	Groups map[string]int64
+}
+
+// ParseImageUsers parses the /etc/passwd and /etc/group files of an image, the malformed lines being skipped
+func ParseImageUsers(passwd []byte, group []byte) ImageUsers {
+	users := ImageUsers{Users: map[string]ImageUser{}, Groups: map[string]int64{}}
+
+	// name:password:uid:gid:gecos:home:shell
+	for _, fields := range parseColonFile(passwd) {
+		if len(fields) < 4 {
+			continue
+		}
+		uid, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		gid, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			continue
+		}
+		users.Users[fields[0]] = ImageUser{UID: uid, GID: gid}
+	}
+
+	// name:password:gid:members
+	for _, fields := range parseColonFile(group) {
+		if len(fields) < 3 {
+			continue
+		}
+		gid, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		users.Groups[fields[0]] = gid
+	}
+	return users
+}
+
+// parseColonFile splits the lines of a file like /etc/passwd in their fields, skipping the comments
+func parseColonFile(content []byte) [][]string {
+	var lines [][]string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, strings.Split(line, ":"))
+	}
+	return lines
+}
+
+// ResolveUser returns the numeric form of a compose user, given as user[:group] with names or ids.
+// A named user given without group runs with its primary group, like with docker.
+func (u ImageUsers) ResolveUser(user string) (string, error) {
+	name, group := user, ""
+	if i := strings.Index(user, ":"); i >= 0 {
+		name, group = user[:i], user[i+1:]
+	}
+
+	uid := name
+	if _, err := strconv.ParseInt(name, 10, 64); err != nil {
+		imageUser, ok := u.Users[name]
+		if !ok {
+			return "", fmt.Errorf("unknown user %s", name)
+		}
+		uid = strconv.FormatInt(imageUser.UID, 10)
+		if group == "" {
+			return fmt.Sprintf("%s:%d", uid, imageUser.GID), nil
+		}
+	}
+	if group == "" {
+		return uid, nil
+	}
+
+	if _, err := strconv.ParseInt(group, 10, 64); err == nil {
+		return uid + ":" + group, nil
+	}
+	gid, ok := u.Groups[group]
+	if !ok {
+		return "", fmt.Errorf("unknown group %s", group)
+	}
+	return fmt.Sprintf("%s:%d", uid, gid), nil
+}
+
+// Users will provide methods for reading the users of the images of the local daemon
+type Users struct {
+	Client dockerlib.Client
+}
+
+// ReadImageUsers reads the users of an image of the local daemon, from a container created for the purpose,
+// and never started
+func (c *Users) ReadImageUsers(image string) (ImageUsers, error) {
+	container, err := c.Client.CreateContainer(dockerlib.CreateContainerOptions{
+		Config: &dockerlib.Config{Image: image, Entrypoint: []string{"true"}},
+	})
+	if err != nil {
+		return ImageUsers{}, errors.Wrapf(err, "unable to create a container of image %s", image)
+	}
+	defer func() {
+		if err := c.Client.RemoveContainer(dockerlib.RemoveContainerOptions{ID: container.ID, Force: true}); err != nil {
+			log.Warnf("Unable to remove the container %s of image %s: %s", container.ID, image, err)
+		}
+	}()
+
+	files := map[string][]byte{}
+	for _, file := range []string{passwdFile, groupFile} {
+		var archive bytes.Buffer
+		err := c.Client.DownloadFromContainer(container.ID, dockerlib.DownloadFromContainerOptions{
+			Path:         "/" + file,
+			OutputStream: &archive,
+		})
+		if err != nil {
+			// the images without users, like the ones built from scratch, have no /etc/passwd
+			log.Debugf("Unable to read /%s of image %s: %s", file, image, err)
+			continue
+		}
+		reader := tar.NewReader(&archive)
+		if _, err := reader.Next(); err != nil {
+			return ImageUsers{}, errors.Wrapf(err, "unable to read /%s of image %s", file, image)
+		}
+		if files[file], err = ioutil.ReadAll(reader); err != nil {
+			return ImageUsers{}, errors.Wrapf(err, "unable to read /%s of image %s", file, image)
+		}
+	}
+	return ParseImageUsers(files[passwdFile], files[groupFile]), nil
+}
+
+// ociDescriptor is the descriptor of a content of an OCI image layout
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *ociPlatform      `json:"platform,omitempty"`
+}
+
+// ociPlatform is the platform of an image manifest listed by an image index
+type ociPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+// ociIndex is an image index, or an image manifest, of an OCI image layout
+type ociIndex struct {
+	MediaType string          `json:"mediaType"`
+	Manifests []ociDescriptor `json:"manifests"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+// The annotations naming the images of an OCI image layout, and the media types of the image indexes
+const (
+	ociRefNameAnnotation        = "org.opencontainers.image.ref.name"
+	containerdImageAnnotation   = "io.containerd.image.name"
+	ociImageIndexMediaType      = "application/vnd.oci.image.index.v1+json"
+	dockerManifestListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+// ReadOCILayoutUsers reads the users of an image of an OCI image layout directory, the image being the one
+// named after it by its annotations, or the only one of the layout
+func ReadOCILayoutUsers(dir string, image string) (ImageUsers, error) {
+	var index ociIndex
+	if err := readOCIBlob(filepath.Join(dir, "index.json"), &index); err != nil {
+		return ImageUsers{}, err
+	}
+
+	descriptor, err := findOCIImage(index.Manifests, image)
+	if err != nil {
+		return ImageUsers{}, errors.Wrapf(err, "unable to find image %s in %s", image, dir)
+	}
+
+	// an image index lists the manifests of the image by platform, the one of linux/amd64 is preferred
+	for descriptor.MediaType == ociImageIndexMediaType || descriptor.MediaType == dockerManifestListMediaType {
+		var platforms ociIndex
+		if err := readOCIBlob(ociBlobPath(dir, descriptor.Digest), &platforms); err != nil {
+			return ImageUsers{}, err
+		}
+		if len(platforms.Manifests) == 0 {
+			return ImageUsers{}, fmt.Errorf("image index %s of image %s has no manifest", descriptor.Digest, image)
+		}
+		descriptor = platforms.Manifests[0]
+		for _, manifest := range platforms.Manifests {
+			if manifest.Platform != nil && manifest.Platform.OS == "linux" && manifest.Platform.Architecture == "amd64" {
+				descriptor = manifest
+				break
+			}
+		}
+	}
+
+	var manifest ociIndex
+	if err := readOCIBlob(ociBlobPath(dir, descriptor.Digest), &manifest); err != nil {
+		return ImageUsers{}, err
+	}
+
+	files := map[string][]byte{}
+	for _, layer := range manifest.Layers {
+		if err := readOCILayer(ociBlobPath(dir, layer.Digest), files); err != nil {
+			return ImageUsers{}, errors.Wrapf(err, "unable to read layer %s of image %s", layer.Digest, image)
+		}
+	}
+	return ParseImageUsers(files[passwdFile], files[groupFile]), nil
+}
+
+// findOCIImage returns the descriptor of the image named after a compose image by its full reference, like
+// postgres:13 or docker.io/library/postgres:13, or the only image of the layout when it isn't named at all.
+// The annotations only giving a tag, which don't tell the images apart, are ignored.
+func findOCIImage(descriptors []ociDescriptor, image string) (ociDescriptor, error) {
+	reference := fullReference(image)
+	for _, descriptor := range descriptors {
+		for _, annotation := range []string{ociRefNameAnnotation, containerdImageAnnotation} {
+			name := descriptor.Annotations[annotation]
+			if name != "" && (name == image || (reference != "" && fullReference(name) == reference)) {
+				return descriptor, nil
+			}
+		}
+	}
+	if len(descriptors) == 1 && descriptors[0].Annotations[ociRefNameAnnotation] == "" &&
+		descriptors[0].Annotations[containerdImageAnnotation] == "" {
+		return descriptors[0], nil
+	}
+	return ociDescriptor{}, errors.New("no image of the layout is named after it")
+}
+
+// fullReference returns the reference of an image with its registry and its tag, like
+// docker.io/library/postgres:13 for postgres:13, or an empty string for an invalid reference
+func fullReference(image string) string {
+	parsed, err := ParseImage(image, "")
+	if err != nil {
+		return ""
+	}
+	return parsed.Remote
+}
+
+// ociBlobPath returns the path of a blob of an OCI image layout, from its digest
+func ociBlobPath(dir string, digest string) string {
+	return filepath.Join(dir, "blobs", strings.Replace(digest, ":", string(filepath.Separator), 1))
+}
+
+// readOCIBlob reads a JSON blob of an OCI image layout
+func readOCIBlob(file string, v interface{}) error {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		return errors.Wrapf(err, "unable to parse %s", file)
+	}
+	return nil
+}
+
+// readOCILayer applies a layer, compressed or not, to the users and the groups files read from the layers below
+func readOCILayer(file string, files map[string][]byte) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	var stream io.Reader = reader
+	if magic, err := reader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		stream = gz
+	}
+
+	archive := tar.NewReader(stream)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+header.Name), "/")
+		dir, base := path.Split(name)
+		switch {
+		// an opaque whiteout hides the content of its directory from the layers below
+		case base == ".wh..wh..opq" && dir == "etc/", base == ".wh.etc" && dir == "":
+			delete(files, passwdFile)
+			delete(files, groupFile)
+		case base == ".wh.passwd" && dir == "etc/", base == ".wh.group" && dir == "etc/":
+			delete(files, dir+strings.TrimPrefix(base, ".wh."))
+		case name == passwdFile || name == groupFile:
+			if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+				continue
+			}
+			content, err := ioutil.ReadAll(archive)
+			if err != nil {
+				return err
+			}
+			files[name] = content
+		}
+	}
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	testPasswd = `root:x:0:0:root:/root:/bin/sh
+# a comment
+postgres:x:70:70:PostgreSQL user:/var/lib/postgresql:/bin/sh
+broken:x:not-a-uid:1:::
+`
+	testGroup = `root:x:0:
+staff:x:50:postgres
+postgres:x:70:
+`
+)
+
+func TestResolveUser(t *testing.T) {
+	users := ParseImageUsers([]byte(testPasswd), []byte(testGroup))
+
+	tests := []struct {
+		user    string
+		want    string
+		wantErr bool
+	}{
+		{"1000", "1000", false},
+		{"1000:1000", "1000:1000", false},
+		{"postgres", "70:70", false},
+		{"postgres:staff", "70:50", false},
+		{"postgres:0", "70:0", false},
+		{"1000:staff", "1000:50", false},
+		{"broken", "", true},
+		{"nobody", "", true},
+		{"postgres:nogroup", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.user, func(t *testing.T) {
+			got, err := users.ResolveUser(tt.user)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ResolveUser() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ResolveUser() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// writeBlob writes a blob of an OCI image layout and returns its descriptor
+func writeBlob(t *testing.T, dir string, mediaType string, content []byte) ociDescriptor {
+	digest := fmt.Sprintf("%x", sha256.Sum256(content))
+	if err := ioutil.WriteFile(filepath.Join(dir, "blobs", "sha256", digest), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return ociDescriptor{MediaType: mediaType, Digest: "sha256:" + digest}
+}
+
+// layer returns a tar layer, gzipped or not, with the given files
+func layer(t *testing.T, gzipped bool, files map[string]string) []byte {
+	var buf bytes.Buffer
+	var tw *tar.Writer
+	var gw *gzip.Writer
+	if gzipped {
+		gw = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(gw)
+	} else {
+		tw = tar.NewWriter(&buf)
+	}
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gw != nil {
+		if err := gw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestReadOCILayoutUsers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kompose-oci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second layer replaces /etc/passwd and removes /etc/group
+	base := writeBlob(t, dir, "application/vnd.oci.image.layer.v1.tar+gzip", layer(t, true, map[string]string{
+		"etc/passwd": "root:x:0:0::/root:/bin/sh\n",
+		"etc/group":  testGroup,
+	}))
+	top := writeBlob(t, dir, "application/vnd.oci.image.layer.v1.tar", layer(t, false, map[string]string{
+		"./etc/passwd":   testPasswd,
+		"etc/.wh.group":  "",
+		"usr/bin/binary": "binary",
+	}))
+	manifest, _ := json.Marshal(ociIndex{MediaType: "application/vnd.oci.image.manifest.v1+json", Layers: []ociDescriptor{base, top}})
+	imageManifest := writeBlob(t, dir, "application/vnd.oci.image.manifest.v1+json", manifest)
+
+	// the image is a multi-platform one, and the layout holds another image
+	arm := ociDescriptor{MediaType: "application/vnd.oci.image.manifest.v1+json", Digest: "sha256:missing"}
+	arm.Platform = &ociPlatform{Architecture: "arm64", OS: "linux"}
+	amd := imageManifest
+	amd.Platform = &ociPlatform{Architecture: "amd64", OS: "linux"}
+	platforms, _ := json.Marshal(ociIndex{MediaType: ociImageIndexMediaType, Manifests: []ociDescriptor{arm, amd}})
+	imageIndex := writeBlob(t, dir, ociImageIndexMediaType, platforms)
+	imageIndex.Annotations = map[string]string{ociRefNameAnnotation: "docker.io/library/postgres:13"}
+	other := ociDescriptor{MediaType: "application/vnd.oci.image.manifest.v1+json", Digest: "sha256:missing",
+		Annotations: map[string]string{ociRefNameAnnotation: "docker.io/library/redis:6"}}
+	index, _ := json.Marshal(ociIndex{Manifests: []ociDescriptor{other, imageIndex}})
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.json"), index, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := ReadOCILayoutUsers(dir, "postgres:13")
+	if err != nil {
+		t.Fatalf("ReadOCILayoutUsers() error = %v", err)
+	}
+	if user, ok := users.Users["postgres"]; !ok || user.UID != 70 || user.GID != 70 {
+		t.Errorf("Expected user postgres 70:70, got %v", users.Users)
+	}
+	if len(users.Groups) != 0 {
+		t.Errorf("Expected the groups to be removed by the whiteout, got %v", users.Groups)
+	}
+
+	if _, err := ReadOCILayoutUsers(dir, "mysql"); err == nil {
+		t.Errorf("Expected an error for an image missing from the layout")
+	}
+}
+
+func TestFindOCIImage(t *testing.T) {
+	descriptor := func(digest string, name string) ociDescriptor {
+		return ociDescriptor{Digest: digest, Annotations: map[string]string{ociRefNameAnnotation: name}}
+	}
+	layout := []ociDescriptor{
+		descriptor("sha256:redis", "redis:13"),
+		descriptor("sha256:postgres", "docker.io/library/postgres:13"),
+		descriptor("sha256:tag", "13"),
+	}
+
+	tests := []struct {
+		image       string
+		descriptors []ociDescriptor
+		want        string
+		wantErr     bool
+	}{
+		{"postgres:13", layout, "sha256:postgres", false},
+		{"library/postgres:13", layout, "sha256:postgres", false},
+		{"redis:13", layout, "sha256:redis", false},
+		// the images sharing a tag aren't mistaken for one another
+		{"mysql:13", layout, "", true},
+		{"myregistry:5000/redis:13", layout, "", true},
+		// the only image of a layout is the one given, unless it's named after another one
+		{"mysql:13", []ociDescriptor{{Digest: "sha256:unnamed"}}, "sha256:unnamed", false},
+		{"mysql:13", layout[2:], "", true},
+		{"mysql:13", layout[:1], "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			got, err := findOCIImage(tt.descriptors, tt.image)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("findOCIImage() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got.Digest != tt.want {
+				t.Errorf("findOCIImage() = %v, want %v", got.Digest, tt.want)
+			}
+		})
+	}
+}